@@ -0,0 +1,167 @@
+package safebuffer
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+)
+
+// ErrOutOfRange is the error a ResizableBuffer holds once a write is given an offset outside
+// of the consumed buffer.
+var ErrOutOfRange = errors.New("safebuffer: offset is out of range")
+
+// WithPutAtGrowth sets whether writes at an offset that go past the end of the consumed buffer
+// grow it, filling any gap with zeroes. By default, these writes are ignored and Err returns
+// ErrOutOfRange. With growth on, an offset too large for any buffer gives ErrTooLarge.
+func (b *ResizableBuffer) WithPutAtGrowth(grow bool) *ResizableBuffer {
+	b.putAtGrowth = grow
+	return b
+}
+
+// at returns the n bytes at the offset given within the consumed buffer, or nil if they are
+// out of range and the error has been set.
+func (b *ResizableBuffer) at(off, n int) []byte {
+	b.check()
+	if b.err != nil {
+		return nil
+	}
+	if off < 0 || n < 0 {
+		b.err = ErrOutOfRange
+		return nil
+	}
+	// This is checked without adding to off, which could overflow.
+	if off > b.offset-n {
+		if !b.putAtGrowth {
+			b.err = ErrOutOfRange
+			return nil
+		}
+		if n > math.MaxInt-b.start-off {
+			// No backing array could reach this far.
+			b.err = ErrTooLarge
+			return nil
+		}
+		over := off + n - b.offset
+		if !b.ensureCapacity(over) {
+			return nil
+		}
+		end := b.end()
+		clear(b.buffer[end : end+over])
+		b.offset += over
+	}
+	start := b.start + off
+	return b.buffer[start : start+n]
+}
+
+// PutBytesAt copies the bytes specified into the consumed buffer at the offset given.
+func (b *ResizableBuffer) PutBytesAt(off int, p []byte) *ResizableBuffer {
+	if s := b.at(off, len(p)); s != nil {
+		copy(s, p)
+	}
+	return b
+}
+
+// PutStringAt copies the string specified into the consumed buffer at the offset given.
+func (b *ResizableBuffer) PutStringAt(off int, p string) *ResizableBuffer {
+	if s := b.at(off, len(p)); s != nil {
+		copy(s, p)
+	}
+	return b
+}
+
+// PutByteAt writes a single byte into the consumed buffer at the offset given.
+func (b *ResizableBuffer) PutByteAt(off int, bt byte) *ResizableBuffer {
+	if s := b.at(off, 1); s != nil {
+		s[0] = bt
+	}
+	return b
+}
+
+// PutUint16At writes a uint16 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) PutUint16At(off int, v uint16, littleEndian bool) *ResizableBuffer {
+	if s := b.at(off, 2); s != nil {
+		if littleEndian {
+			binary.LittleEndian.PutUint16(s, v)
+		} else {
+			binary.BigEndian.PutUint16(s, v)
+		}
+	}
+	return b
+}
+
+// PutUint32At writes a uint32 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) PutUint32At(off int, v uint32, littleEndian bool) *ResizableBuffer {
+	if s := b.at(off, 4); s != nil {
+		if littleEndian {
+			binary.LittleEndian.PutUint32(s, v)
+		} else {
+			binary.BigEndian.PutUint32(s, v)
+		}
+	}
+	return b
+}
+
+// PutUint64At writes a uint64 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) PutUint64At(off int, v uint64, littleEndian bool) *ResizableBuffer {
+	if s := b.at(off, 8); s != nil {
+		if littleEndian {
+			binary.LittleEndian.PutUint64(s, v)
+		} else {
+			binary.BigEndian.PutUint64(s, v)
+		}
+	}
+	return b
+}
+
+// PutInt16At writes a int16 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) PutInt16At(off int, v int16, littleEndian bool) *ResizableBuffer {
+	return b.PutUint16At(off, uint16(v), littleEndian)
+}
+
+// PutInt32At writes a int32 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) PutInt32At(off int, v int32, littleEndian bool) *ResizableBuffer {
+	return b.PutUint32At(off, uint32(v), littleEndian)
+}
+
+// PutInt64At writes a int64 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) PutInt64At(off int, v int64, littleEndian bool) *ResizableBuffer {
+	return b.PutUint64At(off, uint64(v), littleEndian)
+}
+
+// PutFloat32At writes a float32 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) PutFloat32At(off int, v float32, littleEndian bool) *ResizableBuffer {
+	return b.PutUint32At(off, math.Float32bits(v), littleEndian)
+}
+
+// PutFloat64At writes a float64 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) PutFloat64At(off int, v float64, littleEndian bool) *ResizableBuffer {
+	return b.PutUint64At(off, math.Float64bits(v), littleEndian)
+}
+
+// WriteAt implements io.WriterAt. It copies the bytes specified into the consumed buffer at
+// the offset given. The only error returned is the one from Err.
+func (b *ResizableBuffer) WriteAt(p []byte, off int64) (int, error) {
+	if off > math.MaxInt {
+		off = -1
+	}
+	if b.PutBytesAt(int(off), p).err != nil {
+		return 0, b.err
+	}
+	return len(p), nil
+}
+
+// ReadAt implements io.ReaderAt. It copies from the consumed buffer at the offset given into p.
+// If there is not enough data to fill p, io.EOF is returned.
+func (b *ResizableBuffer) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrOutOfRange
+	}
+	if off >= int64(b.offset) {
+		return 0, io.EOF
+	}
+	n := copy(p, b.Bytes()[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,153 @@
+package safebuffer
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"testing"
+)
+
+var (
+	_ io.WriterAt = (*ResizableBuffer)(nil)
+	_ io.ReaderAt = (*ResizableBuffer)(nil)
+)
+
+func TestPutAt(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(b *ResizableBuffer) *ResizableBuffer
+		eq   []byte
+	}{
+		{"bytes", func(b *ResizableBuffer) *ResizableBuffer { return b.PutBytesAt(2, []byte{1, 2}) }, []byte{1, 2}},
+		{"string", func(b *ResizableBuffer) *ResizableBuffer { return b.PutStringAt(2, "ab") }, []byte("ab")},
+		{"byte", func(b *ResizableBuffer) *ResizableBuffer { return b.PutByteAt(2, 7) }, []byte{7}},
+		{"uint16", func(b *ResizableBuffer) *ResizableBuffer { return b.PutUint16At(2, 0x0102, true) }, []byte{2, 1}},
+		{"uint32", func(b *ResizableBuffer) *ResizableBuffer { return b.PutUint32At(2, 0x01020304, false) }, []byte{1, 2, 3, 4}},
+		{"uint64", func(b *ResizableBuffer) *ResizableBuffer { return b.PutUint64At(2, 0x0102030405060708, true) }, []byte{8, 7, 6, 5, 4, 3, 2, 1}},
+		{"int16", func(b *ResizableBuffer) *ResizableBuffer { return b.PutInt16At(2, -1, false) }, slowButKnownGoodValConv(int16(-1), false)},
+		{"int32", func(b *ResizableBuffer) *ResizableBuffer { return b.PutInt32At(2, -1, true) }, slowButKnownGoodValConv(int32(-1), true)},
+		{"int64", func(b *ResizableBuffer) *ResizableBuffer { return b.PutInt64At(2, -1, false) }, slowButKnownGoodValConv(int64(-1), false)},
+		{"float32", func(b *ResizableBuffer) *ResizableBuffer { return b.PutFloat32At(2, 1.2, true) }, slowButKnownGoodValConv(float32(1.2), true)},
+		{"float64", func(b *ResizableBuffer) *ResizableBuffer { return b.PutFloat64At(2, 1.2, false) }, slowButKnownGoodValConv(float64(1.2), false)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Run("in range", func(t *testing.T) {
+				rb := NewResizableBuffer(nil).CopyBytes(make([]byte, 12)).PrependByte(0xff)
+				if test.fn(rb) != rb {
+					t.Fatal("expected fn to return the buffer")
+				}
+				expected := make([]byte, 13)
+				expected[0] = 0xff
+				copy(expected[2:], test.eq)
+				if !bytes.Equal(rb.Bytes(), expected) {
+					t.Fatalf("expected %v, got %v", expected, rb.Bytes())
+				}
+			})
+
+			t.Run("out of range", func(t *testing.T) {
+				rb := NewResizableBuffer(nil).CopyBytes([]byte{1, 2})
+				test.fn(rb)
+				if rb.Err() != ErrOutOfRange {
+					t.Fatalf("expected ErrOutOfRange, got %v", rb.Err())
+				}
+				if !bytes.Equal(rb.Bytes(), []byte{1, 2}) {
+					t.Fatalf("expected buffer to be un-changed, got %v", rb.Bytes())
+				}
+			})
+
+			t.Run("grows", func(t *testing.T) {
+				buffer := bytes.Repeat([]byte{0xff}, 100)
+				rb := NewResizableBuffer(buffer).WithPutAtGrowth(true).Byte(1)
+				test.fn(rb)
+				if rb.Err() != nil {
+					t.Fatalf("expected nil error, got %v", rb.Err())
+				}
+				expected := append([]byte{1, 0}, test.eq...)
+				if !bytes.Equal(rb.Bytes(), expected) {
+					t.Fatalf("expected %v, got %v", expected, rb.Bytes())
+				}
+			})
+		})
+	}
+}
+
+func TestPutAtErrors(t *testing.T) {
+	t.Run("negative offset", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithPutAtGrowth(true).CopyString("abc")
+		rb.PutByteAt(-1, 'x')
+		if rb.Err() != ErrOutOfRange {
+			t.Fatalf("expected ErrOutOfRange, got %v", rb.Err())
+		}
+	})
+
+	t.Run("offset near the maximum int", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		rb.PutUint32At(math.MaxInt-2, 1, true)
+		if rb.Err() != ErrOutOfRange {
+			t.Fatalf("expected ErrOutOfRange, got %v", rb.Err())
+		}
+		rb = NewResizableBuffer(nil)
+		if _, err := rb.WriteAt([]byte("xyz"), math.MaxInt64-1); err != ErrOutOfRange {
+			t.Fatalf("expected ErrOutOfRange, got %v", err)
+		}
+	})
+
+	t.Run("growth to an offset near the maximum int", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithPutAtGrowth(true).WithHeadroom(8).CopyString("abc")
+		rb.PutUint32At(math.MaxInt-2, 1, true)
+		if rb.Err() != ErrTooLarge || rb.Len() != 3 {
+			t.Fatalf("expected ErrTooLarge and no change, got %v and %d bytes", rb.Err(), rb.Len())
+		}
+		rb = NewResizableBuffer(nil).WithPutAtGrowth(true)
+		if _, err := rb.WriteAt([]byte("xyz"), math.MaxInt64-1); err != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("growth respects max size", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithPutAtGrowth(true).WithMaxSize(4)
+		rb.PutUint32At(1, 1, true)
+		if rb.Err() != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", rb.Err())
+		}
+	})
+}
+
+func TestWriteAt(t *testing.T) {
+	rb := NewResizableBuffer(nil).CopyString("hello world")
+	n, err := rb.WriteAt([]byte("WORLD"), 6)
+	if err != nil || n != 5 {
+		t.Fatalf("expected 5, nil, got %d, %v", n, err)
+	}
+	if string(rb.Bytes()) != "hello WORLD" {
+		t.Fatalf("expected hello WORLD, got %q", rb.Bytes())
+	}
+	if _, err := rb.WriteAt([]byte("!!"), 10); err != ErrOutOfRange {
+		t.Fatalf("expected ErrOutOfRange, got %v", err)
+	}
+}
+
+func TestReadAt(t *testing.T) {
+	rb := NewResizableBuffer(nil).CopyString("hello world").PrependString(">")
+	p := make([]byte, 5)
+	n, err := rb.ReadAt(p, 1)
+	if err != nil || n != 5 || string(p) != "hello" {
+		t.Fatalf("expected 5, nil, hello, got %d, %v, %q", n, err, p)
+	}
+	n, err = rb.ReadAt(p, 9)
+	if err != io.EOF || n != 3 || string(p[:n]) != "rld" {
+		t.Fatalf("expected 3, io.EOF, rld, got %d, %v, %q", n, err, p[:n])
+	}
+	if _, err := rb.ReadAt(p, 12); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+	if _, err := rb.ReadAt(p, -1); err != ErrOutOfRange {
+		t.Fatalf("expected ErrOutOfRange, got %v", err)
+	}
+	sr := io.NewSectionReader(rb, 7, 5)
+	s, _ := io.ReadAll(sr)
+	if string(s) != "world" {
+		t.Fatalf("expected world, got %q", s)
+	}
+}
@@ -0,0 +1,141 @@
+package safebuffer
+
+// BitWriter packs values at bit granularity into a ResizableBuffer. Bits are gathered into a
+// byte and written to the buffer once the byte is full, so anything written directly to the
+// buffer while a byte is partly filled ends up in front of it. Call Align first to mix bit
+// and byte level writes. This is single threaded.
+type BitWriter struct {
+	b        *ResizableBuffer
+	lsbFirst bool
+	acc      byte
+	n        int
+}
+
+// NewBitWriter creates a new BitWriter that appends to the buffer given. By default, bits fill
+// each byte from the most significant bit down, which is what most network and video formats
+// use. If lsbFirst is true, bits fill each byte from the least significant bit up instead, like
+// DEFLATE.
+func NewBitWriter(b *ResizableBuffer, lsbFirst bool) *BitWriter {
+	return &BitWriter{b: b, lsbFirst: lsbFirst}
+}
+
+// WriteBits writes the low n bits of v. In MSB-first mode, the most significant of those bits
+// is written first. In LSB-first mode, the least significant is. n must be between 0 and 64.
+func (w *BitWriter) WriteBits(v uint64, n int) *BitWriter {
+	if n < 0 || n > 64 {
+		panic("safebuffer: bit count out of range")
+	}
+	for n > 0 {
+		take := min(8-w.n, n)
+		mask := uint64(1)<<take - 1
+		if w.lsbFirst {
+			w.acc |= byte(v&mask) << w.n
+			v >>= take
+		} else {
+			w.acc = w.acc<<take | byte(v>>(n-take)&mask)
+		}
+		w.n += take
+		n -= take
+		if w.n == 8 {
+			w.b.Byte(w.acc)
+			w.acc = 0
+			w.n = 0
+		}
+	}
+	return w
+}
+
+// WriteBit writes a single bit.
+func (w *BitWriter) WriteBit(bit bool) *BitWriter {
+	if bit {
+		return w.WriteBits(1, 1)
+	}
+	return w.WriteBits(0, 1)
+}
+
+// Align pads the current byte with zero bits and writes it to the buffer, if any bits are
+// waiting. After this, the buffer can be written to directly.
+func (w *BitWriter) Align() *BitWriter {
+	if w.n > 0 {
+		w.WriteBits(0, 8-w.n)
+	}
+	return w
+}
+
+// Buffered returns the number of bits waiting to be written to the buffer.
+func (w *BitWriter) Buffered() int {
+	return w.n
+}
+
+// Err returns the error held by the underlying buffer.
+func (w *BitWriter) Err() error {
+	return w.b.Err()
+}
+
+// BitReader reads values at bit granularity from a ReadableBuffer, in the same bit order as
+// the BitWriter that wrote them. Bytes are only taken from the ReadableBuffer as they are
+// needed, so after Align, the ReadableBuffer can be read from directly. This is single
+// threaded.
+type BitReader struct {
+	r        *ReadableBuffer
+	lsbFirst bool
+	acc      byte
+	n        int
+}
+
+// NewBitReader creates a new BitReader that reads from the buffer given. lsbFirst has the
+// same meaning as it does for NewBitWriter.
+func NewBitReader(r *ReadableBuffer, lsbFirst bool) *BitReader {
+	return &BitReader{r: r, lsbFirst: lsbFirst}
+}
+
+// ReadBits reads n bits and returns them in the low bits of the result. n must be between 0
+// and 64. If there are not enough bits left, ErrShortRead is returned and the read position
+// is not moved.
+func (r *BitReader) ReadBits(n int) (uint64, error) {
+	if n < 0 || n > 64 {
+		panic("safebuffer: bit count out of range")
+	}
+	if n > r.Remaining() {
+		return 0, ErrShortRead
+	}
+	var v uint64
+	shift := 0
+	for n > 0 {
+		if r.n == 0 {
+			// This cannot fail since the bits were counted above.
+			r.acc, _ = r.r.Byte()
+			r.n = 8
+		}
+		take := min(r.n, n)
+		mask := uint64(1)<<take - 1
+		if r.lsbFirst {
+			v |= uint64(r.acc) & mask << shift
+			r.acc >>= take
+			shift += take
+		} else {
+			v = v<<take | uint64(r.acc>>(8-take))&mask
+			r.acc <<= take
+		}
+		r.n -= take
+		n -= take
+	}
+	return v, nil
+}
+
+// ReadBit reads a single bit.
+func (r *BitReader) ReadBit() (bool, error) {
+	v, err := r.ReadBits(1)
+	return v == 1, err
+}
+
+// Align skips whatever is left of the current byte.
+func (r *BitReader) Align() {
+	r.acc = 0
+	r.n = 0
+}
+
+// Remaining returns the number of bits left to read.
+func (r *BitReader) Remaining() int {
+	return r.n + r.r.Len()*8
+}
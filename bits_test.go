@@ -0,0 +1,138 @@
+package safebuffer
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestBitWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		lsbFirst bool
+		fn       func(w *BitWriter)
+		eq       []byte
+	}{
+		{"msb first", false, func(w *BitWriter) { w.WriteBits(0b101, 3).WriteBits(0b11111, 5) }, []byte{0xbf}},
+		{"lsb first", true, func(w *BitWriter) { w.WriteBits(0b101, 3).WriteBits(0b11111, 5) }, []byte{0xfd}},
+		{"msb first across bytes", false, func(w *BitWriter) { w.WriteBits(0, 4).WriteBits(0xabc, 12) }, []byte{0x0a, 0xbc}},
+		{"lsb first across bytes", true, func(w *BitWriter) { w.WriteBits(0, 4).WriteBits(0xabc, 12) }, []byte{0xc0, 0xab}},
+		{"high bits ignored", false, func(w *BitWriter) { w.WriteBits(0xff, 4).WriteBits(0, 4) }, []byte{0xf0}},
+		{"64 bits", false, func(w *BitWriter) { w.WriteBit(true).WriteBits(1<<63, 64).Align() }, []byte{0xc0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"align msb first", false, func(w *BitWriter) { w.WriteBits(0b11, 2).Align() }, []byte{0xc0}},
+		{"align lsb first", true, func(w *BitWriter) { w.WriteBits(0b11, 2).Align() }, []byte{0x03}},
+		{"align when aligned", false, func(w *BitWriter) { w.WriteBits(1, 8).Align() }, []byte{1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rb := NewResizableBuffer(nil)
+			test.fn(NewBitWriter(rb, test.lsbFirst))
+			if !bytes.Equal(rb.Bytes(), test.eq) {
+				t.Fatalf("expected %x, got %x", test.eq, rb.Bytes())
+			}
+		})
+	}
+
+	t.Run("buffered", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		w := NewBitWriter(rb, false).WriteBits(1, 11)
+		if w.Buffered() != 3 || rb.Len() != 1 {
+			t.Fatalf("expected 3 bits buffered and 1 byte written, got %d and %d", w.Buffered(), rb.Len())
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(1)
+		w := NewBitWriter(rb, false).WriteBits(0xfff, 12).Align()
+		if w.Err() != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", w.Err())
+		}
+	})
+}
+
+func TestBitReader(t *testing.T) {
+	t.Run("known values", func(t *testing.T) {
+		r := NewBitReader(NewReadableBuffer([]byte{0xbf}), false)
+		a, _ := r.ReadBits(3)
+		b, _ := r.ReadBits(5)
+		if a != 0b101 || b != 0b11111 {
+			t.Fatalf("expected 101 and 11111, got %b and %b", a, b)
+		}
+		r = NewBitReader(NewReadableBuffer([]byte{0xc0, 0xab}), true)
+		a, _ = r.ReadBits(4)
+		b, _ = r.ReadBits(12)
+		if a != 0 || b != 0xabc {
+			t.Fatalf("expected 0 and abc, got %x and %x", a, b)
+		}
+	})
+
+	t.Run("short read", func(t *testing.T) {
+		r := NewBitReader(NewReadableBuffer([]byte{0xff, 0x80}), false)
+		if _, err := r.ReadBits(3); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if _, err := r.ReadBits(14); err != ErrShortRead {
+			t.Fatalf("expected ErrShortRead, got %v", err)
+		}
+		if r.Remaining() != 13 {
+			t.Fatalf("expected 13 bits left, got %d", r.Remaining())
+		}
+		v, err := r.ReadBits(6)
+		if err != nil || v != 0b111111 {
+			t.Fatalf("expected 111111, nil, got %b, %v", v, err)
+		}
+	})
+
+	for _, lsbFirst := range []bool{false, true} {
+		t.Run("round trip", func(t *testing.T) {
+			rng := rand.New(rand.NewSource(1))
+			type field struct {
+				v uint64
+				n int
+			}
+			fields := make([]field, 1000)
+			rb := NewResizableBuffer(nil)
+			w := NewBitWriter(rb, lsbFirst)
+			for i := range fields {
+				n := rng.Intn(65)
+				v := rng.Uint64()
+				if n < 64 {
+					v &= 1<<n - 1
+				}
+				fields[i] = field{v, n}
+				w.WriteBits(v, n)
+			}
+			w.Align()
+			r := NewBitReader(NewReadableBuffer(rb.Bytes()), lsbFirst)
+			for i, f := range fields {
+				v, err := r.ReadBits(f.n)
+				if err != nil || v != f.v {
+					t.Fatalf("lsb first %v, field %d: expected %x, nil, got %x, %v", lsbFirst, i, f.v, v, err)
+				}
+			}
+			if r.Remaining() >= 8 {
+				t.Fatalf("expected less than a byte left, got %d bits", r.Remaining())
+			}
+		})
+	}
+
+	t.Run("mixed with byte reads", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		w := NewBitWriter(rb, false).WriteBits(0b1, 1).WriteBits(0b10, 2).Align()
+		rb.Uint16(0x1234, false)
+		w.WriteBit(true).Align()
+
+		rd := NewReadableBuffer(rb.Bytes())
+		r := NewBitReader(rd, false)
+		if v, _ := r.ReadBits(3); v != 0b110 {
+			t.Fatalf("expected 110, got %b", v)
+		}
+		r.Align()
+		if v, err := rd.Uint16(false); err != nil || v != 0x1234 {
+			t.Fatalf("expected 1234, nil, got %x, %v", v, err)
+		}
+		if bit, err := r.ReadBit(); err != nil || !bit {
+			t.Fatalf("expected true, nil, got %v, %v", bit, err)
+		}
+	})
+}
@@ -0,0 +1,160 @@
+// Package cbor encodes CBOR (RFC 8949) into a safebuffer.ResizableBuffer and decodes it from a
+// byte slice. Integers, lengths and tags are always written in their shortest form. In
+// deterministic mode, the writer also sorts map keys, writes floats in the shortest form that
+// keeps their value and refuses indefinite-length items, following the core deterministic
+// encoding rules in section 4.2.1, so output is byte for byte reproducible.
+package cbor
+
+import (
+	"errors"
+	"math"
+)
+
+var (
+	// ErrTypeMismatch is returned when the next item is not of the type being read. The read
+	// position is not moved.
+	ErrTypeMismatch = errors.New("cbor: unexpected type")
+
+	// ErrOverflow is returned when an integer does not fit in the type being read.
+	ErrOverflow = errors.New("cbor: integer overflows the type being read")
+
+	// ErrInvalid is returned when the data is not well-formed CBOR, such as a reserved
+	// additional information value or a chunk of the wrong type in an indefinite-length string.
+	ErrInvalid = errors.New("cbor: invalid data")
+
+	// ErrIndefinite is held by a deterministic Writer after an indefinite-length item is
+	// started, since deterministic encoding does not allow them.
+	ErrIndefinite = errors.New("cbor: indefinite-length items are not allowed in deterministic mode")
+
+	// ErrDuplicateKey is held by a deterministic Writer after a map with two identical keys.
+	ErrDuplicateKey = errors.New("cbor: duplicate map key")
+
+	// ErrInvalidSimple is held by a Writer after a simple value in the reserved range 24 to 31.
+	ErrInvalidSimple = errors.New("cbor: reserved simple value")
+
+	// ErrInvalidCount is held by a Writer after an array or map header with a negative count,
+	// or a map with more pairs than can be counted.
+	ErrInvalidCount = errors.New("cbor: invalid array or map count")
+)
+
+// Major types from the specification.
+const (
+	majorUint   = 0
+	majorNegInt = 1
+	majorBytes  = 2
+	majorText   = 3
+	majorArray  = 4
+	majorMap    = 5
+	majorTag    = 6
+	majorSimple = 7
+)
+
+// Additional information values with special meanings.
+const (
+	aiOneByte    = 24
+	aiTwoBytes   = 25
+	aiFourBytes  = 26
+	aiEightBytes = 27
+	aiIndefinite = 31
+)
+
+// Simple values and the break stop code, as whole initial bytes.
+const (
+	byteFalse     = 0xf4
+	byteTrue      = 0xf5
+	byteNull      = 0xf6
+	byteUndefined = 0xf7
+	byteFloat16   = 0xf9
+	byteFloat32   = 0xfa
+	byteFloat64   = 0xfb
+	byteBreak     = 0xff
+)
+
+// Tags with built in support.
+const (
+	TagDateTimeString = 0
+	TagEpochDateTime  = 1
+	TagPositiveBignum = 2
+	TagNegativeBignum = 3
+)
+
+// Type is the kind of a CBOR data item.
+type Type int
+
+// The types of CBOR data item. Invalid is only returned alongside an error.
+const (
+	Invalid Type = iota
+	Uint
+	NegInt
+	Bytes
+	Text
+	Array
+	Map
+	Tag
+	Simple
+	Bool
+	Null
+	Undefined
+	Float
+	Break
+)
+
+// float16Bits returns v as a half precision float if it can be held exactly.
+func float16Bits(v float64) (uint16, bool) {
+	var sign uint16
+	if math.Signbit(v) {
+		sign = 0x8000
+	}
+	switch {
+	case math.IsNaN(v):
+		return 0x7e00, true
+	case math.IsInf(v, 0):
+		return sign | 0x7c00, true
+	case v == 0:
+		return sign, true
+	}
+	frac, exp := math.Frexp(math.Abs(v))
+	// v is frac * 2^exp with frac in [0.5, 1), so the half precision exponent is exp - 1.
+	var h uint16
+	if e := exp - 1; e >= -14 {
+		if e > 15 {
+			return 0, false
+		}
+		mant := (frac*2 - 1) * 1024
+		if mant != math.Trunc(mant) {
+			return 0, false
+		}
+		h = uint16(e+15)<<10 | uint16(mant)
+	} else {
+		// Subnormals are multiples of 2^-24.
+		mant := math.Ldexp(math.Abs(v), 24)
+		if mant != math.Trunc(mant) || mant >= 1024 {
+			return 0, false
+		}
+		h = uint16(mant)
+	}
+	return sign | h, true
+}
+
+// float16Value returns the value of a half precision float.
+func float16Value(h uint16) float64 {
+	exp := int(h >> 10 & 0x1f)
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 0x1f:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		v = -v
+	}
+	return v
+}
@@ -0,0 +1,509 @@
+package cbor
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// diag reads the next item and describes it in something close to the diagnostic notation
+// from section 8 of RFC 8949. Indefinite-length strings are shown joined.
+func diag(r *Reader) (string, error) {
+	typ, err := r.Peek()
+	if err != nil {
+		return "", err
+	}
+	switch typ {
+	case Uint, NegInt:
+		v, err := r.ReadBigInt()
+		if err != nil {
+			return "", err
+		}
+		return v.String(), nil
+	case Bytes:
+		p, err := r.ReadBytes()
+		return "h'" + hex.EncodeToString(p) + "'", err
+	case Text:
+		s, err := r.ReadText()
+		return strconv.Quote(s), err
+	case Array, Map:
+		var n int
+		if typ == Array {
+			n, err = r.ReadArrayHeader()
+		} else {
+			n, err = r.ReadMapHeader()
+		}
+		if err != nil {
+			return "", err
+		}
+		var items []string
+		for i := 0; n < 0 && !r.AtBreak() || i < n; i++ {
+			s, err := diag(r)
+			if err != nil {
+				return "", err
+			}
+			if typ == Map {
+				v, err := diag(r)
+				if err != nil {
+					return "", err
+				}
+				s += ": " + v
+			}
+			items = append(items, s)
+		}
+		open, close := "[", "]"
+		if typ == Map {
+			open, close = "{", "}"
+		}
+		if n < 0 {
+			if err := r.ReadBreak(); err != nil {
+				return "", err
+			}
+			open += "_ "
+		}
+		return open + strings.Join(items, ", ") + close, nil
+	case Tag:
+		saved := *r
+		tag, _ := r.ReadTag()
+		if tag == TagPositiveBignum || tag == TagNegativeBignum {
+			*r = saved
+			v, err := r.ReadBigInt()
+			if err != nil {
+				return "", err
+			}
+			return v.String(), nil
+		}
+		s, err := diag(r)
+		return fmt.Sprintf("%d(%s)", tag, s), err
+	case Float:
+		f, err := r.ReadFloat()
+		switch {
+		case math.IsNaN(f):
+			return "NaN", err
+		case math.IsInf(f, 1):
+			return "Infinity", err
+		case math.IsInf(f, -1):
+			return "-Infinity", err
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64), err
+	case Bool:
+		v, err := r.ReadBool()
+		return strconv.FormatBool(v), err
+	case Null:
+		return "null", r.ReadNull()
+	case Undefined:
+		return "undefined", r.ReadUndefined()
+	case Simple:
+		v, err := r.ReadSimple()
+		return fmt.Sprintf("simple(%d)", v), err
+	}
+	return "", fmt.Errorf("unexpected %v", typ)
+}
+
+func bigInt(s string) *big.Int {
+	v, _ := new(big.Int).SetString(s, 10)
+	return v
+}
+
+// appendixA holds the examples from RFC 8949 Appendix A. Items that are not written in
+// preferred serialization, or that use indefinite lengths, are written outside of
+// deterministic mode. Items with no write function are only decoded.
+var appendixA = []struct {
+	hex           string
+	diag          string
+	deterministic bool
+	write         func(w *Writer)
+}{
+	{"00", "0", true, func(w *Writer) { w.Uint(0) }},
+	{"01", "1", true, func(w *Writer) { w.Uint(1) }},
+	{"0a", "10", true, func(w *Writer) { w.Uint(10) }},
+	{"17", "23", true, func(w *Writer) { w.Uint(23) }},
+	{"1818", "24", true, func(w *Writer) { w.Uint(24) }},
+	{"1819", "25", true, func(w *Writer) { w.Uint(25) }},
+	{"1864", "100", true, func(w *Writer) { w.Int(100) }},
+	{"1903e8", "1000", true, func(w *Writer) { w.Int(1000) }},
+	{"1a000f4240", "1000000", true, func(w *Writer) { w.Int(1000000) }},
+	{"1b000000e8d4a51000", "1000000000000", true, func(w *Writer) { w.Int(1000000000000) }},
+	{"1bffffffffffffffff", "18446744073709551615", true, func(w *Writer) { w.Uint(math.MaxUint64) }},
+	{"c249010000000000000000", "18446744073709551616", true, func(w *Writer) { w.BigInt(bigInt("18446744073709551616")) }},
+	{"3bffffffffffffffff", "-18446744073709551616", true, func(w *Writer) { w.BigInt(bigInt("-18446744073709551616")) }},
+	{"c349010000000000000000", "-18446744073709551617", true, func(w *Writer) { w.BigInt(bigInt("-18446744073709551617")) }},
+	{"20", "-1", true, func(w *Writer) { w.Int(-1) }},
+	{"29", "-10", true, func(w *Writer) { w.Int(-10) }},
+	{"3863", "-100", true, func(w *Writer) { w.Int(-100) }},
+	{"3903e7", "-1000", true, func(w *Writer) { w.BigInt(big.NewInt(-1000)) }},
+	{"f90000", "0", true, func(w *Writer) { w.Float64(0) }},
+	{"f98000", "-0", true, func(w *Writer) { w.Float64(math.Copysign(0, -1)) }},
+	{"f93c00", "1", true, func(w *Writer) { w.Float64(1) }},
+	{"fb3ff199999999999a", "1.1", true, func(w *Writer) { w.Float64(1.1) }},
+	{"f93e00", "1.5", true, func(w *Writer) { w.Float64(1.5) }},
+	{"f97bff", "65504", true, func(w *Writer) { w.Float64(65504) }},
+	{"fa47c35000", "100000", true, func(w *Writer) { w.Float64(100000) }},
+	{"fa7f7fffff", "3.4028234663852886e+38", true, func(w *Writer) { w.Float64(3.4028234663852886e+38) }},
+	{"fb7e37e43c8800759c", "1e+300", true, func(w *Writer) { w.Float64(1.0e+300) }},
+	{"f90001", "5.960464477539063e-08", true, func(w *Writer) { w.Float64(5.960464477539063e-8) }},
+	{"f90400", "6.103515625e-05", true, func(w *Writer) { w.Float32(0.00006103515625) }},
+	{"f9c400", "-4", true, func(w *Writer) { w.Float64(-4) }},
+	{"fbc010666666666666", "-4.1", true, func(w *Writer) { w.Float64(-4.1) }},
+	{"f97c00", "Infinity", true, func(w *Writer) { w.Float64(math.Inf(1)) }},
+	{"f97e00", "NaN", true, func(w *Writer) { w.Float64(math.NaN()) }},
+	{"f9fc00", "-Infinity", true, func(w *Writer) { w.Float64(math.Inf(-1)) }},
+	{"fa7f800000", "Infinity", false, func(w *Writer) { w.Float32(float32(math.Inf(1))) }},
+	{"fa7fc00000", "NaN", false, nil},
+	{"faff800000", "-Infinity", false, func(w *Writer) { w.Float32(float32(math.Inf(-1))) }},
+	{"fb7ff0000000000000", "Infinity", false, func(w *Writer) { w.Float64(math.Inf(1)) }},
+	{"fb7ff8000000000000", "NaN", false, nil},
+	{"fbfff0000000000000", "-Infinity", false, func(w *Writer) { w.Float64(math.Inf(-1)) }},
+	{"f4", "false", true, func(w *Writer) { w.Bool(false) }},
+	{"f5", "true", true, func(w *Writer) { w.Bool(true) }},
+	{"f6", "null", true, func(w *Writer) { w.Null() }},
+	{"f7", "undefined", true, func(w *Writer) { w.Undefined() }},
+	{"f0", "simple(16)", true, func(w *Writer) { w.Simple(16) }},
+	{"f8ff", "simple(255)", true, func(w *Writer) { w.Simple(255) }},
+	{
+		"c074323031332d30332d32315432303a30343a30305a", `0("2013-03-21T20:04:00Z")`, true,
+		func(w *Writer) { w.TimeString(time.Date(2013, 3, 21, 20, 4, 0, 0, time.UTC)) },
+	},
+	{"c11a514b67b0", "1(1363896240)", true, func(w *Writer) { w.Time(time.Unix(1363896240, 0)) }},
+	{"c1fb41d452d9ec200000", "1(1.3638962405e+09)", true, func(w *Writer) { w.Time(time.Unix(1363896240, 500000000)) }},
+	{"d74401020304", "23(h'01020304')", true, func(w *Writer) { w.Tag(23).Bytes([]byte{1, 2, 3, 4}) }},
+	{"d818456449455446", "24(h'6449455446')", true, func(w *Writer) { w.Tag(24).Bytes([]byte("dIETF")) }},
+	{
+		"d82076687474703a2f2f7777772e6578616d706c652e636f6d", `32("http://www.example.com")`, true,
+		func(w *Writer) { w.Tag(32).Text("http://www.example.com") },
+	},
+	{"40", "h''", true, func(w *Writer) { w.Bytes(nil) }},
+	{"4401020304", "h'01020304'", true, func(w *Writer) { w.Bytes([]byte{1, 2, 3, 4}) }},
+	{"60", `""`, true, func(w *Writer) { w.Text("") }},
+	{"6161", `"a"`, true, func(w *Writer) { w.Text("a") }},
+	{"6449455446", `"IETF"`, true, func(w *Writer) { w.Text("IETF") }},
+	{"62225c", `"\"\\"`, true, func(w *Writer) { w.Text(`"\`) }},
+	{"62c3bc", `"ü"`, true, func(w *Writer) { w.Text("ü") }},
+	{"63e6b0b4", `"水"`, true, func(w *Writer) { w.Text("水") }},
+	{"64f0908591", `"𐅑"`, true, func(w *Writer) { w.Text("\U00010151") }},
+	{"80", "[]", true, func(w *Writer) { w.ArrayHeader(0) }},
+	{"83010203", "[1, 2, 3]", true, func(w *Writer) { w.ArrayHeader(3).Int(1).Int(2).Int(3) }},
+	{
+		"8301820203820405", "[1, [2, 3], [4, 5]]", true,
+		func(w *Writer) { w.ArrayHeader(3).Int(1).ArrayHeader(2).Int(2).Int(3).ArrayHeader(2).Int(4).Int(5) },
+	},
+	{
+		"98190102030405060708090a0b0c0d0e0f101112131415161718181819",
+		"[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25]", true,
+		func(w *Writer) {
+			w.ArrayHeader(25)
+			for i := int64(1); i <= 25; i++ {
+				w.Int(i)
+			}
+		},
+	},
+	{"a0", "{}", true, func(w *Writer) { w.MapHeader(0) }},
+	{"a201020304", "{1: 2, 3: 4}", true, func(w *Writer) { w.MapHeader(2).Int(3).Int(4).Int(1).Int(2) }},
+	{
+		"a26161016162820203", `{"a": 1, "b": [2, 3]}`, true,
+		func(w *Writer) { w.MapHeader(2).Text("b").ArrayHeader(2).Int(2).Int(3).Text("a").Int(1) },
+	},
+	{"826161a161626163", `["a", {"b": "c"}]`, true, func(w *Writer) { w.ArrayHeader(2).Text("a").MapHeader(1).Text("b").Text("c") }},
+	{
+		"a56161614161626142616361436164614461656145", `{"a": "A", "b": "B", "c": "C", "d": "D", "e": "E"}`, true,
+		func(w *Writer) {
+			w.MapHeader(5)
+			for _, k := range "edcba" {
+				w.Text(string(k)).Text(strings.ToUpper(string(k)))
+			}
+		},
+	},
+	{"5f42010243030405ff", "h'0102030405'", false, func(w *Writer) { w.BeginBytes().Bytes([]byte{1, 2}).Bytes([]byte{3, 4, 5}).Break() }},
+	{"7f657374726561646d696e67ff", `"streaming"`, false, func(w *Writer) { w.BeginText().Text("strea").Text("ming").Break() }},
+	{"9fff", "[_ ]", false, func(w *Writer) { w.BeginArray().Break() }},
+	{
+		"9f018202039f0405ffff", "[_ 1, [2, 3], [_ 4, 5]]", false,
+		func(w *Writer) {
+			w.BeginArray().Int(1).ArrayHeader(2).Int(2).Int(3).BeginArray().Int(4).Int(5).Break().Break()
+		},
+	},
+	{
+		"9f01820203820405ff", "[_ 1, [2, 3], [4, 5]]", false,
+		func(w *Writer) {
+			w.BeginArray().Int(1).ArrayHeader(2).Int(2).Int(3).ArrayHeader(2).Int(4).Int(5).Break()
+		},
+	},
+	{
+		"83018202039f0405ff", "[1, [2, 3], [_ 4, 5]]", false,
+		func(w *Writer) {
+			w.ArrayHeader(3).Int(1).ArrayHeader(2).Int(2).Int(3).BeginArray().Int(4).Int(5).Break()
+		},
+	},
+	{
+		"83019f0203ff820405", "[1, [_ 2, 3], [4, 5]]", false,
+		func(w *Writer) {
+			w.ArrayHeader(3).Int(1).BeginArray().Int(2).Int(3).Break().ArrayHeader(2).Int(4).Int(5)
+		},
+	},
+	{
+		"9f0102030405060708090a0b0c0d0e0f101112131415161718181819ff",
+		"[_ 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25]", false,
+		func(w *Writer) {
+			w.BeginArray()
+			for i := int64(1); i <= 25; i++ {
+				w.Int(i)
+			}
+			w.Break()
+		},
+	},
+	{
+		"bf61610161629f0203ffff", `{_ "a": 1, "b": [_ 2, 3]}`, false,
+		func(w *Writer) { w.BeginMap().Text("a").Int(1).Text("b").BeginArray().Int(2).Int(3).Break().Break() },
+	},
+	{"826161bf61626163ff", `["a", {_ "b": "c"}]`, false, func(w *Writer) { w.ArrayHeader(2).Text("a").BeginMap().Text("b").Text("c").Break() }},
+	{
+		"bf6346756ef563416d7421ff", `{_ "Fun": true, "Amt": -2}`, false,
+		func(w *Writer) { w.BeginMap().Text("Fun").Bool(true).Text("Amt").Int(-2).Break() },
+	},
+}
+
+func TestAppendixA(t *testing.T) {
+	for _, test := range appendixA {
+		t.Run(test.hex, func(t *testing.T) {
+			data, _ := hex.DecodeString(test.hex)
+
+			r := NewReader(data)
+			s, err := diag(r)
+			if err != nil {
+				t.Fatalf("expected nil error decoding, got %v", err)
+			}
+			if s != test.diag {
+				t.Fatalf("expected %s, got %s", test.diag, s)
+			}
+			if r.Len() != 0 {
+				t.Fatalf("expected everything to be read, %d bytes left", r.Len())
+			}
+
+			r = NewReader(data)
+			if err := r.Skip(); err != nil || r.Len() != 0 {
+				t.Fatalf("expected Skip to read everything, got %v with %d bytes left", err, r.Len())
+			}
+
+			if test.write == nil {
+				return
+			}
+			b := safebuffer.NewResizableBuffer(nil)
+			w := NewWriter(b, test.deterministic)
+			test.write(w)
+			if w.Err() != nil {
+				t.Fatalf("expected nil error encoding, got %v", w.Err())
+			}
+			if w.Depth() != 0 {
+				t.Fatalf("expected every item to be complete, %d still open", w.Depth())
+			}
+			if got := hex.EncodeToString(b.Bytes()); got != test.hex {
+				t.Fatalf("expected %s, got %s", test.hex, got)
+			}
+		})
+	}
+}
+
+func TestDeterministicMapOrder(t *testing.T) {
+	// The example from section 4.2.1.
+	b := safebuffer.NewResizableBuffer(nil)
+	w := NewWriter(b, true).MapHeader(8).
+		Bool(false).Int(0).
+		ArrayHeader(1).Int(-1).Int(0).
+		ArrayHeader(1).Int(100).Int(0).
+		Text("aa").Int(0).
+		Text("z").Int(0).
+		Int(-1).Int(0).
+		Int(100).Int(0).
+		Int(10).Int(0)
+	if w.Err() != nil {
+		t.Fatalf("expected nil error, got %v", w.Err())
+	}
+	s, err := diag(NewReader(b.Bytes()))
+	expected := `{10: 0, 100: 0, -1: 0, "z": 0, "aa": 0, [100]: 0, [-1]: 0, false: 0}`
+	if err != nil || s != expected {
+		t.Fatalf("expected %s, got %s, %v", expected, s, err)
+	}
+
+	t.Run("nested", func(t *testing.T) {
+		b := safebuffer.NewResizableBuffer(nil).CopyString("prefix")
+		NewWriter(b, true).ArrayHeader(2).
+			MapHeader(2).Text("y").MapHeader(2).Int(2).Null().Int(1).Null().Text("x").Int(0).
+			MapHeader(1).Int(0).Int(0)
+		s, err := diag(NewReader(b.Bytes()[6:]))
+		expected := `[{"x": 0, "y": {1: null, 2: null}}, {0: 0}]`
+		if err != nil || s != expected {
+			t.Fatalf("expected %s, got %s, %v", expected, s, err)
+		}
+	})
+
+	t.Run("duplicate key", func(t *testing.T) {
+		w := NewWriter(safebuffer.NewResizableBuffer(nil), true).MapHeader(2).Text("a").Int(1).Text("a").Int(2)
+		if w.Err() != ErrDuplicateKey {
+			t.Fatalf("expected ErrDuplicateKey, got %v", w.Err())
+		}
+	})
+
+	t.Run("not sorted otherwise", func(t *testing.T) {
+		b := safebuffer.NewResizableBuffer(nil)
+		NewWriter(b, false).MapHeader(2).Int(3).Int(4).Int(1).Int(2)
+		if hex.EncodeToString(b.Bytes()) != "a203040102" {
+			t.Fatalf("expected keys to be kept in order, got %x", b.Bytes())
+		}
+	})
+}
+
+func TestWriterErrors(t *testing.T) {
+	t.Run("indefinite in deterministic mode", func(t *testing.T) {
+		b := safebuffer.NewResizableBuffer(nil)
+		w := NewWriter(b, true).BeginArray().Int(1).Break()
+		if w.Err() != ErrIndefinite || b.Len() != 0 {
+			t.Fatalf("expected ErrIndefinite and nothing written, got %v and %d bytes", w.Err(), b.Len())
+		}
+	})
+
+	t.Run("reserved simple value", func(t *testing.T) {
+		w := NewWriter(safebuffer.NewResizableBuffer(nil), false).Simple(24)
+		if w.Err() != ErrInvalidSimple {
+			t.Fatalf("expected ErrInvalidSimple, got %v", w.Err())
+		}
+	})
+
+	t.Run("invalid count", func(t *testing.T) {
+		headers := []func(w *Writer) *Writer{
+			func(w *Writer) *Writer { return w.ArrayHeader(-1) },
+			func(w *Writer) *Writer { return w.MapHeader(-1) },
+			func(w *Writer) *Writer { return w.MapHeader(math.MaxInt/2 + 1) },
+		}
+		for _, header := range headers {
+			b := safebuffer.NewResizableBuffer(nil)
+			w := header(NewWriter(b, false)).Int(1)
+			if w.Err() != ErrInvalidCount || b.Len() != 0 {
+				t.Fatalf("expected ErrInvalidCount and nothing written, got %v and %d bytes", w.Err(), b.Len())
+			}
+		}
+	})
+
+	t.Run("buffer error", func(t *testing.T) {
+		w := NewWriter(safebuffer.NewResizableBuffer(nil).WithMaxSize(4), true).MapHeader(1).Text("long key").Int(1)
+		if w.Err() != safebuffer.ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", w.Err())
+		}
+	})
+
+	panics := []struct {
+		name string
+		fn   func(w *Writer)
+	}{
+		{"break without indefinite", func(w *Writer) { w.ArrayHeader(1).Break() }},
+		{"break on map with key only", func(w *Writer) { w.BeginMap().Int(1).Break() }},
+		{"number in byte string", func(w *Writer) { w.BeginBytes().Int(1) }},
+		{"text in byte string", func(w *Writer) { w.BeginBytes().Text("a") }},
+		{"nested indefinite string", func(w *Writer) { w.BeginText().BeginText() }},
+	}
+	for _, test := range panics {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+			test.fn(NewWriter(safebuffer.NewResizableBuffer(nil), false))
+		})
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		hex  string
+		fn   func(r *Reader) error
+		err  error
+	}{
+		{"empty", "", func(r *Reader) error { _, err := r.ReadUint(); return err }, safebuffer.ErrShortRead},
+		{"short argument", "19ff", func(r *Reader) error { _, err := r.ReadUint(); return err }, safebuffer.ErrShortRead},
+		{"reserved additional information", "1c", func(r *Reader) error { _, err := r.ReadUint(); return err }, ErrInvalid},
+		{"indefinite integer", "1f", func(r *Reader) error { return r.Skip() }, ErrInvalid},
+		{"negative as uint", "20", func(r *Reader) error { _, err := r.ReadUint(); return err }, ErrTypeMismatch},
+		{"int overflow", "1bffffffffffffffff", func(r *Reader) error { _, err := r.ReadInt(); return err }, ErrOverflow},
+		{"text as bytes", "6161", func(r *Reader) error { _, err := r.ReadBytes(); return err }, ErrTypeMismatch},
+		{"bad utf-8", "61ff", func(r *Reader) error { _, err := r.ReadText(); return err }, ErrInvalid},
+		{"wrong chunk type", "5f6161ff", func(r *Reader) error { _, err := r.ReadBytes(); return err }, ErrInvalid},
+		{"nested indefinite chunk", "5f5fffff", func(r *Reader) error { _, err := r.ReadBytes(); return err }, ErrInvalid},
+		{"unterminated indefinite string", "5f4101", func(r *Reader) error { _, err := r.ReadBytes(); return err }, safebuffer.ErrShortRead},
+		{"unterminated indefinite array", "9f01", func(r *Reader) error { return r.Skip() }, safebuffer.ErrShortRead},
+		{"short array", "8301", func(r *Reader) error { return r.Skip() }, safebuffer.ErrShortRead},
+		{"huge map", "bbffffffffffffffff", func(r *Reader) error { return r.Skip() }, safebuffer.ErrShortRead},
+		{"indefinite map with key only", "bf01ff", func(r *Reader) error { return r.Skip() }, ErrInvalid},
+		{"lone break", "ff", func(r *Reader) error { return r.Skip() }, ErrInvalid},
+		{"reserved simple value", "f818", func(r *Reader) error { _, err := r.ReadSimple(); return err }, ErrInvalid},
+		{"float as int", "f93c00", func(r *Reader) error { _, err := r.ReadInt(); return err }, ErrTypeMismatch},
+		{"bad time tag", "c201", func(r *Reader) error { _, err := r.ReadTime(); return err }, ErrTypeMismatch},
+		{"bad time string", "c06161", func(r *Reader) error { _, err := r.ReadTime(); return err }, ErrInvalid},
+		{"deep nesting", strings.Repeat("81", maxSkipDepth+2) + "00", func(r *Reader) error { return r.Skip() }, ErrInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, _ := hex.DecodeString(test.hex)
+			r := NewReader(data)
+			if err := test.fn(r); err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if r.Offset() != 0 {
+				t.Fatalf("expected the read position not to move, got %d", r.Offset())
+			}
+		})
+	}
+}
+
+func TestTimeRoundTrip(t *testing.T) {
+	times := []time.Time{
+		time.Unix(0, 0),
+		time.Unix(1363896240, 0),
+		time.Unix(1363896240, 500000000),
+		time.Unix(-1000, 250000000),
+	}
+	for _, ts := range times {
+		for _, asString := range []bool{false, true} {
+			b := safebuffer.NewResizableBuffer(nil)
+			w := NewWriter(b, true)
+			if asString {
+				w.TimeString(ts)
+			} else {
+				w.Time(ts)
+			}
+			v, err := NewReader(b.Bytes()).ReadTime()
+			if err != nil || !v.Equal(ts) {
+				t.Fatalf("string %v: expected %v, got %v, %v", asString, ts, v, err)
+			}
+		}
+	}
+}
+
+func TestFloat16(t *testing.T) {
+	// Every half precision value must survive a round trip through float64.
+	for h := 0; h < 1<<16; h++ {
+		v := float16Value(uint16(h))
+		got, ok := float16Bits(v)
+		if math.IsNaN(v) {
+			if got != 0x7e00 {
+				t.Fatalf("%04x: expected NaN to be canonical, got %04x", h, got)
+			}
+			continue
+		}
+		if !ok || got != uint16(h) {
+			t.Fatalf("%04x: expected a round trip, got %04x, %v", h, got, ok)
+		}
+	}
+	for _, v := range []float64{65520, 1.0 / (1 << 25), 1.0009765625 + 1.0/(1<<11), 1e-10} {
+		if _, ok := float16Bits(v); ok {
+			t.Fatalf("expected %v not to fit in half precision", v)
+		}
+	}
+}
@@ -0,0 +1,516 @@
+package cbor
+
+import (
+	"encoding/binary"
+	"math"
+	"math/big"
+	"time"
+	"unicode/utf8"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// Reader decodes CBOR data items from a byte slice. Definite-length strings can be read as
+// views into the slice, so nothing is copied or allocated. A read that fails does not move the
+// read position. This is single threaded.
+type Reader struct {
+	p   []byte
+	off int
+}
+
+// NewReader creates a new Reader over the slice given. The slice is not copied, so if it came
+// from ResizableBuffer.Bytes, it is only valid until the next call to Reset.
+func NewReader(p []byte) *Reader {
+	return &Reader{p: p}
+}
+
+// Offset returns the number of bytes that have been read.
+func (r *Reader) Offset() int {
+	return r.off
+}
+
+// Len returns the number of bytes left to read.
+func (r *Reader) Len() int {
+	return len(r.p) - r.off
+}
+
+// cursor reads from the data after the read position. Reads only move the reader once they
+// have fully succeeded, by calling done.
+type cursor struct {
+	p   []byte
+	off int
+}
+
+func (r *Reader) cursor() cursor {
+	return cursor{p: r.p[r.off:]}
+}
+
+func (r *Reader) done(c cursor) {
+	r.off += c.off
+}
+
+func (c *cursor) next(n uint64) ([]byte, error) {
+	if uint64(len(c.p)-c.off) < n {
+		return nil, safebuffer.ErrShortRead
+	}
+	s := c.p[c.off : c.off+int(n)]
+	c.off += int(n)
+	return s, nil
+}
+
+// head reads the initial byte and argument of an item. For indefinite-length items and the
+// break stop code, indefinite is set and arg is 0. For floats, arg holds the raw bits.
+func (c *cursor) head() (major byte, ai byte, arg uint64, err error) {
+	s, err := c.next(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	major, ai = s[0]>>5, s[0]&0x1f
+	switch {
+	case ai < aiOneByte:
+		return major, ai, uint64(ai), nil
+	case ai <= aiEightBytes:
+		s, err := c.next(1 << (ai - aiOneByte))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		switch ai {
+		case aiOneByte:
+			arg = uint64(s[0])
+		case aiTwoBytes:
+			arg = uint64(binary.BigEndian.Uint16(s))
+		case aiFourBytes:
+			arg = uint64(binary.BigEndian.Uint32(s))
+		default:
+			arg = binary.BigEndian.Uint64(s)
+		}
+		return major, ai, arg, nil
+	case ai == aiIndefinite:
+		switch major {
+		case majorBytes, majorText, majorArray, majorMap, majorSimple:
+			return major, ai, 0, nil
+		}
+	}
+	return 0, 0, 0, ErrInvalid
+}
+
+// peekHead reads the head of the next item without moving the read position.
+func (r *Reader) peekHead() (major byte, ai byte, arg uint64, err error) {
+	c := r.cursor()
+	return c.head()
+}
+
+// Peek returns the type of the next item without reading it.
+func (r *Reader) Peek() (Type, error) {
+	major, ai, arg, err := r.peekHead()
+	if err != nil {
+		return Invalid, err
+	}
+	switch major {
+	case majorUint:
+		return Uint, nil
+	case majorNegInt:
+		return NegInt, nil
+	case majorBytes:
+		return Bytes, nil
+	case majorText:
+		return Text, nil
+	case majorArray:
+		return Array, nil
+	case majorMap:
+		return Map, nil
+	case majorTag:
+		return Tag, nil
+	}
+	switch {
+	case ai == aiIndefinite:
+		return Break, nil
+	case ai >= aiTwoBytes:
+		return Float, nil
+	case arg == byteFalse&0x1f || arg == byteTrue&0x1f:
+		return Bool, nil
+	case arg == byteNull&0x1f:
+		return Null, nil
+	case arg == byteUndefined&0x1f:
+		return Undefined, nil
+	}
+	return Simple, nil
+}
+
+// ReadUint reads an unsigned integer.
+func (r *Reader) ReadUint() (uint64, error) {
+	c := r.cursor()
+	major, _, arg, err := c.head()
+	if err != nil {
+		return 0, err
+	}
+	if major != majorUint {
+		return 0, ErrTypeMismatch
+	}
+	r.done(c)
+	return arg, nil
+}
+
+// ReadInt reads an integer of either sign as an int64.
+func (r *Reader) ReadInt() (int64, error) {
+	c := r.cursor()
+	major, _, arg, err := c.head()
+	if err != nil {
+		return 0, err
+	}
+	if major != majorUint && major != majorNegInt {
+		return 0, ErrTypeMismatch
+	}
+	if arg > math.MaxInt64 {
+		return 0, ErrOverflow
+	}
+	r.done(c)
+	if major == majorNegInt {
+		return -1 - int64(arg), nil
+	}
+	return int64(arg), nil
+}
+
+// ReadBigInt reads an integer of any size, either as a major type 0 or 1 integer or as a
+// bignum.
+func (r *Reader) ReadBigInt() (*big.Int, error) {
+	c := r.cursor()
+	major, _, arg, err := c.head()
+	if err != nil {
+		return nil, err
+	}
+	var v *big.Int
+	switch {
+	case major == majorUint || major == majorNegInt:
+		v = new(big.Int).SetUint64(arg)
+	case major == majorTag && (arg == TagPositiveBignum || arg == TagNegativeBignum):
+		s, err := c.str(majorBytes)
+		if err != nil {
+			return nil, err
+		}
+		v = new(big.Int).SetBytes(s)
+		if arg == TagNegativeBignum {
+			major = majorNegInt
+		}
+	default:
+		return nil, ErrTypeMismatch
+	}
+	if major == majorNegInt {
+		v.Sub(big.NewInt(-1), v)
+	}
+	r.done(c)
+	return v, nil
+}
+
+// str reads a string of the major type given, joining the chunks of an indefinite-length
+// string into a new slice.
+func (c *cursor) str(want byte) ([]byte, error) {
+	major, ai, arg, err := c.head()
+	if err != nil {
+		return nil, err
+	}
+	if major != want {
+		return nil, ErrTypeMismatch
+	}
+	if ai != aiIndefinite {
+		return c.next(arg)
+	}
+	joined := []byte{}
+	for {
+		if c.off < len(c.p) && c.p[c.off] == byteBreak {
+			c.off++
+			return joined, nil
+		}
+		major, ai, arg, err := c.head()
+		if err != nil {
+			return nil, err
+		}
+		if major != want || ai == aiIndefinite {
+			return nil, ErrInvalid
+		}
+		s, err := c.next(arg)
+		if err != nil {
+			return nil, err
+		}
+		joined = append(joined, s...)
+	}
+}
+
+// ReadBytes reads a byte string. For definite-length strings, this is a view into the data
+// being read. The chunks of an indefinite-length string are joined into a new slice.
+func (r *Reader) ReadBytes() ([]byte, error) {
+	c := r.cursor()
+	s, err := c.str(majorBytes)
+	if err != nil {
+		return nil, err
+	}
+	r.done(c)
+	return s, nil
+}
+
+// ReadTextBytes reads a text string the same way ReadBytes reads a byte string. The text must
+// be valid UTF-8.
+func (r *Reader) ReadTextBytes() ([]byte, error) {
+	c := r.cursor()
+	s, err := c.str(majorText)
+	if err != nil {
+		return nil, err
+	}
+	if !utf8.Valid(s) {
+		return nil, ErrInvalid
+	}
+	r.done(c)
+	return s, nil
+}
+
+// ReadText reads a text string.
+func (r *Reader) ReadText() (string, error) {
+	s, err := r.ReadTextBytes()
+	return string(s), err
+}
+
+// header reads the head of an array or map.
+func (r *Reader) header(want byte) (int, error) {
+	c := r.cursor()
+	major, ai, arg, err := c.head()
+	if err != nil {
+		return 0, err
+	}
+	if major != want {
+		return 0, ErrTypeMismatch
+	}
+	if ai == aiIndefinite {
+		r.done(c)
+		return -1, nil
+	}
+	if arg > math.MaxInt32 {
+		return 0, ErrOverflow
+	}
+	r.done(c)
+	return int(arg), nil
+}
+
+// ReadArrayHeader reads the head of an array and returns the number of items in it, or -1 if
+// it is indefinite-length. Indefinite-length arrays end with a break, which can be found with
+// AtBreak and read with ReadBreak.
+func (r *Reader) ReadArrayHeader() (int, error) {
+	return r.header(majorArray)
+}
+
+// ReadMapHeader reads the head of a map and returns the number of pairs in it, or -1 if it is
+// indefinite-length.
+func (r *Reader) ReadMapHeader() (int, error) {
+	return r.header(majorMap)
+}
+
+// AtBreak reports whether the next byte is the break stop code.
+func (r *Reader) AtBreak() bool {
+	return r.off < len(r.p) && r.p[r.off] == byteBreak
+}
+
+// ReadBreak reads the break stop code that ends an indefinite-length item.
+func (r *Reader) ReadBreak() error {
+	if r.off >= len(r.p) {
+		return safebuffer.ErrShortRead
+	}
+	if !r.AtBreak() {
+		return ErrTypeMismatch
+	}
+	r.off++
+	return nil
+}
+
+// ReadTag reads a tag. The item it applies to follows it.
+func (r *Reader) ReadTag() (uint64, error) {
+	c := r.cursor()
+	major, _, arg, err := c.head()
+	if err != nil {
+		return 0, err
+	}
+	if major != majorTag {
+		return 0, ErrTypeMismatch
+	}
+	r.done(c)
+	return arg, nil
+}
+
+// simple reads the initial byte given.
+func (r *Reader) simple(b byte) error {
+	if r.off >= len(r.p) {
+		return safebuffer.ErrShortRead
+	}
+	if r.p[r.off] != b {
+		return ErrTypeMismatch
+	}
+	r.off++
+	return nil
+}
+
+// ReadBool reads a boolean.
+func (r *Reader) ReadBool() (bool, error) {
+	if err := r.simple(byteTrue); err != ErrTypeMismatch {
+		return err == nil, err
+	}
+	return false, r.simple(byteFalse)
+}
+
+// ReadNull reads null.
+func (r *Reader) ReadNull() error {
+	return r.simple(byteNull)
+}
+
+// ReadUndefined reads undefined.
+func (r *Reader) ReadUndefined() error {
+	return r.simple(byteUndefined)
+}
+
+// ReadSimple reads a simple value, including false, true, null and undefined.
+func (r *Reader) ReadSimple() (uint8, error) {
+	c := r.cursor()
+	major, ai, arg, err := c.head()
+	if err != nil {
+		return 0, err
+	}
+	if major != majorSimple || ai > aiOneByte {
+		return 0, ErrTypeMismatch
+	}
+	if ai == aiOneByte && arg < 32 {
+		return 0, ErrInvalid
+	}
+	r.done(c)
+	return uint8(arg), nil
+}
+
+// ReadFloat reads a float of any precision as a float64.
+func (r *Reader) ReadFloat() (float64, error) {
+	c := r.cursor()
+	major, ai, arg, err := c.head()
+	if err != nil {
+		return 0, err
+	}
+	if major != majorSimple {
+		return 0, ErrTypeMismatch
+	}
+	var v float64
+	switch ai {
+	case aiTwoBytes:
+		v = float16Value(uint16(arg))
+	case aiFourBytes:
+		v = float64(math.Float32frombits(uint32(arg)))
+	case aiEightBytes:
+		v = math.Float64frombits(arg)
+	default:
+		return 0, ErrTypeMismatch
+	}
+	r.done(c)
+	return v, nil
+}
+
+// ReadTime reads a time written as tag 0 or tag 1.
+func (r *Reader) ReadTime() (time.Time, error) {
+	start := r.off
+	tag, err := r.ReadTag()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var t time.Time
+	switch tag {
+	case TagDateTimeString:
+		var s string
+		if s, err = r.ReadText(); err == nil {
+			if t, err = time.Parse(time.RFC3339Nano, s); err != nil {
+				err = ErrInvalid
+			}
+		}
+	case TagEpochDateTime:
+		switch typ, _ := r.Peek(); typ {
+		case Uint, NegInt:
+			var sec int64
+			if sec, err = r.ReadInt(); err == nil {
+				t = time.Unix(sec, 0)
+			}
+		default:
+			var f float64
+			if f, err = r.ReadFloat(); err == nil {
+				if math.IsNaN(f) || math.IsInf(f, 0) {
+					err = ErrInvalid
+				} else {
+					sec, frac := math.Modf(f)
+					t = time.Unix(int64(sec), int64(math.Round(frac*1e9)))
+				}
+			}
+		}
+	default:
+		err = ErrTypeMismatch
+	}
+	if err != nil {
+		r.off = start
+		return time.Time{}, err
+	}
+	return t, nil
+}
+
+// maxSkipDepth is how deeply Skip follows nested items.
+const maxSkipDepth = 512
+
+// Skip skips the next data item, including everything inside it.
+func (r *Reader) Skip() error {
+	c := r.cursor()
+	if err := c.skip(0); err != nil {
+		return err
+	}
+	r.done(c)
+	return nil
+}
+
+func (c *cursor) skip(depth int) error {
+	if depth > maxSkipDepth {
+		return ErrInvalid
+	}
+	major, ai, arg, err := c.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case majorBytes, majorText:
+		if ai == aiIndefinite {
+			c.off--
+			_, err = c.str(major)
+			return err
+		}
+		_, err = c.next(arg)
+		return err
+	case majorArray, majorMap:
+		// Every item takes at least a byte, so this also stops the count overflowing below.
+		if ai != aiIndefinite && arg > uint64(len(c.p)-c.off) {
+			return safebuffer.ErrShortRead
+		}
+		items := arg
+		if major == majorMap {
+			items *= 2
+		}
+		for i := uint64(0); ai == aiIndefinite || i < items; i++ {
+			if ai == aiIndefinite && c.off < len(c.p) && c.p[c.off] == byteBreak {
+				c.off++
+				if major == majorMap && i%2 != 0 {
+					return ErrInvalid
+				}
+				return nil
+			}
+			if err := c.skip(depth + 1); err != nil {
+				return err
+			}
+		}
+	case majorTag:
+		return c.skip(depth + 1)
+	case majorSimple:
+		if ai == aiIndefinite {
+			// A break on its own is not a data item.
+			return ErrInvalid
+		}
+		if ai == aiOneByte && arg < 32 {
+			return ErrInvalid
+		}
+	}
+	return nil
+}
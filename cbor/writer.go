@@ -0,0 +1,407 @@
+package cbor
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// frame is an array, map, tag or indefinite-length string that is still being written.
+type frame struct {
+	major byte
+
+	// left is how many more items the frame needs, or -1 if it is indefinite-length.
+	left int
+
+	// items is how many items have been written into the frame, and start is where the first
+	// one begins in the buffer. Deterministic maps use these to sort their keys.
+	items int
+	start int
+}
+
+// Writer writes CBOR data items into a ResizableBuffer. Arrays, maps and tags are written as a
+// head, followed by their items, and the writer keeps track of when each one is complete.
+// Once an error is held, all writes are ignored, so a chain of writes can be checked once at
+// the end with Err. Writing an item where it is not allowed, such as a number inside an
+// indefinite-length string, panics. Nothing else may be written to the buffer while a map is
+// open in deterministic mode. This is single threaded.
+type Writer struct {
+	b             *safebuffer.ResizableBuffer
+	deterministic bool
+	stack         []frame
+	err           error
+}
+
+// NewWriter creates a new Writer that appends to the buffer given. If deterministic is true,
+// the writer uses the core deterministic encoding rules.
+func NewWriter(b *safebuffer.ResizableBuffer, deterministic bool) *Writer {
+	return &Writer{b: b, deterministic: deterministic}
+}
+
+// Err returns the error held by the writer, or the error held by the buffer.
+func (w *Writer) Err() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.b.Err()
+}
+
+// Depth returns the number of arrays, maps, tags and indefinite-length strings that are
+// still open.
+func (w *Writer) Depth() int {
+	return len(w.stack)
+}
+
+// ok reports whether writing should go ahead, panicking if an item of the major type given
+// cannot be written here.
+func (w *Writer) ok(major byte) bool {
+	if w.err != nil || w.b.Err() != nil {
+		return false
+	}
+	if n := len(w.stack); n > 0 {
+		top := w.stack[n-1]
+		if (top.major == majorBytes || top.major == majorText) && major != top.major {
+			panic("cbor: indefinite-length string chunks must be strings of the same type")
+		}
+	}
+	return true
+}
+
+// head writes the initial byte and argument of an item in the shortest form.
+func (w *Writer) head(major byte, arg uint64) {
+	m := major << 5
+	switch {
+	case arg < aiOneByte:
+		w.b.Byte(m | byte(arg))
+	case arg <= math.MaxUint8:
+		w.b.Byte(m | aiOneByte).Byte(byte(arg))
+	case arg <= math.MaxUint16:
+		w.b.Byte(m|aiTwoBytes).Uint16(uint16(arg), false)
+	case arg <= math.MaxUint32:
+		w.b.Byte(m|aiFourBytes).Uint32(uint32(arg), false)
+	default:
+		w.b.Byte(m|aiEightBytes).Uint64(arg, false)
+	}
+}
+
+// item counts a complete item towards the open frames, closing any that are now complete.
+func (w *Writer) item() {
+	for n := len(w.stack); n > 0; n = len(w.stack) {
+		f := &w.stack[n-1]
+		f.items++
+		if f.left < 0 {
+			return
+		}
+		if f.left--; f.left > 0 {
+			return
+		}
+		w.stack = w.stack[:n-1]
+		if f.major == majorMap && w.deterministic {
+			w.sortMap(f.start, f.items/2)
+		}
+	}
+}
+
+// open starts a frame that needs n more items, or closes it straight away if n is 0.
+func (w *Writer) open(major byte, n int) {
+	if n == 0 {
+		w.item()
+		return
+	}
+	w.stack = append(w.stack, frame{major: major, left: n, start: w.b.Len()})
+}
+
+// Uint writes an unsigned integer.
+func (w *Writer) Uint(v uint64) *Writer {
+	if w.ok(majorUint) {
+		w.head(majorUint, v)
+		w.item()
+	}
+	return w
+}
+
+// Int writes a signed integer.
+func (w *Writer) Int(v int64) *Writer {
+	if v >= 0 {
+		return w.Uint(uint64(v))
+	}
+	if w.ok(majorNegInt) {
+		w.head(majorNegInt, uint64(-1-v))
+		w.item()
+	}
+	return w
+}
+
+// BigInt writes an integer of any size. If it fits in a major type 0 or 1 integer, it is
+// written as one, and otherwise as a bignum.
+func (w *Writer) BigInt(v *big.Int) *Writer {
+	if v.IsUint64() {
+		return w.Uint(v.Uint64())
+	}
+	tag := uint64(TagPositiveBignum)
+	if v.Sign() < 0 {
+		// Negative integers n are written as -1 - n.
+		v = new(big.Int).Sub(big.NewInt(-1), v)
+		if v.IsUint64() {
+			if w.ok(majorNegInt) {
+				w.head(majorNegInt, v.Uint64())
+				w.item()
+			}
+			return w
+		}
+		tag = TagNegativeBignum
+	}
+	return w.Tag(tag).Bytes(v.Bytes())
+}
+
+// Bytes writes a byte string.
+func (w *Writer) Bytes(p []byte) *Writer {
+	if w.ok(majorBytes) {
+		w.head(majorBytes, uint64(len(p)))
+		w.b.CopyBytes(p)
+		w.item()
+	}
+	return w
+}
+
+// Text writes a text string. The string should be valid UTF-8.
+func (w *Writer) Text(s string) *Writer {
+	if w.ok(majorText) {
+		w.head(majorText, uint64(len(s)))
+		w.b.CopyString(s)
+		w.item()
+	}
+	return w
+}
+
+// ArrayHeader starts an array of n items.
+func (w *Writer) ArrayHeader(n int) *Writer {
+	if !w.ok(majorArray) {
+		return w
+	}
+	if n < 0 {
+		w.err = ErrInvalidCount
+		return w
+	}
+	w.head(majorArray, uint64(n))
+	w.open(majorArray, n)
+	return w
+}
+
+// MapHeader starts a map of n pairs. Each key must be followed by its value. In deterministic
+// mode, the pairs are sorted once the last one is written.
+func (w *Writer) MapHeader(n int) *Writer {
+	if !w.ok(majorMap) {
+		return w
+	}
+	if n < 0 || n > math.MaxInt/2 {
+		w.err = ErrInvalidCount
+		return w
+	}
+	w.head(majorMap, uint64(n))
+	w.open(majorMap, n*2)
+	return w
+}
+
+// Tag writes a tag. The item it applies to must follow it.
+func (w *Writer) Tag(tag uint64) *Writer {
+	if w.ok(majorTag) {
+		w.head(majorTag, tag)
+		w.open(majorTag, 1)
+	}
+	return w
+}
+
+// indefinite starts an indefinite-length item of the major type given.
+func (w *Writer) indefinite(major byte) *Writer {
+	if !w.ok(major) {
+		return w
+	}
+	if n := len(w.stack); n > 0 && w.stack[n-1].major == major && (major == majorBytes || major == majorText) {
+		panic("cbor: indefinite-length string chunks must be definite-length")
+	}
+	if w.deterministic {
+		w.err = ErrIndefinite
+		return w
+	}
+	w.b.Byte(major<<5 | aiIndefinite)
+	w.stack = append(w.stack, frame{major: major, left: -1})
+	return w
+}
+
+// BeginArray starts an indefinite-length array. End it with Break.
+func (w *Writer) BeginArray() *Writer {
+	return w.indefinite(majorArray)
+}
+
+// BeginMap starts an indefinite-length map. End it with Break.
+func (w *Writer) BeginMap() *Writer {
+	return w.indefinite(majorMap)
+}
+
+// BeginBytes starts an indefinite-length byte string. Write its chunks with Bytes, and end it
+// with Break.
+func (w *Writer) BeginBytes() *Writer {
+	return w.indefinite(majorBytes)
+}
+
+// BeginText starts an indefinite-length text string. Write its chunks with Text, and end it
+// with Break.
+func (w *Writer) BeginText() *Writer {
+	return w.indefinite(majorText)
+}
+
+// Break ends the innermost indefinite-length item.
+func (w *Writer) Break() *Writer {
+	if w.err != nil || w.b.Err() != nil {
+		return w
+	}
+	n := len(w.stack)
+	if n == 0 || w.stack[n-1].left >= 0 {
+		panic("cbor: Break called without an indefinite-length item to end")
+	}
+	if top := w.stack[n-1]; top.major == majorMap && top.items%2 != 0 {
+		panic("cbor: Break called on a map with a key and no value")
+	}
+	w.b.Byte(byteBreak)
+	w.stack = w.stack[:n-1]
+	w.item()
+	return w
+}
+
+// Bool writes a boolean.
+func (w *Writer) Bool(v bool) *Writer {
+	if w.ok(majorSimple) {
+		if v {
+			w.b.Byte(byteTrue)
+		} else {
+			w.b.Byte(byteFalse)
+		}
+		w.item()
+	}
+	return w
+}
+
+// Null writes null.
+func (w *Writer) Null() *Writer {
+	if w.ok(majorSimple) {
+		w.b.Byte(byteNull)
+		w.item()
+	}
+	return w
+}
+
+// Undefined writes undefined.
+func (w *Writer) Undefined() *Writer {
+	if w.ok(majorSimple) {
+		w.b.Byte(byteUndefined)
+		w.item()
+	}
+	return w
+}
+
+// Simple writes a simple value. Values 24 to 31 are reserved.
+func (w *Writer) Simple(v uint8) *Writer {
+	if !w.ok(majorSimple) {
+		return w
+	}
+	if v >= 24 && v < 32 {
+		w.err = ErrInvalidSimple
+		return w
+	}
+	w.head(majorSimple, uint64(v))
+	w.item()
+	return w
+}
+
+// Float64 writes a float. In deterministic mode, it is written at the smallest precision that
+// holds it exactly, and NaN is always written as the half precision quiet NaN. Otherwise, it is
+// written at double precision.
+func (w *Writer) Float64(v float64) *Writer {
+	if !w.ok(majorSimple) {
+		return w
+	}
+	if w.deterministic {
+		if h, ok := float16Bits(v); ok {
+			w.b.Byte(byteFloat16).Uint16(h, false)
+			w.item()
+			return w
+		}
+		if f := float32(v); float64(f) == v {
+			w.b.Byte(byteFloat32).Float32(f, false)
+			w.item()
+			return w
+		}
+	}
+	w.b.Byte(byteFloat64).Float64(v, false)
+	w.item()
+	return w
+}
+
+// Float32 writes a single precision float. In deterministic mode, this is the same as Float64.
+func (w *Writer) Float32(v float32) *Writer {
+	if w.deterministic {
+		return w.Float64(float64(v))
+	}
+	if w.ok(majorSimple) {
+		w.b.Byte(byteFloat32).Float32(v, false)
+		w.item()
+	}
+	return w
+}
+
+// Time writes a time as tag 1, the number of seconds since the epoch. This is an integer if
+// the time is a whole number of seconds, and a float otherwise.
+func (w *Writer) Time(t time.Time) *Writer {
+	w.Tag(TagEpochDateTime)
+	if t.Nanosecond() == 0 {
+		return w.Int(t.Unix())
+	}
+	return w.Float64(float64(t.Unix()) + float64(t.Nanosecond())/1e9)
+}
+
+// TimeString writes a time as tag 0, an RFC 3339 string.
+func (w *Writer) TimeString(t time.Time) *Writer {
+	return w.Tag(TagDateTimeString).Text(t.Format(time.RFC3339Nano))
+}
+
+// sortMap sorts the n pairs of the map starting at the offset given, which must run to the end
+// of the buffer, by the bytes of their keys.
+func (w *Writer) sortMap(start, n int) {
+	if w.b.Err() != nil {
+		return
+	}
+	type pair struct {
+		key, item []byte
+	}
+	region := w.b.Bytes()[start:]
+	r := NewReader(region)
+	pairs := make([]pair, n)
+	for i := range pairs {
+		from := r.Offset()
+		if r.Skip() != nil {
+			panic("cbor: map written with invalid items")
+		}
+		keyEnd := r.Offset()
+		if r.Skip() != nil {
+			panic("cbor: map written with invalid items")
+		}
+		pairs[i] = pair{key: region[from:keyEnd], item: region[from:r.Offset()]}
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return bytes.Compare(pairs[i].key, pairs[j].key) < 0
+	})
+	sorted := make([]byte, 0, len(region))
+	for i, p := range pairs {
+		if i > 0 && bytes.Equal(p.key, pairs[i-1].key) {
+			w.err = ErrDuplicateKey
+			return
+		}
+		sorted = append(sorted, p.item...)
+	}
+	w.b.PutBytesAt(start, sorted)
+}
@@ -0,0 +1,61 @@
+package safebuffer
+
+import "io"
+
+// WithChecks turns on use-after-Reset detection for sub-buffers. Each sub-buffer made after
+// this remembers the state of its parent, and panics if it is used after the parent was
+// reset, reallocated or had its data moved, since the sub-buffer no longer points at the
+// parent's data. This is meant for debugging and tests.
+func (b *ResizableBuffer) WithChecks() *ResizableBuffer {
+	b.checked = true
+	return b
+}
+
+// check panics if this is a sub-buffer of a parent that has changed since it was made.
+func (b *ResizableBuffer) check() {
+	if b.parent == nil {
+		return
+	}
+	if b.linked {
+		b.resolve()
+		return
+	}
+	if b.parent.gen != b.parentGen {
+		panic("safebuffer: sub-buffer used after its parent was reset or reallocated")
+	}
+	b.parent.check()
+}
+
+// View is a checked slice of a ResizableBuffer. Unlike the slices returned by Bytes and
+// ReadInto, getting the bytes from a view panics if the buffer has since been reset,
+// reallocated or had its data moved.
+type View struct {
+	b   *ResizableBuffer
+	gen uint64
+	s   []byte
+}
+
+// Bytes returns the bytes of the view. This panics if the view is stale.
+func (v View) Bytes() []byte {
+	if v.b != nil && v.b.gen != v.gen {
+		panic("safebuffer: view used after its buffer was reset or reallocated")
+	}
+	return v.s
+}
+
+// Len returns the length of the view. This does not need the view to be valid.
+func (v View) Len() int {
+	return len(v.s)
+}
+
+// BytesView is like Bytes, but returns a checked view of the consumed buffer.
+func (b *ResizableBuffer) BytesView() View {
+	s := b.Bytes()
+	return View{b: b, gen: b.gen, s: s}
+}
+
+// ReadIntoView is like ReadInto, but returns a checked view of the bytes read.
+func (b *ResizableBuffer) ReadIntoView(r io.Reader, maxSize int) (View, error) {
+	s, err := b.ReadInto(r, maxSize)
+	return View{b: b, gen: b.gen, s: s}, err
+}
@@ -0,0 +1,117 @@
+package safebuffer
+
+import (
+	"strings"
+	"testing"
+)
+
+// expectStale runs fn and checks that it panics about stale data.
+func expectStale(t *testing.T, fn func()) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		r := recover()
+		if r == nil {
+			t.Fatal("expected a panic")
+		}
+		if s, ok := r.(string); !ok || !strings.Contains(s, "reset or reallocated") {
+			t.Fatalf("expected a stale data panic, got %v", r)
+		}
+	}()
+	fn()
+}
+
+func TestCheckedSubBuffer(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		rb := NewResizableBuffer(make([]byte, 64)).WithHeadroom(8).WithChecks().CopyString("a")
+		sub := rb.SubBuffer(2)
+		rb.CopyString("b").PrependString(">")
+		sub.Byte('x').Byte('y')
+		if string(rb.Bytes()) != ">axyb" {
+			t.Fatalf("expected >axyb, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("after reset", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithChecks()
+		sub := rb.SubBuffer(4)
+		rb.Reset(false)
+		expectStale(t, func() { sub.Byte(1) })
+		expectStale(t, func() { sub.Bytes() })
+		expectStale(t, func() { sub.PutByteAt(0, 1) })
+		expectStale(t, func() { sub.PrependByte(1) })
+	})
+
+	t.Run("after reallocation", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithChecks()
+		sub := rb.SubBuffer(4)
+		rb.CopyBytes(make([]byte, 100))
+		expectStale(t, func() { sub.Uint32(1, true) })
+	})
+
+	t.Run("after pool reuse", func(t *testing.T) {
+		pool := NewBufferPool(false, 64)
+		rb := pool.Get(16).WithChecks()
+		sub := rb.SubBuffer(4)
+		pool.Put(rb)
+		expectStale(t, func() { sub.Bytes() })
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithChecks()
+		sub := rb.SubBuffer(8).WithChecks()
+		subSub := sub.SubBuffer(4)
+		rb.Reset(false)
+		expectStale(t, func() { subSub.Bytes() })
+	})
+
+	t.Run("unchecked", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		sub := rb.SubBuffer(4)
+		rb.Reset(false)
+		sub.Byte(1)
+	})
+}
+
+func TestView(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		rb := NewResizableBuffer(make([]byte, 64)).CopyString("hello")
+		v := rb.BytesView()
+		rb.CopyString(" world")
+		if string(v.Bytes()) != "hello" || v.Len() != 5 {
+			t.Fatalf("expected hello, got %q", v.Bytes())
+		}
+	})
+
+	tests := []struct {
+		name string
+		fn   func(b *ResizableBuffer)
+	}{
+		{"reset", func(b *ResizableBuffer) { b.Reset(false) }},
+		{"destroy", func(b *ResizableBuffer) { b.Destroy() }},
+		{"reallocation", func(b *ResizableBuffer) { b.CopyBytes(make([]byte, 100)) }},
+		{"headroom move", func(b *ResizableBuffer) { b.PrependString("x") }},
+		{"insert", func(b *ResizableBuffer) { b.InsertByte(1, 'x') }},
+		{"delete", func(b *ResizableBuffer) { b.DeleteRange(1, 2) }},
+		{"rollback", func(b *ResizableBuffer) { b.RollbackTo(b.Mark(), false) }},
+		{"drain", func(b *ResizableBuffer) { b.WriteTo(&limitedWriter{limit: 100}) }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rb := NewResizableBuffer(make([]byte, 8)).CopyString("hello")
+			v := rb.BytesView()
+			test.fn(rb)
+			expectStale(t, func() { v.Bytes() })
+		})
+	}
+
+	t.Run("read into", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		v, err := rb.ReadIntoView(stringReader{s: "hello"}, 5)
+		if err != nil || string(v.Bytes()) != "hello" {
+			t.Fatalf("expected hello, nil, got %q, %v", v.Bytes(), err)
+		}
+		rb.Reset(false)
+		expectStale(t, func() { v.Bytes() })
+	})
+}
@@ -0,0 +1,286 @@
+package safebuffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"hash/crc64"
+)
+
+// ErrChecksumMismatch is returned by the ReadableBuffer Verify methods when the checksum at
+// the end of the data does not match the data before it.
+var ErrChecksumMismatch = errors.New("safebuffer: checksum does not match")
+
+// putSum writes a checksum of width bytes.
+func putSum(p []byte, v uint64, littleEndian bool) {
+	var order binary.ByteOrder = binary.BigEndian
+	if littleEndian {
+		order = binary.LittleEndian
+	}
+	switch len(p) {
+	case 2:
+		order.PutUint16(p, uint16(v))
+	case 4:
+		order.PutUint32(p, uint32(v))
+	default:
+		order.PutUint64(p, v)
+	}
+}
+
+// appendSum writes the checksum f gives for the bytes from start to the end of the consumed
+// buffer after them.
+func (b *ResizableBuffer) appendSum(start, width int, littleEndian bool, f func(p []byte) uint64) *ResizableBuffer {
+	b.check()
+	if !b.inRange(start, b.offset) {
+		return b
+	}
+	v := f(b.buffer[b.start+start : b.end()])
+	if b.ensureCapacity(width) {
+		putSum(b.buffer[b.end():b.end()+width], v, littleEndian)
+		b.offset += width
+	}
+	return b
+}
+
+// prependSum writes the checksum f gives for the bytes from the start of the consumed buffer
+// up to end in front of them.
+func (b *ResizableBuffer) prependSum(end, width int, littleEndian bool, f func(p []byte) uint64) *ResizableBuffer {
+	b.check()
+	if !b.inRange(0, end) {
+		return b
+	}
+	v := f(b.buffer[b.start : b.start+end])
+	return b.prependStart(width, func(b []byte) {
+		putSum(b[:width], v, littleEndian)
+	})
+}
+
+func crc32Sum(table *crc32.Table) func(p []byte) uint64 {
+	if table == nil {
+		table = crc32.IEEETable
+	}
+	return func(p []byte) uint64 {
+		return uint64(crc32.Checksum(p, table))
+	}
+}
+
+func crc64Sum(table *crc64.Table) func(p []byte) uint64 {
+	if table == nil {
+		table = crc64.MakeTable(crc64.ISO)
+	}
+	return func(p []byte) uint64 {
+		return crc64.Checksum(p, table)
+	}
+}
+
+func adler32Sum(p []byte) uint64 {
+	return uint64(adler32.Checksum(p))
+}
+
+// fletcher16Sum returns the Fletcher-16 checksum of p.
+func fletcher16Sum(p []byte) uint64 {
+	var a, c uint32
+	for len(p) > 0 {
+		// 5802 bytes is the most that can be summed before c could overflow.
+		n := min(len(p), 5802)
+		for _, v := range p[:n] {
+			a += uint32(v)
+			c += a
+		}
+		a %= 255
+		c %= 255
+		p = p[n:]
+	}
+	return uint64(c<<8 | a)
+}
+
+// fletcher32Sum returns the Fletcher-32 checksum of p, taken as little endian 16-bit words. An
+// odd byte at the end is padded with a zero.
+func fletcher32Sum(p []byte) uint64 {
+	var a, c uint64
+	for len(p) > 0 {
+		n := min(len(p), 2*359)
+		for i := 0; i < n; i += 2 {
+			w := uint64(p[i])
+			if i+1 < n {
+				w |= uint64(p[i+1]) << 8
+			}
+			a += w
+			c += a
+		}
+		a %= 65535
+		c %= 65535
+		p = p[n:]
+	}
+	return c<<16 | a
+}
+
+// AppendCRC32 writes the CRC-32 of the bytes from start to the end of the consumed buffer
+// after them. A nil table means the IEEE polynomial. Use crc32.MakeTable(crc32.Castagnoli)
+// for CRC-32C.
+func (b *ResizableBuffer) AppendCRC32(start int, table *crc32.Table, littleEndian bool) *ResizableBuffer {
+	return b.appendSum(start, 4, littleEndian, crc32Sum(table))
+}
+
+// PrependCRC32 writes the CRC-32 of the bytes from the start of the consumed buffer up to end
+// in front of them. A nil table means the IEEE polynomial.
+func (b *ResizableBuffer) PrependCRC32(end int, table *crc32.Table, littleEndian bool) *ResizableBuffer {
+	return b.prependSum(end, 4, littleEndian, crc32Sum(table))
+}
+
+// AppendCRC64 writes the CRC-64 of the bytes from start to the end of the consumed buffer
+// after them. A nil table means the ISO polynomial.
+func (b *ResizableBuffer) AppendCRC64(start int, table *crc64.Table, littleEndian bool) *ResizableBuffer {
+	return b.appendSum(start, 8, littleEndian, crc64Sum(table))
+}
+
+// PrependCRC64 writes the CRC-64 of the bytes from the start of the consumed buffer up to end
+// in front of them. A nil table means the ISO polynomial.
+func (b *ResizableBuffer) PrependCRC64(end int, table *crc64.Table, littleEndian bool) *ResizableBuffer {
+	return b.prependSum(end, 8, littleEndian, crc64Sum(table))
+}
+
+// AppendAdler32 writes the Adler-32 checksum of the bytes from start to the end of the
+// consumed buffer after them.
+func (b *ResizableBuffer) AppendAdler32(start int, littleEndian bool) *ResizableBuffer {
+	return b.appendSum(start, 4, littleEndian, adler32Sum)
+}
+
+// PrependAdler32 writes the Adler-32 checksum of the bytes from the start of the consumed
+// buffer up to end in front of them.
+func (b *ResizableBuffer) PrependAdler32(end int, littleEndian bool) *ResizableBuffer {
+	return b.prependSum(end, 4, littleEndian, adler32Sum)
+}
+
+// AppendFletcher16 writes the Fletcher-16 checksum of the bytes from start to the end of the
+// consumed buffer after them.
+func (b *ResizableBuffer) AppendFletcher16(start int, littleEndian bool) *ResizableBuffer {
+	return b.appendSum(start, 2, littleEndian, fletcher16Sum)
+}
+
+// PrependFletcher16 writes the Fletcher-16 checksum of the bytes from the start of the
+// consumed buffer up to end in front of them.
+func (b *ResizableBuffer) PrependFletcher16(end int, littleEndian bool) *ResizableBuffer {
+	return b.prependSum(end, 2, littleEndian, fletcher16Sum)
+}
+
+// AppendFletcher32 writes the Fletcher-32 checksum of the bytes from start to the end of the
+// consumed buffer after them. The bytes are summed as little endian 16-bit words.
+func (b *ResizableBuffer) AppendFletcher32(start int, littleEndian bool) *ResizableBuffer {
+	return b.appendSum(start, 4, littleEndian, fletcher32Sum)
+}
+
+// PrependFletcher32 writes the Fletcher-32 checksum of the bytes from the start of the
+// consumed buffer up to end in front of them. The bytes are summed as little endian 16-bit
+// words.
+func (b *ResizableBuffer) PrependFletcher32(end int, littleEndian bool) *ResizableBuffer {
+	return b.prependSum(end, 4, littleEndian, fletcher32Sum)
+}
+
+// hashSum resets h and returns its sum of p.
+func hashSum(h hash.Hash, p []byte, scratch []byte) []byte {
+	h.Reset()
+	h.Write(p)
+	return h.Sum(scratch[:0])
+}
+
+// AppendChecksum writes the sum h gives for the bytes from start to the end of the consumed
+// buffer after them, in the byte order h.Sum uses. h is reset first.
+func (b *ResizableBuffer) AppendChecksum(start int, h hash.Hash) *ResizableBuffer {
+	b.check()
+	if !b.inRange(start, b.offset) {
+		return b
+	}
+	var scratch [64]byte
+	return b.CopyBytes(hashSum(h, b.buffer[b.start+start:b.end()], scratch[:]))
+}
+
+// PrependChecksum writes the sum h gives for the bytes from the start of the consumed buffer
+// up to end in front of them, in the byte order h.Sum uses. h is reset first.
+func (b *ResizableBuffer) PrependChecksum(end int, h hash.Hash) *ResizableBuffer {
+	b.check()
+	if !b.inRange(0, end) {
+		return b
+	}
+	var scratch [64]byte
+	return b.PrependBytes(hashSum(h, b.buffer[b.start:b.start+end], scratch[:]))
+}
+
+// trailer returns the bytes from start up to a trailer of width bytes at the end of the
+// data, and the trailer itself.
+func (r *ReadableBuffer) trailer(start, width int) ([]byte, []byte, error) {
+	if start < 0 {
+		return nil, nil, ErrOutOfRange
+	}
+	end := len(r.buffer) - width
+	if end < start || end < r.offset {
+		return nil, nil, ErrShortRead
+	}
+	return r.buffer[start:end], r.buffer[end:], nil
+}
+
+// verifySum checks the checksum f gives against the trailer, and strips the trailer if it
+// matches.
+func (r *ReadableBuffer) verifySum(start, width int, littleEndian bool, f func(p []byte) uint64) error {
+	p, trailer, err := r.trailer(start, width)
+	if err != nil {
+		return err
+	}
+	var expected [8]byte
+	putSum(expected[:width], f(p), littleEndian)
+	if !bytes.Equal(expected[:width], trailer) {
+		return ErrChecksumMismatch
+	}
+	r.buffer = r.buffer[:len(r.buffer)-width]
+	return nil
+}
+
+// VerifyCRC32 checks that the data ends with the CRC-32 of the bytes from start up to it, as
+// written by ResizableBuffer.AppendCRC32, and then removes it so it is not read as data.
+// start is an offset from the beginning of the data, not the read position. If the checksum
+// does not match, ErrChecksumMismatch is returned and nothing is removed.
+func (r *ReadableBuffer) VerifyCRC32(start int, table *crc32.Table, littleEndian bool) error {
+	return r.verifySum(start, 4, littleEndian, crc32Sum(table))
+}
+
+// VerifyCRC64 checks and removes a CRC-64 written by ResizableBuffer.AppendCRC64, the same way
+// as VerifyCRC32.
+func (r *ReadableBuffer) VerifyCRC64(start int, table *crc64.Table, littleEndian bool) error {
+	return r.verifySum(start, 8, littleEndian, crc64Sum(table))
+}
+
+// VerifyAdler32 checks and removes an Adler-32 checksum written by
+// ResizableBuffer.AppendAdler32, the same way as VerifyCRC32.
+func (r *ReadableBuffer) VerifyAdler32(start int, littleEndian bool) error {
+	return r.verifySum(start, 4, littleEndian, adler32Sum)
+}
+
+// VerifyFletcher16 checks and removes a Fletcher-16 checksum written by
+// ResizableBuffer.AppendFletcher16, the same way as VerifyCRC32.
+func (r *ReadableBuffer) VerifyFletcher16(start int, littleEndian bool) error {
+	return r.verifySum(start, 2, littleEndian, fletcher16Sum)
+}
+
+// VerifyFletcher32 checks and removes a Fletcher-32 checksum written by
+// ResizableBuffer.AppendFletcher32, the same way as VerifyCRC32.
+func (r *ReadableBuffer) VerifyFletcher32(start int, littleEndian bool) error {
+	return r.verifySum(start, 4, littleEndian, fletcher32Sum)
+}
+
+// VerifyChecksum checks and removes a sum written by ResizableBuffer.AppendChecksum, the same
+// way as VerifyCRC32. h is reset first.
+func (r *ReadableBuffer) VerifyChecksum(start int, h hash.Hash) error {
+	p, trailer, err := r.trailer(start, h.Size())
+	if err != nil {
+		return err
+	}
+	var scratch [64]byte
+	if !bytes.Equal(hashSum(h, p, scratch[:]), trailer) {
+		return ErrChecksumMismatch
+	}
+	r.buffer = r.buffer[:len(r.buffer)-h.Size()]
+	return nil
+}
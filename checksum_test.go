@@ -0,0 +1,234 @@
+package safebuffer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash/crc32"
+	"hash/crc64"
+	"testing"
+)
+
+func TestChecksums(t *testing.T) {
+	castagnoli := crc32.MakeTable(crc32.Castagnoli)
+	ecma := crc64.MakeTable(crc64.ECMA)
+	tests := []struct {
+		name    string
+		data    string
+		fn      func(b *ResizableBuffer, start int, littleEndian bool) *ResizableBuffer
+		prepend func(b *ResizableBuffer, end int, littleEndian bool) *ResizableBuffer
+		verify  func(r *ReadableBuffer, start int, littleEndian bool) error
+		eq      []byte
+	}{
+		{
+			"crc32", "123456789",
+			func(b *ResizableBuffer, start int, le bool) *ResizableBuffer { return b.AppendCRC32(start, nil, le) },
+			func(b *ResizableBuffer, end int, le bool) *ResizableBuffer { return b.PrependCRC32(end, nil, le) },
+			func(r *ReadableBuffer, start int, le bool) error { return r.VerifyCRC32(start, nil, le) },
+			[]byte{0xcb, 0xf4, 0x39, 0x26},
+		},
+		{
+			"crc32c", "123456789",
+			func(b *ResizableBuffer, start int, le bool) *ResizableBuffer {
+				return b.AppendCRC32(start, castagnoli, le)
+			},
+			func(b *ResizableBuffer, end int, le bool) *ResizableBuffer {
+				return b.PrependCRC32(end, castagnoli, le)
+			},
+			func(r *ReadableBuffer, start int, le bool) error { return r.VerifyCRC32(start, castagnoli, le) },
+			[]byte{0xe3, 0x06, 0x92, 0x83},
+		},
+		{
+			"crc64 iso", "123456789",
+			func(b *ResizableBuffer, start int, le bool) *ResizableBuffer { return b.AppendCRC64(start, nil, le) },
+			func(b *ResizableBuffer, end int, le bool) *ResizableBuffer { return b.PrependCRC64(end, nil, le) },
+			func(r *ReadableBuffer, start int, le bool) error { return r.VerifyCRC64(start, nil, le) },
+			[]byte{0xb9, 0x09, 0x56, 0xc7, 0x75, 0xa4, 0x10, 0x01},
+		},
+		{
+			"crc64 ecma", "123456789",
+			func(b *ResizableBuffer, start int, le bool) *ResizableBuffer { return b.AppendCRC64(start, ecma, le) },
+			func(b *ResizableBuffer, end int, le bool) *ResizableBuffer { return b.PrependCRC64(end, ecma, le) },
+			func(r *ReadableBuffer, start int, le bool) error { return r.VerifyCRC64(start, ecma, le) },
+			[]byte{0x99, 0x5d, 0xc9, 0xbb, 0xdf, 0x19, 0x39, 0xfa},
+		},
+		{
+			"adler32", "Wikipedia",
+			func(b *ResizableBuffer, start int, le bool) *ResizableBuffer { return b.AppendAdler32(start, le) },
+			func(b *ResizableBuffer, end int, le bool) *ResizableBuffer { return b.PrependAdler32(end, le) },
+			func(r *ReadableBuffer, start int, le bool) error { return r.VerifyAdler32(start, le) },
+			[]byte{0x11, 0xe6, 0x03, 0x98},
+		},
+		{
+			"fletcher16", "abcde",
+			func(b *ResizableBuffer, start int, le bool) *ResizableBuffer { return b.AppendFletcher16(start, le) },
+			func(b *ResizableBuffer, end int, le bool) *ResizableBuffer { return b.PrependFletcher16(end, le) },
+			func(r *ReadableBuffer, start int, le bool) error { return r.VerifyFletcher16(start, le) },
+			[]byte{0xc8, 0xf0},
+		},
+		{
+			"fletcher32 odd", "abcde",
+			func(b *ResizableBuffer, start int, le bool) *ResizableBuffer { return b.AppendFletcher32(start, le) },
+			func(b *ResizableBuffer, end int, le bool) *ResizableBuffer { return b.PrependFletcher32(end, le) },
+			func(r *ReadableBuffer, start int, le bool) error { return r.VerifyFletcher32(start, le) },
+			[]byte{0xf0, 0x4f, 0xc7, 0x29},
+		},
+		{
+			"fletcher32 even", "abcdefgh",
+			func(b *ResizableBuffer, start int, le bool) *ResizableBuffer { return b.AppendFletcher32(start, le) },
+			func(b *ResizableBuffer, end int, le bool) *ResizableBuffer { return b.PrependFletcher32(end, le) },
+			func(r *ReadableBuffer, start int, le bool) error { return r.VerifyFletcher32(start, le) },
+			[]byte{0xeb, 0xe1, 0x95, 0x91},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, le := range []bool{false, true} {
+				expected := bytes.Clone(test.eq)
+				if le {
+					for i, j := 0, len(expected)-1; i < j; i, j = i+1, j-1 {
+						expected[i], expected[j] = expected[j], expected[i]
+					}
+				}
+
+				b := NewResizableBuffer(nil).CopyString("header").CopyString(test.data)
+				if test.fn(b, 6, le) != b || b.Err() != nil {
+					t.Fatalf("expected the buffer to be returned with no error, got %v", b.Err())
+				}
+				if want := append([]byte("header"+test.data), expected...); !bytes.Equal(b.Bytes(), want) {
+					t.Fatalf("little endian %v: expected %x, got %x", le, want, b.Bytes())
+				}
+
+				r := NewReadableBuffer(b.Bytes())
+				r.Skip(6)
+				if err := test.verify(r, 6, le); err != nil {
+					t.Fatalf("expected nil error, got %v", err)
+				}
+				if r.Len() != len(test.data) || string(r.Remaining()) != test.data {
+					t.Fatalf("expected the trailer to be stripped, got %q", r.Remaining())
+				}
+
+				p := NewResizableBuffer(nil).CopyString(test.data).CopyString("footer")
+				if test.prepend(p, len(test.data), le) != p || p.Err() != nil {
+					t.Fatalf("expected the buffer to be returned with no error, got %v", p.Err())
+				}
+				if want := append(expected, test.data+"footer"...); !bytes.Equal(p.Bytes(), want) {
+					t.Fatalf("little endian %v: expected %x, got %x", le, want, p.Bytes())
+				}
+			}
+		})
+	}
+}
+
+func TestFletcherLong(t *testing.T) {
+	// Long enough to need the sums reduced part way through, checked against the plain
+	// definitions.
+	p := bytes.Repeat([]byte{0xff, 0xfe, 0x01}, 10000)
+	var a, c uint64
+	for _, v := range p {
+		a = (a + uint64(v)) % 255
+		c = (c + a) % 255
+	}
+	if got := fletcher16Sum(p); got != c<<8|a {
+		t.Fatalf("expected %x, got %x", c<<8|a, got)
+	}
+	a, c = 0, 0
+	for i := 0; i < len(p); i += 2 {
+		a = (a + (uint64(p[i]) | uint64(p[i+1])<<8)) % 65535
+		c = (c + a) % 65535
+	}
+	if got := fletcher32Sum(p); got != c<<16|a {
+		t.Fatalf("expected %x, got %x", c<<16|a, got)
+	}
+}
+
+func TestAppendChecksum(t *testing.T) {
+	h := sha256.New()
+	h.Write([]byte("stale state"))
+	b := NewResizableBuffer(nil).CopyString("abc").AppendChecksum(0, h)
+	expected := sha256.Sum256([]byte("abc"))
+	if !bytes.Equal(b.Bytes(), append([]byte("abc"), expected[:]...)) {
+		t.Fatalf("expected the sum to be appended, got %x", b.Bytes())
+	}
+
+	r := NewReadableBuffer(b.Bytes())
+	if err := r.VerifyChecksum(0, h); err != nil || string(r.Remaining()) != "abc" {
+		t.Fatalf("expected abc, got %q, %v", r.Remaining(), err)
+	}
+
+	p := NewResizableBuffer(nil).CopyString("abcdef").PrependChecksum(3, h)
+	if !bytes.Equal(p.Bytes(), append(expected[:], "abcdef"...)) {
+		t.Fatalf("expected the sum to be prepended, got %x", p.Bytes())
+	}
+}
+
+func TestChecksumErrors(t *testing.T) {
+	t.Run("append out of range", func(t *testing.T) {
+		b := NewResizableBuffer(nil).CopyString("abc").AppendCRC32(4, nil, false)
+		if b.Err() != ErrOutOfRange || b.Len() != 3 {
+			t.Fatalf("expected ErrOutOfRange and nothing written, got %v and %d bytes", b.Err(), b.Len())
+		}
+	})
+
+	t.Run("prepend out of range", func(t *testing.T) {
+		b := NewResizableBuffer(nil).CopyString("abc").PrependChecksum(-1, sha256.New())
+		if b.Err() != ErrOutOfRange || b.Len() != 3 {
+			t.Fatalf("expected ErrOutOfRange and nothing written, got %v and %d bytes", b.Err(), b.Len())
+		}
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		b := NewResizableBuffer(nil).WithMaxSize(5).CopyString("abc").AppendCRC32(0, nil, false)
+		if b.Err() != ErrTooLarge || b.Len() != 3 {
+			t.Fatalf("expected ErrTooLarge and nothing written, got %v and %d bytes", b.Err(), b.Len())
+		}
+	})
+
+	t.Run("empty range", func(t *testing.T) {
+		b := NewResizableBuffer(nil).CopyString("abc").AppendAdler32(3, false)
+		if !bytes.Equal(b.Bytes(), []byte{'a', 'b', 'c', 0, 0, 0, 1}) {
+			t.Fatalf("expected the checksum of nothing, got %x", b.Bytes())
+		}
+	})
+
+	data := NewResizableBuffer(nil).CopyString("hello").AppendCRC32(0, nil, true).Bytes()
+
+	t.Run("mismatch", func(t *testing.T) {
+		for i := range data {
+			damaged := bytes.Clone(data)
+			damaged[i] ^= 0x01
+			r := NewReadableBuffer(damaged)
+			if err := r.VerifyCRC32(0, nil, true); err != ErrChecksumMismatch {
+				t.Fatalf("byte %d: expected ErrChecksumMismatch, got %v", i, err)
+			}
+			if r.Len() != len(data) {
+				t.Fatalf("expected nothing to be stripped, got %d bytes", r.Len())
+			}
+		}
+	})
+
+	t.Run("wrong byte order", func(t *testing.T) {
+		if err := NewReadableBuffer(data).VerifyCRC32(0, nil, false); err != ErrChecksumMismatch {
+			t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+		}
+	})
+
+	t.Run("short", func(t *testing.T) {
+		if err := NewReadableBuffer([]byte{1, 2, 3}).VerifyCRC32(0, nil, true); err != ErrShortRead {
+			t.Fatalf("expected ErrShortRead, got %v", err)
+		}
+		r := NewReadableBuffer(data)
+		r.Skip(len(data) - 2)
+		if err := r.VerifyCRC32(0, nil, true); err != ErrShortRead {
+			t.Fatalf("expected ErrShortRead when the trailer has been read, got %v", err)
+		}
+		if err := NewReadableBuffer(data).VerifyCRC32(len(data), nil, true); err != ErrShortRead {
+			t.Fatalf("expected ErrShortRead for a start past the trailer, got %v", err)
+		}
+	})
+
+	t.Run("negative start", func(t *testing.T) {
+		if err := NewReadableBuffer(data).VerifyCRC32(-1, nil, true); err != ErrOutOfRange {
+			t.Fatalf("expected ErrOutOfRange, got %v", err)
+		}
+	})
+}
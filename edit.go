@@ -0,0 +1,178 @@
+package safebuffer
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// inRange checks that start and end are a valid range within the consumed buffer, setting
+// the error if they are not.
+func (b *ResizableBuffer) inRange(start, end int) bool {
+	if b.err != nil {
+		return false
+	}
+	if start < 0 || start > end || end > b.offset {
+		b.err = ErrOutOfRange
+		return false
+	}
+	return true
+}
+
+// insertAt makes room for n bytes at the offset given by moving everything after it forward,
+// and then writes the bytes with f. Inserting at the start is a prepend.
+func (b *ResizableBuffer) insertAt(off, n int, f func(b []byte)) *ResizableBuffer {
+	if !b.inRange(off, off) || n == 0 {
+		return b
+	}
+	if off == 0 {
+		return b.prependStart(n, f)
+	}
+	if !b.ensureCapacity(n) {
+		return b
+	}
+	pos := b.start + off
+	copy(b.buffer[pos+n:], b.buffer[pos:b.end()])
+	f(b.buffer[pos:])
+	b.offset += n
+	b.edited(off, n)
+	b.dropped()
+	return b
+}
+
+// InsertBytes inserts a byte slice into the consumed buffer at the offset given.
+func (b *ResizableBuffer) InsertBytes(off int, v []byte) *ResizableBuffer {
+	return b.insertAt(off, len(v), func(b []byte) {
+		copy(b, v)
+	})
+}
+
+// InsertString inserts a string into the consumed buffer at the offset given.
+func (b *ResizableBuffer) InsertString(off int, v string) *ResizableBuffer {
+	return b.insertAt(off, len(v), func(b []byte) {
+		copy(b, v)
+	})
+}
+
+// InsertByte inserts a byte into the consumed buffer at the offset given.
+func (b *ResizableBuffer) InsertByte(off int, v byte) *ResizableBuffer {
+	return b.insertAt(off, 1, func(b []byte) {
+		b[0] = v
+	})
+}
+
+// InsertUint16 inserts a uint16 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) InsertUint16(off int, v uint16, littleEndian bool) *ResizableBuffer {
+	return b.insertAt(off, 2, func(b []byte) {
+		if littleEndian {
+			binary.LittleEndian.PutUint16(b, v)
+		} else {
+			binary.BigEndian.PutUint16(b, v)
+		}
+	})
+}
+
+// InsertUint32 inserts a uint32 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) InsertUint32(off int, v uint32, littleEndian bool) *ResizableBuffer {
+	return b.insertAt(off, 4, func(b []byte) {
+		if littleEndian {
+			binary.LittleEndian.PutUint32(b, v)
+		} else {
+			binary.BigEndian.PutUint32(b, v)
+		}
+	})
+}
+
+// InsertUint64 inserts a uint64 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) InsertUint64(off int, v uint64, littleEndian bool) *ResizableBuffer {
+	return b.insertAt(off, 8, func(b []byte) {
+		if littleEndian {
+			binary.LittleEndian.PutUint64(b, v)
+		} else {
+			binary.BigEndian.PutUint64(b, v)
+		}
+	})
+}
+
+// InsertInt16 inserts a int16 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) InsertInt16(off int, v int16, littleEndian bool) *ResizableBuffer {
+	return b.InsertUint16(off, uint16(v), littleEndian)
+}
+
+// InsertInt32 inserts a int32 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) InsertInt32(off int, v int32, littleEndian bool) *ResizableBuffer {
+	return b.InsertUint32(off, uint32(v), littleEndian)
+}
+
+// InsertInt64 inserts a int64 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) InsertInt64(off int, v int64, littleEndian bool) *ResizableBuffer {
+	return b.InsertUint64(off, uint64(v), littleEndian)
+}
+
+// InsertFloat32 inserts a float32 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) InsertFloat32(off int, v float32, littleEndian bool) *ResizableBuffer {
+	return b.InsertUint32(off, math.Float32bits(v), littleEndian)
+}
+
+// InsertFloat64 inserts a float64 into the consumed buffer at the offset given.
+func (b *ResizableBuffer) InsertFloat64(off int, v float64, littleEndian bool) *ResizableBuffer {
+	return b.InsertUint64(off, math.Float64bits(v), littleEndian)
+}
+
+// InsertUvarint inserts a uint64 as a variable length integer into the consumed buffer at the
+// offset given.
+func (b *ResizableBuffer) InsertUvarint(off int, v uint64) *ResizableBuffer {
+	return b.insertAt(off, UvarintSize(v), func(b []byte) {
+		binary.PutUvarint(b, v)
+	})
+}
+
+// InsertVarint inserts a int64 as a zigzag encoded variable length integer into the consumed
+// buffer at the offset given.
+func (b *ResizableBuffer) InsertVarint(off int, v int64) *ResizableBuffer {
+	return b.InsertUvarint(off, zigzag(v))
+}
+
+// DeleteRange removes the bytes from start up to but not including end from the consumed
+// buffer, moving everything after them back.
+func (b *ResizableBuffer) DeleteRange(start, end int) *ResizableBuffer {
+	if !b.inRange(start, end) {
+		return b
+	}
+	n := end - start
+	if n == 0 {
+		return b
+	}
+	b.dropped()
+	if start == 0 {
+		// Deleting from the front only needs the start moved up. This is a drain, so it cannot
+		// be followed by placeholders.
+		b.wipe(b.buffer[b.start : b.start+n])
+		b.start += n
+		b.offset -= n
+		b.lostEdits()
+		return b
+	}
+	b.edited(start, -n)
+	bufEnd := b.end()
+	copy(b.buffer[b.start+start:], b.buffer[b.start+end:bufEnd])
+	b.wipe(b.buffer[bufEnd-n : bufEnd])
+	b.offset -= n
+	return b
+}
+
+// Splice replaces the bytes from start up to but not including end with the bytes given,
+// growing or shrinking the consumed buffer to fit.
+func (b *ResizableBuffer) Splice(start, end int, v []byte) *ResizableBuffer {
+	if !b.inRange(start, end) {
+		return b
+	}
+	if n := end - start; len(v) > n {
+		b.insertAt(end, len(v)-n, func([]byte) {})
+	} else if len(v) < n {
+		b.DeleteRange(start+len(v), end)
+	}
+	if b.err == nil {
+		copy(b.buffer[b.start+start:], v)
+	}
+	return b
+}
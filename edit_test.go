@@ -0,0 +1,217 @@
+package safebuffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestInsert(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(b *ResizableBuffer, off int) *ResizableBuffer
+		eq   []byte
+	}{
+		{"bytes", func(b *ResizableBuffer, off int) *ResizableBuffer { return b.InsertBytes(off, []byte{1, 2}) }, []byte{1, 2}},
+		{"string", func(b *ResizableBuffer, off int) *ResizableBuffer { return b.InsertString(off, "ab") }, []byte("ab")},
+		{"byte", func(b *ResizableBuffer, off int) *ResizableBuffer { return b.InsertByte(off, 7) }, []byte{7}},
+		{"uint16", func(b *ResizableBuffer, off int) *ResizableBuffer { return b.InsertUint16(off, 0x0102, true) }, []byte{2, 1}},
+		{"uint32", func(b *ResizableBuffer, off int) *ResizableBuffer { return b.InsertUint32(off, 0x01020304, false) }, []byte{1, 2, 3, 4}},
+		{"uint64", func(b *ResizableBuffer, off int) *ResizableBuffer {
+			return b.InsertUint64(off, 0x0102030405060708, true)
+		}, []byte{8, 7, 6, 5, 4, 3, 2, 1}},
+		{"int16", func(b *ResizableBuffer, off int) *ResizableBuffer { return b.InsertInt16(off, -1, false) }, slowButKnownGoodValConv(int16(-1), false)},
+		{"int32", func(b *ResizableBuffer, off int) *ResizableBuffer { return b.InsertInt32(off, -1, true) }, slowButKnownGoodValConv(int32(-1), true)},
+		{"int64", func(b *ResizableBuffer, off int) *ResizableBuffer { return b.InsertInt64(off, -1, false) }, slowButKnownGoodValConv(int64(-1), false)},
+		{"float32", func(b *ResizableBuffer, off int) *ResizableBuffer { return b.InsertFloat32(off, 1.2, true) }, slowButKnownGoodValConv(float32(1.2), true)},
+		{"float64", func(b *ResizableBuffer, off int) *ResizableBuffer { return b.InsertFloat64(off, 1.2, false) }, slowButKnownGoodValConv(float64(1.2), false)},
+		{"uvarint", func(b *ResizableBuffer, off int) *ResizableBuffer { return b.InsertUvarint(off, 300) }, []byte{0xac, 0x02}},
+		{"varint", func(b *ResizableBuffer, off int) *ResizableBuffer { return b.InsertVarint(off, -2) }, []byte{3}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for _, off := range []int{0, 2, 5} {
+				for _, bigBuffer := range []bool{false, true} {
+					var buffer []byte
+					if bigBuffer {
+						buffer = make([]byte, 100)
+					}
+					rb := NewResizableBuffer(buffer).CopyString("cdefg").PrependString("ab")
+					if test.fn(rb, off) != rb {
+						t.Fatal("expected fn to return the buffer")
+					}
+					if rb.Err() != nil {
+						t.Fatalf("expected nil error, got %v", rb.Err())
+					}
+					src := []byte("abcdefg")
+					expected := append(append(append([]byte{}, src[:off]...), test.eq...), src[off:]...)
+					if !bytes.Equal(rb.Bytes(), expected) {
+						t.Fatalf("offset %d: expected %v, got %v", off, expected, rb.Bytes())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestInsertErrors(t *testing.T) {
+	t.Run("out of range", func(t *testing.T) {
+		for _, off := range []int{-1, 4} {
+			rb := NewResizableBuffer(nil).CopyString("abc")
+			rb.InsertByte(off, 'x')
+			if rb.Err() != ErrOutOfRange {
+				t.Fatalf("expected ErrOutOfRange, got %v", rb.Err())
+			}
+			if string(rb.Bytes()) != "abc" {
+				t.Fatalf("expected abc, got %q", rb.Bytes())
+			}
+		}
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(4).CopyString("abc")
+		rb.InsertUint16(1, 1, true)
+		if rb.Err() != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", rb.Err())
+		}
+		if string(rb.Bytes()) != "abc" {
+			t.Fatalf("expected abc, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("reuses capacity", func(t *testing.T) {
+		rb := NewResizableBuffer(make([]byte, 16)).CopyString("abcd")
+		first := &rb.buffer[0]
+		rb.InsertString(2, "xyz")
+		if &rb.buffer[0] != first {
+			t.Fatal("expected the buffer not to be reallocated")
+		}
+	})
+}
+
+func TestDeleteRange(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end int
+		eq         string
+	}{
+		{"front", 0, 3, "defgh"},
+		{"middle", 2, 5, "abfgh"},
+		{"back", 5, 8, "abcde"},
+		{"everything", 0, 8, ""},
+		{"nothing", 4, 4, "abcdefgh"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rb := NewResizableBuffer(nil).CopyString("abcdefgh")
+			if rb.DeleteRange(test.start, test.end) != rb {
+				t.Fatal("expected DeleteRange to return the buffer")
+			}
+			if string(rb.Bytes()) != test.eq || rb.Len() != len(test.eq) {
+				t.Fatalf("expected %q, got %q", test.eq, rb.Bytes())
+			}
+			rb.CopyString("!").PrependString("<")
+			if string(rb.Bytes()) != "<"+test.eq+"!" {
+				t.Fatalf("expected buffer to be usable after delete, got %q", rb.Bytes())
+			}
+		})
+	}
+
+	t.Run("out of range", func(t *testing.T) {
+		for _, r := range [][2]int{{-1, 2}, {3, 2}, {0, 9}} {
+			rb := NewResizableBuffer(nil).CopyString("abcdefgh")
+			rb.DeleteRange(r[0], r[1])
+			if rb.Err() != ErrOutOfRange {
+				t.Fatalf("%v: expected ErrOutOfRange, got %v", r, rb.Err())
+			}
+		}
+	})
+
+	t.Run("secure wipes shifted bytes", func(t *testing.T) {
+		for _, r := range [][2]int{{0, 6}, {2, 8}} {
+			rb := NewResizableBuffer(nil).WithSecureWipe().CopyString("secret").CopyString("ab")
+			rb.DeleteRange(r[0], r[1])
+			if bytes.Contains(rb.buffer, []byte("secret")) || bytes.Contains(rb.buffer[rb.end():], []byte("ab")) {
+				t.Fatalf("%v: expected deleted and shifted bytes to be wiped, got %v", r, rb.buffer)
+			}
+		}
+	})
+}
+
+func TestSplice(t *testing.T) {
+	tests := []struct {
+		name       string
+		start, end int
+		repl       string
+		eq         string
+	}{
+		{"same length", 2, 4, "XY", "abXYefgh"},
+		{"longer", 2, 4, "XYZW", "abXYZWefgh"},
+		{"shorter", 2, 6, "X", "abXgh"},
+		{"empty", 2, 6, "", "abgh"},
+		{"front", 0, 0, "<<", "<<abcdefgh"},
+		{"back", 8, 8, ">>", "abcdefgh>>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rb := NewResizableBuffer(nil).CopyString("abcdefgh")
+			if rb.Splice(test.start, test.end, []byte(test.repl)) != rb {
+				t.Fatal("expected Splice to return the buffer")
+			}
+			if rb.Err() != nil {
+				t.Fatalf("expected nil error, got %v", rb.Err())
+			}
+			if string(rb.Bytes()) != test.eq {
+				t.Fatalf("expected %q, got %q", test.eq, rb.Bytes())
+			}
+		})
+	}
+
+	t.Run("max size", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(9).CopyString("abcdefgh")
+		rb.Splice(2, 4, []byte("XYZW"))
+		if rb.Err() != ErrTooLarge || string(rb.Bytes()) != "abcdefgh" {
+			t.Fatalf("expected ErrTooLarge and no change, got %v and %q", rb.Err(), rb.Bytes())
+		}
+	})
+}
+
+func TestDeletedFrontIsReused(t *testing.T) {
+	t.Run("slides back", func(t *testing.T) {
+		rb := NewResizableBuffer(make([]byte, 16)).CopyString("0123456789abcdef")
+		first := &rb.buffer[0]
+		rb.DeleteRange(0, 10).CopyString("ghijklmnop")
+		if &rb.buffer[0] != first {
+			t.Fatal("expected the buffer not to be reallocated")
+		}
+		if string(rb.Bytes()) != "abcdefghijklmnop" {
+			t.Fatalf("expected abcdefghijklmnop, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("not slid under sub-buffers", func(t *testing.T) {
+		rb := NewResizableBuffer(make([]byte, 16)).CopyString("0123456789")
+		rb.DeleteRange(0, 6)
+		sub := rb.SubBuffer(4)
+		rb.CopyString("abcd")
+		sub.CopyString("WXYZ")
+		if string(rb.Bytes()) != "6789\x00\x00\x00\x00abcd" {
+			t.Fatalf("expected the sub-buffer not to overwrite the buffer, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("dropped on reallocation", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithGrowthPolicy(ExactGrowth).WithHeadroom(2)
+		rb.CopyBytes(make([]byte, 100)).DeleteRange(0, 98).CopyBytes(make([]byte, 101))
+		if len(rb.buffer) != 105 || rb.start != 2 {
+			t.Fatalf("expected a 105 byte buffer starting at 2, got %d starting at %d", len(rb.buffer), rb.start)
+		}
+	})
+
+	t.Run("secure", func(t *testing.T) {
+		rb := NewResizableBuffer(make([]byte, 16)).WithSecureWipe().CopyString("0123456789secret")
+		rb.DeleteRange(0, 10).CopyString("abcdef")
+		if string(rb.Bytes()) != "secretabcdef" || !bytes.Equal(rb.buffer[12:], make([]byte, 4)) {
+			t.Fatalf("expected the stale tail to be wiped, got %q", rb.buffer)
+		}
+	})
+}
@@ -0,0 +1,395 @@
+package flatbuffers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// Builder builds a FlatBuffer back to front by prepending into a ResizableBuffer, which
+// should be empty. Children must be finished before the objects that refer to them, so
+// strings, vectors and sub-tables are created first and their offsets added to the table
+// afterwards. Only one table or vector can be built at a time, and starting another one
+// before it has ended panics. Errors come from the buffer and are sticky, so they can be
+// checked once at the end with Err. This is single threaded.
+type Builder struct {
+	b        *safebuffer.ResizableBuffer
+	minAlign int
+
+	// vtable holds where each field of the table being built was written, or 0 if it was not.
+	// objectEnd is the offset the table started from.
+	vtable    []UOffset
+	objectEnd UOffset
+	inTable   bool
+
+	inVector  bool
+	vectorLen int
+
+	// vtables holds every vtable written so far, so that tables with the same layout share one.
+	vtables []UOffset
+	scratch []byte
+}
+
+// NewBuilder creates a new Builder that prepends into the buffer given.
+func NewBuilder(b *safebuffer.ResizableBuffer) *Builder {
+	return &Builder{b: b, minAlign: 1}
+}
+
+// Err returns the error held by the buffer.
+func (bl *Builder) Err() error {
+	return bl.b.Err()
+}
+
+// Offset returns the offset of whatever was written last.
+func (bl *Builder) Offset() UOffset {
+	return UOffset(bl.b.Len())
+}
+
+func (bl *Builder) notNested() {
+	if bl.inTable || bl.inVector {
+		panic("flatbuffers: objects cannot be created while a table or vector is being built")
+	}
+}
+
+// Pad prepends n zero bytes.
+func (bl *Builder) Pad(n int) {
+	for i := 0; i < n; i++ {
+		bl.b.PrependByte(0)
+	}
+}
+
+// Prep pads the buffer so that once additional more bytes are written, the next write is
+// aligned to size bytes. size must be a power of two.
+func (bl *Builder) Prep(size, additional int) {
+	if size > bl.minAlign {
+		bl.minAlign = size
+	}
+	bl.Pad(-(bl.b.Len() + additional) & (size - 1))
+}
+
+// PrependBool prepends a bool as a single byte.
+func (bl *Builder) PrependBool(v bool) {
+	if v {
+		bl.PrependUint8(1)
+	} else {
+		bl.PrependUint8(0)
+	}
+}
+
+// PrependUint8 prepends a uint8.
+func (bl *Builder) PrependUint8(v uint8) {
+	bl.Prep(1, 0)
+	bl.b.PrependByte(v)
+}
+
+// PrependInt8 prepends an int8.
+func (bl *Builder) PrependInt8(v int8) {
+	bl.PrependUint8(uint8(v))
+}
+
+// PrependUint16 prepends a uint16, aligned to 2 bytes.
+func (bl *Builder) PrependUint16(v uint16) {
+	bl.Prep(2, 0)
+	bl.b.PrependUint16(v, true)
+}
+
+// PrependInt16 prepends an int16, aligned to 2 bytes.
+func (bl *Builder) PrependInt16(v int16) {
+	bl.PrependUint16(uint16(v))
+}
+
+// PrependUint32 prepends a uint32, aligned to 4 bytes.
+func (bl *Builder) PrependUint32(v uint32) {
+	bl.Prep(4, 0)
+	bl.b.PrependUint32(v, true)
+}
+
+// PrependInt32 prepends an int32, aligned to 4 bytes.
+func (bl *Builder) PrependInt32(v int32) {
+	bl.PrependUint32(uint32(v))
+}
+
+// PrependUint64 prepends a uint64, aligned to 8 bytes.
+func (bl *Builder) PrependUint64(v uint64) {
+	bl.Prep(8, 0)
+	bl.b.PrependUint64(v, true)
+}
+
+// PrependInt64 prepends an int64, aligned to 8 bytes.
+func (bl *Builder) PrependInt64(v int64) {
+	bl.PrependUint64(uint64(v))
+}
+
+// PrependFloat32 prepends a float32, aligned to 4 bytes.
+func (bl *Builder) PrependFloat32(v float32) {
+	bl.PrependUint32(math.Float32bits(v))
+}
+
+// PrependFloat64 prepends a float64, aligned to 8 bytes.
+func (bl *Builder) PrependFloat64(v float64) {
+	bl.PrependUint64(math.Float64bits(v))
+}
+
+// PrependUOffset prepends a reference to an object that has already been written.
+func (bl *Builder) PrependUOffset(off UOffset) {
+	bl.Prep(sizeUOffset, 0)
+	if off > bl.Offset() {
+		panic("flatbuffers: offset refers to an object that has not been written")
+	}
+	bl.b.PrependUint32(uint32(bl.Offset()-off+sizeUOffset), true)
+}
+
+// CreateString writes a string and returns its offset.
+func (bl *Builder) CreateString(s string) UOffset {
+	bl.notNested()
+	bl.Prep(sizeUOffset, len(s)+1)
+	bl.b.PrependByte(0).PrependString(s).PrependUint32(uint32(len(s)), true)
+	return bl.Offset()
+}
+
+// CreateByteString writes a string from a byte slice and returns its offset.
+func (bl *Builder) CreateByteString(p []byte) UOffset {
+	bl.notNested()
+	bl.Prep(sizeUOffset, len(p)+1)
+	bl.b.PrependByte(0).PrependBytes(p).PrependUint32(uint32(len(p)), true)
+	return bl.Offset()
+}
+
+// CreateByteVector writes a vector of bytes and returns its offset.
+func (bl *Builder) CreateByteVector(p []byte) UOffset {
+	bl.notNested()
+	bl.Prep(sizeUOffset, len(p))
+	bl.b.PrependBytes(p).PrependUint32(uint32(len(p)), true)
+	return bl.Offset()
+}
+
+// StartVector starts a vector of n elements of elemSize bytes each, aligned to alignment
+// bytes. Prepend the elements last to first, and then call EndVector.
+func (bl *Builder) StartVector(elemSize, n, alignment int) {
+	bl.notNested()
+	bl.inVector = true
+	bl.vectorLen = n
+	bl.Prep(sizeUOffset, elemSize*n)
+	bl.Prep(alignment, elemSize*n)
+}
+
+// EndVector ends the vector being built and returns its offset.
+func (bl *Builder) EndVector() UOffset {
+	if !bl.inVector {
+		panic("flatbuffers: EndVector called without a vector to end")
+	}
+	bl.inVector = false
+	bl.PrependUint32(uint32(bl.vectorLen))
+	return bl.Offset()
+}
+
+// StartTable starts a table with room for numFields fields. Add its fields, and then call
+// EndTable.
+func (bl *Builder) StartTable(numFields int) {
+	bl.notNested()
+	bl.inTable = true
+	bl.vtable = append(bl.vtable[:0], make([]UOffset, numFields)...)
+	bl.objectEnd = bl.Offset()
+}
+
+// Slot marks whatever was written last as the field of the table being built in the slot
+// given. The Add methods call this for you.
+func (bl *Builder) Slot(slot int) {
+	if !bl.inTable {
+		panic("flatbuffers: fields can only be added while a table is being built")
+	}
+	if slot < 0 || slot >= len(bl.vtable) {
+		panic("flatbuffers: slot out of range for the table being built")
+	}
+	bl.vtable[slot] = bl.Offset()
+}
+
+// AddBool adds a bool field to the table being built, unless it is the default.
+func (bl *Builder) AddBool(slot int, v, def bool) {
+	if v != def {
+		bl.PrependBool(v)
+		bl.Slot(slot)
+	}
+}
+
+// AddUint8 adds a uint8 field to the table being built, unless it is the default.
+func (bl *Builder) AddUint8(slot int, v, def uint8) {
+	if v != def {
+		bl.PrependUint8(v)
+		bl.Slot(slot)
+	}
+}
+
+// AddInt8 adds an int8 field to the table being built, unless it is the default.
+func (bl *Builder) AddInt8(slot int, v, def int8) {
+	if v != def {
+		bl.PrependInt8(v)
+		bl.Slot(slot)
+	}
+}
+
+// AddUint16 adds a uint16 field to the table being built, unless it is the default.
+func (bl *Builder) AddUint16(slot int, v, def uint16) {
+	if v != def {
+		bl.PrependUint16(v)
+		bl.Slot(slot)
+	}
+}
+
+// AddInt16 adds an int16 field to the table being built, unless it is the default.
+func (bl *Builder) AddInt16(slot int, v, def int16) {
+	if v != def {
+		bl.PrependInt16(v)
+		bl.Slot(slot)
+	}
+}
+
+// AddUint32 adds a uint32 field to the table being built, unless it is the default.
+func (bl *Builder) AddUint32(slot int, v, def uint32) {
+	if v != def {
+		bl.PrependUint32(v)
+		bl.Slot(slot)
+	}
+}
+
+// AddInt32 adds an int32 field to the table being built, unless it is the default.
+func (bl *Builder) AddInt32(slot int, v, def int32) {
+	if v != def {
+		bl.PrependInt32(v)
+		bl.Slot(slot)
+	}
+}
+
+// AddUint64 adds a uint64 field to the table being built, unless it is the default.
+func (bl *Builder) AddUint64(slot int, v, def uint64) {
+	if v != def {
+		bl.PrependUint64(v)
+		bl.Slot(slot)
+	}
+}
+
+// AddInt64 adds an int64 field to the table being built, unless it is the default.
+func (bl *Builder) AddInt64(slot int, v, def int64) {
+	if v != def {
+		bl.PrependInt64(v)
+		bl.Slot(slot)
+	}
+}
+
+// AddFloat32 adds a float32 field to the table being built, unless it is the default.
+func (bl *Builder) AddFloat32(slot int, v, def float32) {
+	if v != def {
+		bl.PrependFloat32(v)
+		bl.Slot(slot)
+	}
+}
+
+// AddFloat64 adds a float64 field to the table being built, unless it is the default.
+func (bl *Builder) AddFloat64(slot int, v, def float64) {
+	if v != def {
+		bl.PrependFloat64(v)
+		bl.Slot(slot)
+	}
+}
+
+// AddOffset adds a reference to a string, vector or table to the table being built, unless
+// the offset is 0.
+func (bl *Builder) AddOffset(slot int, off UOffset) {
+	if off != 0 {
+		bl.PrependUOffset(off)
+		bl.Slot(slot)
+	}
+}
+
+// AddStruct adds a struct field to the table being built. Structs are stored inline, so it
+// must have been prepended straight before this is called, and off must be its offset.
+func (bl *Builder) AddStruct(slot int, off UOffset) {
+	if off == 0 {
+		return
+	}
+	if off != bl.Offset() {
+		panic("flatbuffers: structs must be prepended straight before they are added")
+	}
+	bl.Slot(slot)
+}
+
+// AddUnion adds a union field to the table being built. A union takes two slots, the type in
+// typeSlot and the value in the slot after it. A type of 0 means the union is not set.
+func (bl *Builder) AddUnion(typeSlot int, typ uint8, value UOffset) {
+	if typ == 0 {
+		return
+	}
+	bl.AddUint8(typeSlot, typ, 0)
+	bl.AddOffset(typeSlot+1, value)
+}
+
+// EndTable ends the table being built, writes its vtable, and returns its offset. If a table
+// with the same layout was already written, its vtable is shared instead.
+func (bl *Builder) EndTable() UOffset {
+	if !bl.inTable {
+		panic("flatbuffers: EndTable called without a table to end")
+	}
+
+	// The table starts with a signed offset to its vtable, which is filled in once the
+	// vtable's position is known.
+	bl.PrependInt32(0)
+	object := bl.Offset()
+	bl.inTable = false
+
+	n := len(bl.vtable)
+	for n > 0 && bl.vtable[n-1] == 0 {
+		n--
+	}
+	if object-bl.objectEnd > math.MaxUint16 {
+		panic("flatbuffers: table is too large for its vtable")
+	}
+	vt := binary.LittleEndian.AppendUint16(bl.scratch[:0], uint16(vtableHeader+n*sizeVOffset))
+	vt = binary.LittleEndian.AppendUint16(vt, uint16(object-bl.objectEnd))
+	for _, off := range bl.vtable[:n] {
+		if off != 0 {
+			off = object - off
+		}
+		vt = binary.LittleEndian.AppendUint16(vt, uint16(off))
+	}
+	bl.scratch = vt
+	if bl.b.Err() != nil {
+		return 0
+	}
+
+	data := bl.b.Bytes()
+	for _, existing := range bl.vtables {
+		pos := len(data) - int(existing)
+		if pos+len(vt) <= len(data) && bytes.Equal(data[pos:pos+len(vt)], vt) {
+			bl.b.PutUint32At(len(data)-int(object), uint32(int32(existing)-int32(object)), true)
+			return object
+		}
+	}
+
+	bl.b.PrependBytes(vt)
+	existing := bl.Offset()
+	bl.vtables = append(bl.vtables, existing)
+	bl.b.PutUint32At(bl.b.Len()-int(object), uint32(existing-object), true)
+	return object
+}
+
+// Finish writes the offset of the root table at the front of the buffer, padded so that
+// everything in the buffer is aligned.
+func (bl *Builder) Finish(root UOffset) {
+	bl.notNested()
+	bl.Prep(bl.minAlign, sizeUOffset)
+	bl.PrependUOffset(root)
+}
+
+// FinishWithIdentifier is like Finish, but also writes a 4 byte file identifier after the
+// root offset.
+func (bl *Builder) FinishWithIdentifier(root UOffset, id string) {
+	if len(id) != fileIdentifierLength {
+		panic("flatbuffers: file identifiers must be 4 bytes")
+	}
+	bl.notNested()
+	bl.Prep(bl.minAlign, sizeUOffset+fileIdentifierLength)
+	bl.b.PrependString(id)
+	bl.PrependUOffset(root)
+}
@@ -0,0 +1,25 @@
+// Package flatbuffers builds FlatBuffers back to front on top of the prepend operations of
+// safebuffer.ResizableBuffer, and reads them back without the generated code from flatc.
+// Tables, vtables, vectors, strings, structs and unions are supported. Every read is checked
+// against the bounds of the data, so malformed input gives an error instead of a panic.
+package flatbuffers
+
+import "errors"
+
+// ErrInvalid is returned when an offset, vtable, string or vector points outside of the data
+// being read or is not aligned.
+var ErrInvalid = errors.New("flatbuffers: invalid data")
+
+// UOffset is the position of an object written by a Builder, counted back from the end of
+// the buffer. Objects do not move once written, so this stays valid as more is prepended. 0
+// means no object.
+type UOffset uint32
+
+const (
+	sizeUOffset          = 4
+	sizeVOffset          = 2
+	fileIdentifierLength = 4
+
+	// vtableHeader is the size of the vtable length and table size at the start of a vtable.
+	vtableHeader = 2 * sizeVOffset
+)
@@ -0,0 +1,476 @@
+package flatbuffers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+func TestByteLayout(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(bl *Builder)
+		eq   []byte
+	}{
+		{
+			"byte vector",
+			func(bl *Builder) {
+				bl.StartVector(1, 1, 1)
+				bl.PrependUint8(1)
+				bl.EndVector()
+			},
+			[]byte{1, 0, 0, 0, 1, 0, 0, 0},
+		},
+		{
+			"uint16 vector",
+			func(bl *Builder) {
+				bl.StartVector(2, 2, 2)
+				bl.PrependUint16(0xabcd)
+				bl.PrependUint16(0xdead)
+				bl.EndVector()
+			},
+			[]byte{2, 0, 0, 0, 0xad, 0xde, 0xcd, 0xab},
+		},
+		{
+			"strings",
+			func(bl *Builder) {
+				bl.CreateString("foo")
+				bl.CreateString("moop")
+			},
+			[]byte{4, 0, 0, 0, 'm', 'o', 'o', 'p', 0, 0, 0, 0, 3, 0, 0, 0, 'f', 'o', 'o', 0},
+		},
+		{
+			"byte vector with padding",
+			func(bl *Builder) {
+				bl.PrependUint8(9)
+				bl.CreateByteVector([]byte{1, 2})
+			},
+			[]byte{2, 0, 0, 0, 1, 2, 0, 9},
+		},
+		{
+			"empty table",
+			func(bl *Builder) {
+				bl.StartTable(0)
+				bl.EndTable()
+			},
+			[]byte{4, 0, 4, 0, 4, 0, 0, 0},
+		},
+		{
+			"table with a bool",
+			func(bl *Builder) {
+				bl.StartTable(1)
+				bl.AddBool(0, true, false)
+				bl.EndTable()
+			},
+			[]byte{6, 0, 8, 0, 7, 0, 6, 0, 0, 0, 0, 0, 0, 1},
+		},
+		{
+			"table with a default",
+			func(bl *Builder) {
+				bl.StartTable(2)
+				bl.AddBool(1, false, false)
+				bl.EndTable()
+			},
+			[]byte{4, 0, 4, 0, 4, 0, 0, 0},
+		},
+		{
+			"table with an int16 and a uint8",
+			func(bl *Builder) {
+				bl.StartTable(2)
+				bl.AddInt16(0, 0x3456, 0)
+				bl.AddUint8(1, 0x12, 0)
+				bl.EndTable()
+			},
+			[]byte{8, 0, 8, 0, 6, 0, 5, 0, 8, 0, 0, 0, 0, 0x12, 0x56, 0x34},
+		},
+		{
+			"finished",
+			func(bl *Builder) {
+				bl.StartTable(1)
+				bl.AddInt64(0, 1, 0)
+				bl.Finish(bl.EndTable())
+			},
+			[]byte{
+				12, 0, 0, 0, // root offset
+				0, 0, // padding
+				6, 0, 12, 0, 4, 0, // vtable
+				6, 0, 0, 0, // table
+				1, 0, 0, 0, 0, 0, 0, 0,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := safebuffer.NewResizableBuffer(nil)
+			test.fn(NewBuilder(b))
+			if !bytes.Equal(b.Bytes(), test.eq) {
+				t.Fatalf("expected %v, got %v", test.eq, b.Bytes())
+			}
+		})
+	}
+}
+
+// The slots of the tables built by buildMonster.
+const (
+	monsterName = iota
+	monsterHP
+	monsterPos
+	monsterInventory
+	monsterWeapons
+	monsterEquippedType
+	monsterEquipped
+	monsterSpeed
+	monsterID
+
+	weaponName   = 0
+	weaponDamage = 1
+)
+
+func buildMonster(b *safebuffer.ResizableBuffer) {
+	bl := NewBuilder(b)
+
+	weapon := func(name string, damage int16) UOffset {
+		n := bl.CreateString(name)
+		bl.StartTable(2)
+		bl.AddOffset(weaponName, n)
+		bl.AddInt16(weaponDamage, damage, 0)
+		return bl.EndTable()
+	}
+	sword := weapon("Sword", 3)
+	axe := weapon("Axe", 5)
+
+	name := bl.CreateString("Orc")
+	inventory := bl.CreateByteVector([]byte{0, 1, 2, 3, 4})
+	bl.StartVector(4, 2, 4)
+	bl.PrependUOffset(axe)
+	bl.PrependUOffset(sword)
+	weapons := bl.EndVector()
+
+	bl.StartTable(9)
+	bl.AddFloat64(monsterSpeed, 2.5, 0)
+	bl.AddInt64(monsterID, math.MinInt64, 0)
+	bl.AddOffset(monsterName, name)
+	bl.AddOffset(monsterInventory, inventory)
+	bl.AddOffset(monsterWeapons, weapons)
+	bl.AddUnion(monsterEquippedType, 1, axe)
+	bl.AddInt16(monsterHP, 300, 100)
+
+	// A Vec3 struct of three float32s.
+	bl.Prep(4, 12)
+	bl.PrependFloat32(3)
+	bl.PrependFloat32(2)
+	bl.PrependFloat32(1)
+	bl.AddStruct(monsterPos, bl.Offset())
+
+	bl.FinishWithIdentifier(bl.EndTable(), "MONS")
+	if bl.Err() != nil {
+		panic(bl.Err())
+	}
+}
+
+// readMonster reads back everything written by buildMonster, returning the first error.
+func readMonster(buf []byte) (string, error) {
+	var out bytes.Buffer
+	root, err := GetRoot(buf)
+	if err != nil {
+		return "", err
+	}
+	name, err := root.String(monsterName)
+	if err != nil {
+		return "", err
+	}
+	out.WriteString(name)
+	hp, err := root.Int16(monsterHP, 100)
+	if err != nil {
+		return "", err
+	}
+	out.WriteString(" " + string(rune('0'+hp/100)))
+	pos, err := root.Struct(monsterPos, 12)
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < len(pos); i += 4 {
+		out.WriteByte(' ')
+		out.WriteByte(byte('0' + math.Float32frombits(binary.LittleEndian.Uint32(pos[i:]))))
+	}
+	inventory, err := root.Vector(monsterInventory, 1)
+	if err != nil {
+		return "", err
+	}
+	out.WriteString(" inventory")
+	for _, v := range inventory.Bytes() {
+		out.WriteByte('0' + v)
+	}
+	weapons, err := root.Vector(monsterWeapons, 4)
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < weapons.Len(); i++ {
+		w, err := weapons.Table(i)
+		if err != nil {
+			return "", err
+		}
+		name, err := w.String(weaponName)
+		if err != nil {
+			return "", err
+		}
+		damage, err := w.Int16(weaponDamage, 0)
+		if err != nil {
+			return "", err
+		}
+		out.WriteString(" " + name + string(rune('0'+damage)))
+	}
+	typ, equipped, err := root.Union(monsterEquippedType)
+	if err != nil {
+		return "", err
+	}
+	name, err = equipped.String(weaponName)
+	if err != nil {
+		return "", err
+	}
+	out.WriteString(" equipped" + string(rune('0'+typ)) + name)
+	speed, err := root.Float64(monsterSpeed, 0)
+	if err != nil {
+		return "", err
+	}
+	id, err := root.Int64(monsterID, 0)
+	if err != nil {
+		return "", err
+	}
+	if speed != 2.5 || id != math.MinInt64 {
+		out.WriteString(" bad scalars")
+	}
+	return out.String(), nil
+}
+
+func TestRoundTrip(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	buildMonster(b)
+	buf := b.Bytes()
+
+	if len(buf)%8 != 0 {
+		t.Fatalf("expected the buffer to be a multiple of the largest alignment, got %d bytes", len(buf))
+	}
+	if !HasIdentifier(buf, "MONS") || HasIdentifier(buf, "NOPE") {
+		t.Fatal("expected the file identifier to be MONS")
+	}
+	s, err := readMonster(buf)
+	expected := "Orc 3 1 2 3 inventory01234 Sword3 Axe5 equipped1Axe"
+	if err != nil || s != expected {
+		t.Fatalf("expected %q, got %q, %v", expected, s, err)
+	}
+
+	root, _ := GetRoot(buf)
+	if _, ok, err := root.Table(monsterName + 20); ok || err != nil {
+		t.Fatalf("expected a missing slot to not be present, got %v, %v", ok, err)
+	}
+	if v, err := root.Uint32(9, 7); err != nil || v != 7 {
+		t.Fatalf("expected a slot past the vtable to give the default, got %d, %v", v, err)
+	}
+	if !root.Has(monsterHP) || root.Has(9) {
+		t.Fatal("expected Has to match the fields written")
+	}
+}
+
+func TestVtableDeduplication(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	bl := NewBuilder(b)
+	build := func(v int32) UOffset {
+		bl.StartTable(2)
+		bl.AddInt32(1, v, 0)
+		return bl.EndTable()
+	}
+	first := build(1)
+	size := b.Len()
+	second := build(2)
+	if b.Len()-size != 8 {
+		t.Fatalf("expected the second table to share the vtable and take 8 bytes, took %d", b.Len()-size)
+	}
+	bl.StartTable(2)
+	bl.AddInt32(0, 3, 0)
+	third := bl.EndTable()
+	if len(bl.vtables) != 2 {
+		t.Fatalf("expected a different layout to get its own vtable, got %d vtables", len(bl.vtables))
+	}
+
+	bl.StartVector(4, 3, 4)
+	bl.PrependUOffset(third)
+	bl.PrependUOffset(second)
+	bl.PrependUOffset(first)
+	tables := bl.EndVector()
+	bl.StartTable(1)
+	bl.AddOffset(0, tables)
+	bl.Finish(bl.EndTable())
+
+	root, err := GetRoot(b.Bytes())
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	v, err := root.Vector(0, 4)
+	if err != nil || v.Len() != 3 {
+		t.Fatalf("expected 3 tables, got %d, %v", v.Len(), err)
+	}
+	for i, expected := range [][2]int32{{0, 1}, {0, 2}, {3, 0}} {
+		tbl, err := v.Table(i)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		a, _ := tbl.Int32(0, 0)
+		c, _ := tbl.Int32(1, 0)
+		if a != expected[0] || c != expected[1] {
+			t.Fatalf("table %d: expected %v, got [%d %d]", i, expected, a, c)
+		}
+	}
+}
+
+func TestLargeBuild(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	bl := NewBuilder(b)
+	const n = 10000
+	offsets := make([]UOffset, n)
+	for i := range offsets {
+		offsets[i] = bl.CreateString("entry")
+	}
+	bl.StartVector(4, n, 4)
+	for i := n - 1; i >= 0; i-- {
+		bl.PrependUOffset(offsets[i])
+	}
+	strs := bl.EndVector()
+	bl.StartTable(1)
+	bl.AddOffset(0, strs)
+	bl.Finish(bl.EndTable())
+
+	root, _ := GetRoot(b.Bytes())
+	v, err := root.Vector(0, 4)
+	if err != nil || v.Len() != n {
+		t.Fatalf("expected %d strings, got %d, %v", n, v.Len(), err)
+	}
+	if s, err := v.String(n - 1); err != nil || s != "entry" {
+		t.Fatalf("expected entry, got %q, %v", s, err)
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	buildMonster(b)
+	valid := b.Bytes()
+
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		{"empty", nil},
+		{"root offset out of range", []byte{8, 0, 0, 0}},
+		{"misaligned table", []byte{5, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{"vtable out of range", []byte{4, 0, 0, 0, 0xf0, 0xff, 0xff, 0xff}},
+		{"vtable before the start", []byte{4, 0, 0, 0, 8, 0, 0, 0}},
+		{"table larger than the data", []byte{8, 0, 0, 0, 4, 0, 64, 0, 4, 0, 0, 0}},
+		{"vtable too short", []byte{8, 0, 0, 0, 2, 0, 4, 0, 4, 0, 0, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := GetRoot(test.buf); err != ErrInvalid {
+				t.Fatalf("expected ErrInvalid, got %v", err)
+			}
+		})
+	}
+
+	t.Run("field outside of the table", func(t *testing.T) {
+		buf := []byte{12, 0, 0, 0, 6, 0, 6, 0, 4, 0, 0, 0, 8, 0, 0, 0, 0x34, 0x12}
+		root, err := GetRoot(buf)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if _, err := root.Uint32(0, 0); err != ErrInvalid {
+			t.Fatalf("expected ErrInvalid, got %v", err)
+		}
+		if v, err := root.Uint16(0, 0); err != nil || v != 0x1234 {
+			t.Fatalf("expected a field that fits to be read, got %d, %v", v, err)
+		}
+	})
+
+	t.Run("string without a terminator", func(t *testing.T) {
+		buf := bytes.Clone(valid)
+		i := bytes.Index(buf, []byte("Orc\x00"))
+		buf[i+3] = 'x'
+		if _, err := readMonster(buf); err != ErrInvalid {
+			t.Fatalf("expected ErrInvalid, got %v", err)
+		}
+	})
+
+	t.Run("vector too long", func(t *testing.T) {
+		buf := bytes.Clone(valid)
+		i := bytes.Index(buf, []byte{5, 0, 0, 0, 0, 1, 2, 3, 4})
+		buf[i+3] = 0x7f
+		if _, err := readMonster(buf); err != ErrInvalid {
+			t.Fatalf("expected ErrInvalid, got %v", err)
+		}
+	})
+
+	// Truncating or corrupting any byte must never panic.
+	for i := range valid {
+		readMonster(valid[:i])
+		for _, v := range []byte{0, 0x7f, 0x80, 0xff} {
+			buf := bytes.Clone(valid)
+			buf[i] = v
+			readMonster(buf)
+		}
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	t.Run("buffer error", func(t *testing.T) {
+		b := safebuffer.NewResizableBuffer(nil).WithMaxSize(16)
+		bl := NewBuilder(b)
+		name := bl.CreateString("a string that is far too long")
+		bl.StartTable(1)
+		bl.AddOffset(0, name)
+		bl.Finish(bl.EndTable())
+		if bl.Err() != safebuffer.ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", bl.Err())
+		}
+	})
+
+	panics := []struct {
+		name string
+		fn   func(bl *Builder)
+	}{
+		{"string in a table", func(bl *Builder) { bl.StartTable(1); bl.CreateString("a") }},
+		{"table in a vector", func(bl *Builder) { bl.StartVector(4, 1, 4); bl.StartTable(1) }},
+		{"end vector without start", func(bl *Builder) { bl.EndVector() }},
+		{"end table without start", func(bl *Builder) { bl.EndTable() }},
+		{"add outside a table", func(bl *Builder) { bl.AddInt32(0, 1, 0) }},
+		{"slot out of range", func(bl *Builder) { bl.StartTable(1); bl.AddInt32(1, 1, 0) }},
+		{"struct not inline", func(bl *Builder) {
+			bl.PrependUint32(1)
+			off := bl.Offset()
+			bl.StartTable(2)
+			bl.AddInt32(0, 1, 0)
+			bl.AddStruct(1, off)
+		}},
+		{"offset not written yet", func(bl *Builder) { bl.PrependUOffset(100) }},
+		{"bad identifier", func(bl *Builder) { bl.FinishWithIdentifier(0, "TOOLONG") }},
+	}
+	for _, test := range panics {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+			test.fn(NewBuilder(safebuffer.NewResizableBuffer(nil)))
+		})
+	}
+
+	t.Run("vector index", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic")
+			}
+		}()
+		Vector{}.Element(0)
+	})
+}
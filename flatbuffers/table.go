@@ -0,0 +1,338 @@
+package flatbuffers
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// uoffset reads the offset at pos and returns the position it refers to.
+func uoffset(buf []byte, pos int) (int, error) {
+	if pos < 0 || pos%sizeUOffset != 0 || pos+sizeUOffset > len(buf) {
+		return 0, ErrInvalid
+	}
+	target := uint64(pos) + uint64(binary.LittleEndian.Uint32(buf[pos:]))
+	if target >= uint64(len(buf)) {
+		return 0, ErrInvalid
+	}
+	return int(target), nil
+}
+
+// vector checks the vector at pos and returns where its elements start and how many there
+// are.
+func vector(buf []byte, pos, elemSize int) (int, int, error) {
+	if pos%sizeUOffset != 0 || pos+sizeUOffset > len(buf) {
+		return 0, 0, ErrInvalid
+	}
+	n := binary.LittleEndian.Uint32(buf[pos:])
+	start := pos + sizeUOffset
+	if uint64(n)*uint64(elemSize) > uint64(len(buf)-start) {
+		return 0, 0, ErrInvalid
+	}
+	return start, int(n), nil
+}
+
+// str checks the string at pos and returns its contents.
+func str(buf []byte, pos int) ([]byte, error) {
+	start, n, err := vector(buf, pos, 1)
+	if err != nil {
+		return nil, err
+	}
+	if start+n >= len(buf) || buf[start+n] != 0 {
+		return nil, ErrInvalid
+	}
+	return buf[start : start+n], nil
+}
+
+// GetRoot returns the root table of a finished buffer.
+func GetRoot(buf []byte) (Table, error) {
+	pos, err := uoffset(buf, 0)
+	if err != nil {
+		return Table{}, err
+	}
+	return table(buf, pos)
+}
+
+// HasIdentifier reports whether a finished buffer has the file identifier given.
+func HasIdentifier(buf []byte, id string) bool {
+	return len(buf) >= sizeUOffset+fileIdentifierLength &&
+		string(buf[sizeUOffset:sizeUOffset+fileIdentifierLength]) == id
+}
+
+// Table is a table being read. The zero value is a table with no fields. Fields are looked up
+// by their slot, and fields that are not present give the default passed in.
+type Table struct {
+	buf    []byte
+	pos    int
+	vtable int
+	vlen   int
+	size   int
+}
+
+// table checks the table at pos and its vtable.
+func table(buf []byte, pos int) (Table, error) {
+	if pos%sizeUOffset != 0 || pos+sizeUOffset > len(buf) {
+		return Table{}, ErrInvalid
+	}
+	vt := int64(pos) - int64(int32(binary.LittleEndian.Uint32(buf[pos:])))
+	if vt < 0 || vt%sizeVOffset != 0 || vt+vtableHeader > int64(len(buf)) {
+		return Table{}, ErrInvalid
+	}
+	vlen := int(binary.LittleEndian.Uint16(buf[vt:]))
+	size := int(binary.LittleEndian.Uint16(buf[vt+sizeVOffset:]))
+	if vlen < vtableHeader || vlen%sizeVOffset != 0 || int(vt)+vlen > len(buf) ||
+		size < sizeUOffset || pos+size > len(buf) {
+		return Table{}, ErrInvalid
+	}
+	return Table{buf: buf, pos: pos, vtable: int(vt), vlen: vlen, size: size}, nil
+}
+
+// field returns where the field in the slot given starts, or -1 if it is not present. width
+// is how many bytes the field must have within the table.
+func (t Table) field(slot, width int) (int, error) {
+	entry := vtableHeader + slot*sizeVOffset
+	if slot < 0 || entry >= t.vlen {
+		return -1, nil
+	}
+	off := int(binary.LittleEndian.Uint16(t.buf[t.vtable+entry:]))
+	if off == 0 {
+		return -1, nil
+	}
+	if off < sizeUOffset || off+width > t.size {
+		return -1, ErrInvalid
+	}
+	return t.pos + off, nil
+}
+
+// scalar returns the bytes of the scalar field in the slot given, or nil if it is not present.
+func (t Table) scalar(slot, width int) ([]byte, error) {
+	pos, err := t.field(slot, width)
+	if pos < 0 {
+		return nil, err
+	}
+	return t.buf[pos : pos+width], nil
+}
+
+// Has reports whether the field in the slot given is present.
+func (t Table) Has(slot int) bool {
+	pos, _ := t.field(slot, 0)
+	return pos >= 0
+}
+
+// Bool reads a bool field.
+func (t Table) Bool(slot int, def bool) (bool, error) {
+	s, err := t.scalar(slot, 1)
+	if s == nil {
+		return def, err
+	}
+	return s[0] != 0, nil
+}
+
+// Uint8 reads a uint8 field.
+func (t Table) Uint8(slot int, def uint8) (uint8, error) {
+	s, err := t.scalar(slot, 1)
+	if s == nil {
+		return def, err
+	}
+	return s[0], nil
+}
+
+// Int8 reads an int8 field.
+func (t Table) Int8(slot int, def int8) (int8, error) {
+	v, err := t.Uint8(slot, uint8(def))
+	return int8(v), err
+}
+
+// Uint16 reads a uint16 field.
+func (t Table) Uint16(slot int, def uint16) (uint16, error) {
+	s, err := t.scalar(slot, 2)
+	if s == nil {
+		return def, err
+	}
+	return binary.LittleEndian.Uint16(s), nil
+}
+
+// Int16 reads an int16 field.
+func (t Table) Int16(slot int, def int16) (int16, error) {
+	v, err := t.Uint16(slot, uint16(def))
+	return int16(v), err
+}
+
+// Uint32 reads a uint32 field.
+func (t Table) Uint32(slot int, def uint32) (uint32, error) {
+	s, err := t.scalar(slot, 4)
+	if s == nil {
+		return def, err
+	}
+	return binary.LittleEndian.Uint32(s), nil
+}
+
+// Int32 reads an int32 field.
+func (t Table) Int32(slot int, def int32) (int32, error) {
+	v, err := t.Uint32(slot, uint32(def))
+	return int32(v), err
+}
+
+// Uint64 reads a uint64 field.
+func (t Table) Uint64(slot int, def uint64) (uint64, error) {
+	s, err := t.scalar(slot, 8)
+	if s == nil {
+		return def, err
+	}
+	return binary.LittleEndian.Uint64(s), nil
+}
+
+// Int64 reads an int64 field.
+func (t Table) Int64(slot int, def int64) (int64, error) {
+	v, err := t.Uint64(slot, uint64(def))
+	return int64(v), err
+}
+
+// Float32 reads a float32 field.
+func (t Table) Float32(slot int, def float32) (float32, error) {
+	v, err := t.Uint32(slot, math.Float32bits(def))
+	return math.Float32frombits(v), err
+}
+
+// Float64 reads a float64 field.
+func (t Table) Float64(slot int, def float64) (float64, error) {
+	v, err := t.Uint64(slot, math.Float64bits(def))
+	return math.Float64frombits(v), err
+}
+
+// Struct returns the bytes of a struct field of size bytes, or nil if it is not present. The
+// slice is a view into the data being read.
+func (t Table) Struct(slot, size int) ([]byte, error) {
+	return t.scalar(slot, size)
+}
+
+// ref returns the position a reference field in the slot given refers to, or -1 if it is not
+// present.
+func (t Table) ref(slot int) (int, error) {
+	pos, err := t.field(slot, sizeUOffset)
+	if pos < 0 {
+		return -1, err
+	}
+	return uoffset(t.buf, pos)
+}
+
+// StringBytes reads a string field as a view into the data being read. Strings that are not
+// present are nil.
+func (t Table) StringBytes(slot int) ([]byte, error) {
+	pos, err := t.ref(slot)
+	if pos < 0 {
+		return nil, err
+	}
+	return str(t.buf, pos)
+}
+
+// String reads a string field. Strings that are not present are empty.
+func (t Table) String(slot int) (string, error) {
+	s, err := t.StringBytes(slot)
+	return string(s), err
+}
+
+// Table reads a sub-table field. ok is false if it is not present.
+func (t Table) Table(slot int) (sub Table, ok bool, err error) {
+	pos, err := t.ref(slot)
+	if pos < 0 {
+		return Table{}, false, err
+	}
+	sub, err = table(t.buf, pos)
+	return sub, err == nil, err
+}
+
+// Union reads a union field whose type is in typeSlot and whose value is in the slot after
+// it. A type of 0 means the union is not set.
+func (t Table) Union(typeSlot int) (uint8, Table, error) {
+	typ, err := t.Uint8(typeSlot, 0)
+	if err != nil || typ == 0 {
+		return 0, Table{}, err
+	}
+	sub, ok, err := t.Table(typeSlot + 1)
+	if err == nil && !ok {
+		err = ErrInvalid
+	}
+	return typ, sub, err
+}
+
+// Vector reads a vector field whose elements are elemSize bytes each. Vectors of strings and
+// tables have elements of 4 bytes. Vectors that are not present are empty.
+func (t Table) Vector(slot, elemSize int) (Vector, error) {
+	pos, err := t.ref(slot)
+	if pos < 0 {
+		return Vector{}, err
+	}
+	start, n, err := vector(t.buf, pos, elemSize)
+	if err != nil {
+		return Vector{}, err
+	}
+	return Vector{buf: t.buf, start: start, n: n, size: elemSize}, nil
+}
+
+// Vector is a vector being read. Asking for an element outside of the vector panics.
+type Vector struct {
+	buf   []byte
+	start int
+	n     int
+	size  int
+}
+
+// Len returns the number of elements in the vector.
+func (v Vector) Len() int {
+	return v.n
+}
+
+// Bytes returns all the elements as a view into the data being read.
+func (v Vector) Bytes() []byte {
+	return v.buf[v.start : v.start+v.n*v.size]
+}
+
+// Element returns the bytes of element i as a view into the data being read. Scalars and
+// structs can be decoded from it with binary.LittleEndian.
+func (v Vector) Element(i int) []byte {
+	if i < 0 || i >= v.n {
+		panic("flatbuffers: vector index out of range")
+	}
+	pos := v.start + i*v.size
+	return v.buf[pos : pos+v.size]
+}
+
+// Uint32 returns element i of a vector of 4 byte scalars.
+func (v Vector) Uint32(i int) uint32 {
+	return binary.LittleEndian.Uint32(v.Element(i))
+}
+
+// Uint64 returns element i of a vector of 8 byte scalars.
+func (v Vector) Uint64(i int) uint64 {
+	return binary.LittleEndian.Uint64(v.Element(i))
+}
+
+// ref returns the position element i of a vector of strings or tables refers to.
+func (v Vector) ref(i int) (int, error) {
+	v.Element(i)
+	return uoffset(v.buf, v.start+i*v.size)
+}
+
+// StringBytes returns element i of a vector of strings as a view into the data being read.
+func (v Vector) StringBytes(i int) ([]byte, error) {
+	pos, err := v.ref(i)
+	if err != nil {
+		return nil, err
+	}
+	return str(v.buf, pos)
+}
+
+// String returns element i of a vector of strings.
+func (v Vector) String(i int) (string, error) {
+	s, err := v.StringBytes(i)
+	return string(s), err
+}
+
+// Table returns element i of a vector of tables.
+func (v Vector) Table(i int) (Table, error) {
+	pos, err := v.ref(i)
+	if err != nil {
+		return Table{}, err
+	}
+	return table(v.buf, pos)
+}
@@ -0,0 +1,84 @@
+// Package framing writes and reads streams of records, where each record is a length prefix
+// followed by its payload. Records are built in a safebuffer.ResizableBuffer before being
+// written out, and read back with the same buffering ResizableBuffer.ReadInto uses.
+package framing
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+var (
+	// ErrFrameTooLarge is returned when a record is longer than its length prefix can describe,
+	// or longer than the maximum frame size of a RecordReader.
+	ErrFrameTooLarge = errors.New("framing: frame is too large")
+
+	// ErrTruncatedFrame is returned by RecordReader when the stream ends part way through a
+	// record.
+	ErrTruncatedFrame = errors.New("framing: stream ended part way through a frame")
+)
+
+// DefaultMaxFrameSize is the largest payload a RecordReader accepts unless WithMaxFrameSize
+// is used.
+const DefaultMaxFrameSize = 4 << 20
+
+// Prefix is how the length of each record is written.
+type Prefix int
+
+// The length prefixes. Fixed width prefixes can be big or little endian.
+const (
+	Uint16 Prefix = iota
+	Uint32
+	Uvarint
+)
+
+// width returns the size of a fixed width prefix, or 0 for Uvarint.
+func (p Prefix) width() int {
+	switch p {
+	case Uint16:
+		return 2
+	case Uint32:
+		return 4
+	}
+	return 0
+}
+
+// max returns the largest length the prefix can describe.
+func (p Prefix) max() uint64 {
+	switch p {
+	case Uint16:
+		return math.MaxUint16
+	case Uint32:
+		return math.MaxUint32
+	}
+	return math.MaxUint64
+}
+
+// parse reads a prefix from the front of s, returning the length and the size of the prefix.
+// The size is 0 if s does not hold all of the prefix yet.
+func (p Prefix) parse(s []byte, littleEndian bool) (uint64, int, error) {
+	var order binary.ByteOrder = binary.BigEndian
+	if littleEndian {
+		order = binary.LittleEndian
+	}
+	switch p {
+	case Uint16:
+		if len(s) < 2 {
+			return 0, 0, nil
+		}
+		return uint64(order.Uint16(s)), 2, nil
+	case Uint32:
+		if len(s) < 4 {
+			return 0, 0, nil
+		}
+		return uint64(order.Uint32(s)), 4, nil
+	}
+	v, n := binary.Uvarint(s)
+	if n < 0 {
+		return 0, 0, safebuffer.ErrVarintOverflow
+	}
+	return v, n, nil
+}
@@ -0,0 +1,267 @@
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+func TestRecordWriter(t *testing.T) {
+	tests := []struct {
+		name         string
+		prefix       Prefix
+		littleEndian bool
+		eq           []byte
+	}{
+		{"uint16 big endian", Uint16, false, []byte{0, 2, 'h', 'i', 0, 0, 0, 3, 'a', 'b', 'c'}},
+		{"uint16 little endian", Uint16, true, []byte{2, 0, 'h', 'i', 0, 0, 3, 0, 'a', 'b', 'c'}},
+		{"uint32 big endian", Uint32, false, []byte{0, 0, 0, 2, 'h', 'i', 0, 0, 0, 0, 0, 0, 0, 3, 'a', 'b', 'c'}},
+		{"uint32 little endian", Uint32, true, []byte{2, 0, 0, 0, 'h', 'i', 0, 0, 0, 0, 3, 0, 0, 0, 'a', 'b', 'c'}},
+		{"uvarint", Uvarint, false, []byte{2, 'h', 'i', 0, 3, 'a', 'b', 'c'}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := NewRecordWriter(&out, safebuffer.NewResizableBuffer(nil), test.prefix, test.littleEndian)
+			if err := w.WriteRecord([]byte("hi")); err != nil {
+				t.Fatalf("expected nil error, got %v", err)
+			}
+			if err := w.WriteRecord(nil); err != nil {
+				t.Fatalf("expected nil error, got %v", err)
+			}
+			w.Begin().CopyString("abc")
+			if err := w.End(); err != nil {
+				t.Fatalf("expected nil error, got %v", err)
+			}
+			if w.Buffered() != len(test.eq) || out.Len() != 0 {
+				t.Fatalf("expected everything to be buffered until Flush, got %d buffered", w.Buffered())
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatalf("expected nil error, got %v", err)
+			}
+			if !bytes.Equal(out.Bytes(), test.eq) {
+				t.Fatalf("expected %v, got %v", test.eq, out.Bytes())
+			}
+			if w.Buffered() != 0 {
+				t.Fatalf("expected nothing to be buffered after Flush, got %d", w.Buffered())
+			}
+		})
+	}
+}
+
+func TestRecordWriterErrors(t *testing.T) {
+	t.Run("too large for the prefix", func(t *testing.T) {
+		b := safebuffer.NewResizableBuffer(nil)
+		w := NewRecordWriter(io.Discard, b, Uint16, false)
+		w.WriteRecord([]byte("kept"))
+		if err := w.WriteRecord(make([]byte, 1<<16)); err != ErrFrameTooLarge {
+			t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+		}
+		if !bytes.Equal(b.Bytes(), []byte{0, 4, 'k', 'e', 'p', 't'}) {
+			t.Fatalf("expected the record to be removed, got %v", b.Bytes())
+		}
+		if err := w.WriteRecord(make([]byte, 1<<16-1)); err != nil {
+			t.Fatalf("expected the largest record to fit, got %v", err)
+		}
+	})
+
+	t.Run("buffer error", func(t *testing.T) {
+		b := safebuffer.NewResizableBuffer(nil).WithMaxSize(8)
+		w := NewRecordWriter(io.Discard, b, Uvarint, false)
+		w.WriteRecord([]byte("kept"))
+		if err := w.WriteRecord([]byte("too long")); err != safebuffer.ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", err)
+		}
+		if b.Err() != nil || !bytes.Equal(b.Bytes(), []byte{4, 'k', 'e', 'p', 't'}) {
+			t.Fatalf("expected the record and error to be rolled back, got %v and %v", b.Bytes(), b.Err())
+		}
+	})
+
+	t.Run("long uvarint", func(t *testing.T) {
+		b := safebuffer.NewResizableBuffer(nil).WithMaxSize(300)
+		w := NewRecordWriter(io.Discard, b, Uvarint, false)
+		if err := w.WriteRecord(make([]byte, 298)); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if err := w.WriteRecord(nil); err != safebuffer.ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", err)
+		}
+		if b.Len() != 300 || b.Bytes()[0] != 0xaa || b.Bytes()[1] != 0x02 {
+			t.Fatalf("expected a two byte length, got %v", b.Bytes()[:2])
+		}
+	})
+
+	t.Run("short write", func(t *testing.T) {
+		var out bytes.Buffer
+		fw := &failingWriter{w: &out, n: 3}
+		w := NewRecordWriter(fw, safebuffer.NewResizableBuffer(nil), Uint16, false)
+		w.WriteRecord([]byte("hello"))
+		if err := w.Flush(); err != errFailed {
+			t.Fatalf("expected errFailed, got %v", err)
+		}
+		if w.Buffered() != 4 {
+			t.Fatalf("expected 4 bytes to still be buffered, got %d", w.Buffered())
+		}
+		if err := w.Flush(); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if out.String() != "\x00\x05hello" {
+			t.Fatalf("expected the whole record, got %q", out.String())
+		}
+	})
+
+	panics := []struct {
+		name string
+		fn   func(w *RecordWriter)
+	}{
+		{"begin twice", func(w *RecordWriter) { w.Begin(); w.Begin() }},
+		{"end without begin", func(w *RecordWriter) { w.End() }},
+		{"flush while open", func(w *RecordWriter) { w.Begin(); w.Flush() }},
+	}
+	for _, test := range panics {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+			test.fn(NewRecordWriter(io.Discard, safebuffer.NewResizableBuffer(nil), Uint32, false))
+		})
+	}
+}
+
+var errFailed = errors.New("failed")
+
+// failingWriter accepts n bytes and then fails once.
+type failingWriter struct {
+	w io.Writer
+	n int
+}
+
+func (f *failingWriter) Write(p []byte) (int, error) {
+	if f.n < 0 {
+		return f.w.Write(p)
+	}
+	n := min(f.n, len(p))
+	f.n = -1
+	f.w.Write(p[:n])
+	return n, errFailed
+}
+
+func TestRoundTrip(t *testing.T) {
+	records := [][]byte{
+		[]byte("first"),
+		nil,
+		bytes.Repeat([]byte{'x'}, 10000),
+		[]byte("last"),
+	}
+	for _, prefix := range []Prefix{Uint16, Uint32, Uvarint} {
+		for _, littleEndian := range []bool{false, true} {
+			var stream bytes.Buffer
+			w := NewRecordWriter(&stream, safebuffer.NewResizableBuffer(nil), prefix, littleEndian)
+			for _, rec := range records {
+				w.WriteRecord(rec)
+			}
+			w.Flush()
+			data := stream.Bytes()
+
+			readers := map[string]io.Reader{
+				"whole":    bytes.NewReader(data),
+				"one byte": iotest.OneByteReader(bytes.NewReader(data)),
+				"half":     iotest.HalfReader(bytes.NewReader(data)),
+				"eof":      iotest.DataErrReader(bytes.NewReader(data)),
+			}
+			for name, src := range readers {
+				r := NewRecordReader(src, prefix, littleEndian)
+				for i, expected := range records {
+					rec, err := r.ReadRecord()
+					if err != nil || !bytes.Equal(rec, expected) {
+						t.Fatalf("prefix %d, little endian %v, %s: record %d: expected %d bytes, got %d, %v",
+							prefix, littleEndian, name, i, len(expected), len(rec), err)
+					}
+				}
+				for i := 0; i < 2; i++ {
+					if _, err := r.ReadRecord(); err != io.EOF {
+						t.Fatalf("prefix %d, %s: expected io.EOF, got %v", prefix, name, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestRecordReaderErrors(t *testing.T) {
+	t.Run("truncated payload", func(t *testing.T) {
+		r := NewRecordReader(strings.NewReader("\x00\x05hel"), Uint16, false)
+		if _, err := r.ReadRecord(); err != ErrTruncatedFrame {
+			t.Fatalf("expected ErrTruncatedFrame, got %v", err)
+		}
+	})
+
+	t.Run("truncated prefix", func(t *testing.T) {
+		r := NewRecordReader(strings.NewReader("\x00\x00\x00\x01x\x00\x00"), Uint32, false)
+		if rec, err := r.ReadRecord(); err != nil || string(rec) != "x" {
+			t.Fatalf("expected x, got %q, %v", rec, err)
+		}
+		if _, err := r.ReadRecord(); err != ErrTruncatedFrame {
+			t.Fatalf("expected ErrTruncatedFrame, got %v", err)
+		}
+	})
+
+	t.Run("frame too large", func(t *testing.T) {
+		r := NewRecordReader(strings.NewReader("\x03abc\x05hello\x01x"), Uvarint, false).WithMaxFrameSize(4)
+		if rec, err := r.ReadRecord(); err != nil || string(rec) != "abc" {
+			t.Fatalf("expected abc, got %q, %v", rec, err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := r.ReadRecord(); err != ErrFrameTooLarge {
+				t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+			}
+		}
+	})
+
+	t.Run("default maximum", func(t *testing.T) {
+		r := NewRecordReader(strings.NewReader("\xff\xff\xff\xff"), Uint32, false)
+		if _, err := r.ReadRecord(); err != ErrFrameTooLarge {
+			t.Fatalf("expected ErrFrameTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("varint overflow", func(t *testing.T) {
+		r := NewRecordReader(strings.NewReader(strings.Repeat("\xff", 10)+"\x7f"), Uvarint, false)
+		if _, err := r.ReadRecord(); err != safebuffer.ErrVarintOverflow {
+			t.Fatalf("expected ErrVarintOverflow, got %v", err)
+		}
+	})
+
+	t.Run("resumes after a read error", func(t *testing.T) {
+		src := iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("\x00\x03abc\x00\x01d")))
+		r := NewRecordReader(src, Uint16, false)
+		if _, err := r.ReadRecord(); err != iotest.ErrTimeout {
+			t.Fatalf("expected ErrTimeout, got %v", err)
+		}
+		if r.Buffered() != 1 {
+			t.Fatalf("expected the byte read before the error to be kept, got %d", r.Buffered())
+		}
+		for _, expected := range []string{"abc", "d"} {
+			if rec, err := r.ReadRecord(); err != nil || string(rec) != expected {
+				t.Fatalf("expected %s, got %q, %v", expected, rec, err)
+			}
+		}
+		if _, err := r.ReadRecord(); err != io.EOF {
+			t.Fatalf("expected io.EOF, got %v", err)
+		}
+	})
+
+	t.Run("empty stream", func(t *testing.T) {
+		r := NewRecordReader(strings.NewReader(""), Uint16, true)
+		if _, err := r.ReadRecord(); err != io.EOF {
+			t.Fatalf("expected io.EOF, got %v", err)
+		}
+	})
+}
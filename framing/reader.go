@@ -0,0 +1,108 @@
+package framing
+
+import (
+	"io"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// readSize is the least RecordReader asks for from the underlying reader at a time.
+const readSize = 4096
+
+// RecordReader reads records written by RecordWriter from an io.Reader, buffering whatever
+// arrives past the end of the current record for the next call. This is single threaded.
+type RecordReader struct {
+	r            io.Reader
+	buf          *safebuffer.ResizableBuffer
+	prefix       Prefix
+	littleEndian bool
+	maxSize      int
+
+	// consumed is the size of the record last returned, which is dropped on the next read.
+	consumed int
+
+	// err is the last error from the underlying reader, and invalid is an error in the
+	// stream itself, after which it cannot be read any further.
+	err     error
+	invalid error
+}
+
+// NewRecordReader creates a new RecordReader that reads from r. littleEndian is ignored for
+// Uvarint prefixes.
+func NewRecordReader(r io.Reader, prefix Prefix, littleEndian bool) *RecordReader {
+	return &RecordReader{
+		r:            r,
+		buf:          safebuffer.NewResizableBuffer(nil),
+		prefix:       prefix,
+		littleEndian: littleEndian,
+		maxSize:      DefaultMaxFrameSize,
+	}
+}
+
+// WithMaxFrameSize sets the largest payload the reader accepts. Anything larger gives
+// ErrFrameTooLarge before it is read.
+func (r *RecordReader) WithMaxFrameSize(n int) *RecordReader {
+	r.maxSize = n
+	return r
+}
+
+// ReadRecord reads the next record and returns its payload. The payload is a view into the
+// reader's buffer, so it is only valid until the next call.
+//
+// io.EOF is returned if r ends between records, and ErrTruncatedFrame if it ends part way
+// through one. Other errors from r are returned as they are, and the next call carries on
+// from where this one stopped. ErrFrameTooLarge and safebuffer.ErrVarintOverflow mean the
+// stream cannot be read any further, and are returned by every call after.
+func (r *RecordReader) ReadRecord() ([]byte, error) {
+	if r.invalid != nil {
+		return nil, r.invalid
+	}
+	if r.consumed != 0 {
+		if r.consumed == r.buf.Len() {
+			r.buf.Reset(false)
+		} else {
+			r.buf.DeleteRange(0, r.consumed)
+		}
+		r.consumed = 0
+	}
+
+	for {
+		data := r.buf.Bytes()
+		length, n, err := r.prefix.parse(data, r.littleEndian)
+		if err == nil && n != 0 && length > uint64(r.maxSize) {
+			err = ErrFrameTooLarge
+		}
+		if err != nil {
+			r.invalid = err
+			return nil, err
+		}
+		need := readSize
+		if n != 0 {
+			end := n + int(length)
+			if len(data) >= end {
+				r.consumed = end
+				return data[n:end], nil
+			}
+			need = max(need, end-len(data))
+		}
+
+		if r.err != nil {
+			err := r.err
+			if err != io.EOF {
+				// Anything other than the end of the stream might go away, so the next call
+				// tries again.
+				r.err = nil
+			} else if len(data) != 0 {
+				err = ErrTruncatedFrame
+			}
+			return nil, err
+		}
+		_, r.err = r.buf.ReadInto(r.r, need)
+	}
+}
+
+// Buffered returns the number of bytes read from r that have not been returned as part of a
+// record yet.
+func (r *RecordReader) Buffered() int {
+	return r.buf.Len() - r.consumed
+}
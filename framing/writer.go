@@ -0,0 +1,101 @@
+package framing
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// RecordWriter writes records to an io.Writer, building them in a ResizableBuffer first so
+// that each one is written with its length in front of it. Records are held in the buffer
+// until Flush is called. This is single threaded.
+type RecordWriter struct {
+	w            io.Writer
+	b            *safebuffer.ResizableBuffer
+	prefix       Prefix
+	littleEndian bool
+
+	// open is true between Begin and End, with mark and length set to where the record starts.
+	open   bool
+	mark   safebuffer.Mark
+	length safebuffer.Placeholder
+}
+
+// NewRecordWriter creates a new RecordWriter that buffers records in b and writes them to w.
+// littleEndian is ignored for Uvarint prefixes.
+func NewRecordWriter(w io.Writer, b *safebuffer.ResizableBuffer, prefix Prefix, littleEndian bool) *RecordWriter {
+	return &RecordWriter{w: w, b: b, prefix: prefix, littleEndian: littleEndian}
+}
+
+// Begin starts a record and returns the buffer to write its payload into. Call End once the
+// payload is written.
+func (w *RecordWriter) Begin() *safebuffer.ResizableBuffer {
+	if w.open {
+		panic("framing: Begin called while a record is already open")
+	}
+	w.open = true
+	w.mark = w.b.Mark()
+	w.length = w.b.Reserve(w.prefix.width())
+	return w.b
+}
+
+// End fills in the length of the record started with Begin. If the buffer holds an error, or
+// the payload is too long for the prefix, the record is removed from the buffer and the error
+// is returned.
+func (w *RecordWriter) End() error {
+	if !w.open {
+		panic("framing: End called without a record to end")
+	}
+	w.open = false
+	err := w.b.Err()
+	n := w.length.BytesSince()
+	if err == nil && uint64(n) > w.prefix.max() {
+		err = ErrFrameTooLarge
+	}
+	if err != nil {
+		w.b.RollbackTo(w.mark, false)
+		return err
+	}
+
+	p := w.length.Bytes()
+	switch {
+	case w.prefix == Uvarint:
+		w.b.InsertUvarint(w.length.Offset(), uint64(n))
+	case w.prefix == Uint16 && w.littleEndian:
+		binary.LittleEndian.PutUint16(p, uint16(n))
+	case w.prefix == Uint16:
+		binary.BigEndian.PutUint16(p, uint16(n))
+	case w.littleEndian:
+		binary.LittleEndian.PutUint32(p, uint32(n))
+	default:
+		binary.BigEndian.PutUint32(p, uint32(n))
+	}
+	if err := w.b.Err(); err != nil {
+		w.b.RollbackTo(w.mark, false)
+		return err
+	}
+	w.b.Commit(w.mark)
+	return nil
+}
+
+// WriteRecord buffers a record with the payload given.
+func (w *RecordWriter) WriteRecord(p []byte) error {
+	w.Begin().CopyBytes(p)
+	return w.End()
+}
+
+// Flush writes the buffered records to the underlying writer. If it fails part way through,
+// whatever was not written is kept, so Flush can be called again.
+func (w *RecordWriter) Flush() error {
+	if w.open {
+		panic("framing: Flush called while a record is open")
+	}
+	_, err := w.b.WriteTo(w.w)
+	return err
+}
+
+// Buffered returns the number of bytes waiting to be flushed.
+func (w *RecordWriter) Buffered() int {
+	return w.b.Len()
+}
@@ -0,0 +1,86 @@
+package safebuffer
+
+// GrowthPolicy decides how big the new backing array of a ResizableBuffer should be when it
+// runs out of room.
+type GrowthPolicy interface {
+	// Grow returns the new capacity for a buffer with the capacity given that needs to hold at
+	// least required bytes. If the result is less than required, required is used instead.
+	Grow(capacity, required int) int
+}
+
+// GrowthFunc is a function that implements GrowthPolicy.
+type GrowthFunc func(capacity, required int) int
+
+// Grow implements GrowthPolicy.
+func (f GrowthFunc) Grow(capacity, required int) int {
+	return f(capacity, required)
+}
+
+var (
+	// DoublingGrowth allocates double what is required. This is the default.
+	DoublingGrowth GrowthPolicy = GrowthFunc(func(capacity, required int) int {
+		return required * 2
+	})
+
+	// AppendGrowth grows the same way as Go's append. Small buffers double, and large buffers
+	// grow by around 1.25x so they do not overshoot.
+	AppendGrowth GrowthPolicy = GrowthFunc(func(capacity, required int) int {
+		const threshold = 256
+		newCap := capacity
+		if required > newCap*2 {
+			return required
+		}
+		if newCap < threshold {
+			return newCap * 2
+		}
+		for newCap < required {
+			newCap += (newCap + 3*threshold) >> 2
+		}
+		return newCap
+	})
+
+	// PowerOfTwoGrowth allocates the smallest power of two that fits what is required.
+	PowerOfTwoGrowth GrowthPolicy = GrowthFunc(func(capacity, required int) int {
+		newCap := 1
+		for newCap < required {
+			newCap <<= 1
+		}
+		return newCap
+	})
+
+	// ExactGrowth allocates exactly what is required.
+	ExactGrowth GrowthPolicy = GrowthFunc(func(capacity, required int) int {
+		return required
+	})
+)
+
+// FixedStepGrowth returns a policy that grows in multiples of step bytes.
+func FixedStepGrowth(step int) GrowthPolicy {
+	if step <= 0 {
+		panic("safebuffer: growth step must be positive")
+	}
+	return GrowthFunc(func(capacity, required int) int {
+		return (required + step - 1) / step * step
+	})
+}
+
+// WithGrowthPolicy sets how the buffer grows when it runs out of room. This is used by every
+// write, prepend, ReadInto and SubBuffer. A nil policy means DoublingGrowth.
+func (b *ResizableBuffer) WithGrowthPolicy(p GrowthPolicy) *ResizableBuffer {
+	b.growth = p
+	return b
+}
+
+// newCapacity returns the size of the next backing array when it needs to hold at least
+// required bytes, of which front are in front of the consumed buffer.
+func (b *ResizableBuffer) newCapacity(required, front int) int {
+	p := b.growth
+	if p == nil {
+		p = DoublingGrowth
+	}
+	size := p.Grow(len(b.buffer), required)
+	if size < required {
+		size = required
+	}
+	return b.capSize(size, front)
+}
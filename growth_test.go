@@ -0,0 +1,92 @@
+package safebuffer
+
+import "testing"
+
+func TestGrowthPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   GrowthPolicy
+		capacity int
+		required int
+		eq       int
+	}{
+		{"doubling", DoublingGrowth, 100, 101, 202},
+		{"append small", AppendGrowth, 100, 101, 200},
+		{"append large", AppendGrowth, 512 << 20, 512<<20 + 1, 512<<20 + (512<<20+768)/4},
+		{"append jump", AppendGrowth, 10, 100, 100},
+		{"power of two", PowerOfTwoGrowth, 100, 1000, 1024},
+		{"power of two exact", PowerOfTwoGrowth, 100, 512, 512},
+		{"exact", ExactGrowth, 100, 101, 101},
+		{"fixed step", FixedStepGrowth(4096), 4096, 4097, 8192},
+		{"fixed step exact", FixedStepGrowth(64), 0, 128, 128},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if x := test.policy.Grow(test.capacity, test.required); x != test.eq {
+				t.Fatalf("expected %d, got %d", test.eq, x)
+			}
+		})
+	}
+}
+
+func TestWithGrowthPolicy(t *testing.T) {
+	t.Run("write", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithGrowthPolicy(ExactGrowth)
+		rb.CopyString("hello").Uint16(1, true)
+		if len(rb.buffer) != 7 {
+			t.Fatalf("expected a 7 byte buffer, got %d", len(rb.buffer))
+		}
+	})
+
+	t.Run("prepend", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithGrowthPolicy(ExactGrowth)
+		rb.CopyString("hello").PrependUint32(1, true)
+		// The 4 bytes prepended, 5 bytes of headroom for the next prepends and the 5 bytes kept.
+		if len(rb.buffer) != 14 {
+			t.Fatalf("expected a 14 byte buffer, got %d", len(rb.buffer))
+		}
+		if string(rb.Bytes()[4:]) != "hello" {
+			t.Fatalf("expected hello to be kept, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("read into", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithGrowthPolicy(FixedStepGrowth(100))
+		if _, err := rb.ReadInto(stringReader{s: "hello"}, 5); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if len(rb.buffer) != 100 {
+			t.Fatalf("expected a 100 byte buffer, got %d", len(rb.buffer))
+		}
+	})
+
+	t.Run("sub buffer", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithGrowthPolicy(PowerOfTwoGrowth).CopyString("a")
+		rb.SubBuffer(10)
+		if len(rb.buffer) != 16 {
+			t.Fatalf("expected a 16 byte buffer, got %d", len(rb.buffer))
+		}
+	})
+
+	t.Run("bad policy", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithGrowthPolicy(GrowthFunc(func(capacity, required int) int {
+			return 0
+		}))
+		rb.CopyString("hello")
+		if string(rb.Bytes()) != "hello" {
+			t.Fatalf("expected hello, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("capped by max size", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithGrowthPolicy(PowerOfTwoGrowth).WithMaxSize(10)
+		rb.CopyString("hello")
+		if len(rb.buffer) != 8 {
+			t.Fatalf("expected an 8 byte buffer, got %d", len(rb.buffer))
+		}
+		rb.CopyString("hello")
+		if len(rb.buffer) != 10 {
+			t.Fatalf("expected a 10 byte buffer, got %d", len(rb.buffer))
+		}
+	})
+}
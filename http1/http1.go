@@ -0,0 +1,350 @@
+// Package http1 writes HTTP/1.1 requests and responses into a safebuffer.ResizableBuffer. It
+// validates the start line and header fields as they are written, can fill in Content-Length
+// once the body is known, and handles chunked transfer encoding including trailers.
+package http1
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+var (
+	// ErrInvalidMethod is held by a Writer after a request method that is not a token.
+	ErrInvalidMethod = errors.New("http1: invalid method")
+
+	// ErrInvalidTarget is held by a Writer after a request target that is empty or contains
+	// whitespace or control characters.
+	ErrInvalidTarget = errors.New("http1: invalid request target")
+
+	// ErrInvalidStatus is held by a Writer after a status code that is not three digits or a
+	// reason phrase with control characters.
+	ErrInvalidStatus = errors.New("http1: invalid status")
+
+	// ErrInvalidHeaderName is held by a Writer after a header field name that is not a token.
+	ErrInvalidHeaderName = errors.New("http1: invalid header field name")
+
+	// ErrInvalidHeaderValue is held by a Writer after a header field value that contains a CR,
+	// LF or other control character. Values cannot be folded over multiple lines.
+	ErrInvalidHeaderValue = errors.New("http1: invalid header field value")
+
+	// ErrFramingHeader is held by a Writer after a Content-Length or Transfer-Encoding field
+	// is written with Header or Trailer. These decide where the body ends, so they can only be
+	// written with ContentLength and Chunked.
+	ErrFramingHeader = errors.New("http1: Content-Length and Transfer-Encoding must be written with ContentLength and Chunked")
+)
+
+// contentLengthSize is how many bytes are reserved for a backpatched Content-Length, which is
+// enough for any int64.
+const contentLengthSize = 20
+
+// state is where a Writer is in a message.
+type state int
+
+const (
+	stateStart state = iota
+	stateHeaders
+	stateBody
+	stateTrailers
+	stateDone
+)
+
+// Writer writes a single HTTP/1.1 message. Write the start line with RequestLine or
+// StatusLine, then header fields, then call EndHeaders, write the body and finish with End.
+// Calling these out of order panics. If a field fails validation, the error is held and
+// everything after it is ignored, so a chain of writes can be checked once at the end with
+// Err. This is single threaded.
+type Writer struct {
+	b     *safebuffer.ResizableBuffer
+	state state
+	err   error
+
+	chunked       bool
+	contentLength safebuffer.Placeholder
+	hasLength     bool
+	body          safebuffer.Placeholder
+}
+
+// NewWriter creates a new Writer that appends a message to the buffer given.
+func NewWriter(b *safebuffer.ResizableBuffer) *Writer {
+	return &Writer{b: b}
+}
+
+// Err returns the validation error held by the writer, or the error held by the buffer.
+func (w *Writer) Err() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.b.Err()
+}
+
+// expect reports whether writing should go ahead, panicking if the writer is not in the
+// state given. Once an error is held, everything is ignored without checking the order.
+func (w *Writer) expect(s state, call string) bool {
+	if w.err != nil {
+		return false
+	}
+	if w.state != s {
+		panic("http1: " + call + " called out of order")
+	}
+	return true
+}
+
+// fail holds the error given. Nothing else is written once this happens.
+func (w *Writer) fail(err error) *Writer {
+	w.err = err
+	return w
+}
+
+// RequestLine writes the request line for the method and target given.
+func (w *Writer) RequestLine(method, target string) *Writer {
+	if !w.expect(stateStart, "RequestLine") {
+		return w
+	}
+	w.state = stateHeaders
+	if !isToken(method) {
+		return w.fail(ErrInvalidMethod)
+	}
+	if target == "" {
+		return w.fail(ErrInvalidTarget)
+	}
+	for i := 0; i < len(target); i++ {
+		if c := target[i]; c <= ' ' || c == 0x7f {
+			return w.fail(ErrInvalidTarget)
+		}
+	}
+	w.b.CopyString(method).Byte(' ').CopyString(target).CopyString(" HTTP/1.1").CRLF()
+	return w
+}
+
+// StatusLine writes the status line for the code and reason phrase given. If the reason is
+// empty, the standard one for the code is used.
+func (w *Writer) StatusLine(code int, reason string) *Writer {
+	if !w.expect(stateStart, "StatusLine") {
+		return w
+	}
+	w.state = stateHeaders
+	if code < 100 || code > 999 {
+		return w.fail(ErrInvalidStatus)
+	}
+	if reason == "" {
+		reason = http.StatusText(code)
+	}
+	if !isFieldValue(reason) {
+		return w.fail(ErrInvalidStatus)
+	}
+	var scratch [3]byte
+	w.b.CopyString("HTTP/1.1 ").CopyBytes(strconv.AppendInt(scratch[:0], int64(code), 10))
+	w.b.Byte(' ').CopyString(reason).CRLF()
+	return w
+}
+
+// field writes a header or trailer field.
+func (w *Writer) field(name, value string) *Writer {
+	if !isToken(name) {
+		return w.fail(ErrInvalidHeaderName)
+	}
+	if !isFieldValue(value) {
+		return w.fail(ErrInvalidHeaderValue)
+	}
+	w.b.CopyString(name).CopyString(": ").CopyString(value).CRLF()
+	return w
+}
+
+// userField writes a header or trailer field given by the caller, which cannot be one that
+// frames the body.
+func (w *Writer) userField(name, value string) *Writer {
+	if strings.EqualFold(name, "Content-Length") || strings.EqualFold(name, "Transfer-Encoding") {
+		return w.fail(ErrFramingHeader)
+	}
+	return w.field(name, trimOWS(value))
+}
+
+// Header writes a header field. Leading and trailing whitespace in the value is not part of
+// it, so it is dropped. Content-Length and Transfer-Encoding cannot be written with this,
+// use ContentLength and Chunked instead.
+func (w *Writer) Header(name, value string) *Writer {
+	if !w.expect(stateHeaders, "Header") {
+		return w
+	}
+	return w.userField(name, value)
+}
+
+// ContentLength writes a Content-Length header field whose value is filled in by End, once
+// the length of the body is known. The value is padded with trailing spaces, which are
+// optional whitespace and not part of it, so the body never has to be moved.
+func (w *Writer) ContentLength() *Writer {
+	if !w.expect(stateHeaders, "ContentLength") {
+		return w
+	}
+	if w.chunked {
+		panic("http1: ContentLength called on a chunked message")
+	}
+	w.b.CopyString("Content-Length: ")
+	w.contentLength = w.b.Reserve(contentLengthSize)
+	w.hasLength = true
+	w.b.CRLF()
+	return w
+}
+
+// Chunked writes a Transfer-Encoding header field and makes the body use chunked encoding.
+func (w *Writer) Chunked() *Writer {
+	if !w.expect(stateHeaders, "Chunked") {
+		return w
+	}
+	if w.hasLength {
+		panic("http1: Chunked called on a message with a Content-Length")
+	}
+	w.chunked = true
+	return w.field("Transfer-Encoding", "chunked")
+}
+
+// EndHeaders ends the header section. Anything written after this is the body.
+func (w *Writer) EndHeaders() *Writer {
+	if !w.expect(stateHeaders, "EndHeaders") {
+		return w
+	}
+	w.state = stateBody
+	w.b.CRLF()
+	w.body = w.b.Reserve(0)
+	return w
+}
+
+// Body writes part of the body. In chunked mode, each call writes one chunk, and calls with
+// no data are ignored since an empty chunk ends the body.
+func (w *Writer) Body(p []byte) *Writer {
+	if !w.expect(stateBody, "Body") {
+		return w
+	}
+	if !w.chunked {
+		w.b.CopyBytes(p)
+		return w
+	}
+	if len(p) == 0 {
+		return w
+	}
+	w.chunkSize(len(p))
+	w.b.CopyBytes(p).CRLF()
+	return w
+}
+
+// BodyString is like Body, but takes a string.
+func (w *Writer) BodyString(s string) *Writer {
+	if !w.expect(stateBody, "BodyString") {
+		return w
+	}
+	if !w.chunked {
+		w.b.CopyString(s)
+		return w
+	}
+	if len(s) == 0 {
+		return w
+	}
+	w.chunkSize(len(s))
+	w.b.CopyString(s).CRLF()
+	return w
+}
+
+// chunkSize writes the size line of a chunk.
+func (w *Writer) chunkSize(n int) {
+	var scratch [16]byte
+	w.b.CopyBytes(strconv.AppendInt(scratch[:0], int64(n), 16)).CRLF()
+}
+
+// Trailer writes a trailer field after the body of a chunked message. Content-Length and
+// Transfer-Encoding cannot be written with this.
+func (w *Writer) Trailer(name, value string) *Writer {
+	if w.err != nil {
+		return w
+	}
+	if !w.chunked {
+		panic("http1: Trailer called on a message that is not chunked")
+	}
+	if w.state == stateBody {
+		w.b.Byte('0').CRLF()
+		w.state = stateTrailers
+	}
+	if !w.expect(stateTrailers, "Trailer") {
+		return w
+	}
+	return w.userField(name, value)
+}
+
+// End finishes the message. For chunked messages, this ends the body and trailer section.
+// Otherwise, if ContentLength was called, it is filled in with the length of the body.
+func (w *Writer) End() *Writer {
+	if w.err != nil {
+		return w
+	}
+	if w.state != stateBody && w.state != stateTrailers {
+		panic("http1: End called out of order")
+	}
+	switch {
+	case w.chunked:
+		if w.state == stateBody {
+			w.b.Byte('0').CRLF()
+		}
+		w.b.CRLF()
+	case w.hasLength:
+		s := w.contentLength.Bytes()
+		n := copy(s, strconv.Itoa(w.body.BytesSince()))
+		for i := n; i < len(s); i++ {
+			s[i] = ' '
+		}
+	}
+	w.state = stateDone
+	return w
+}
+
+// isToken checks that s is a non-empty token as defined in RFC 9110.
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !tokenChars[s[i]] {
+			return false
+		}
+	}
+	return true
+}
+
+// isFieldValue checks that s only has visible characters, spaces and tabs, which rules out
+// line folding.
+func isFieldValue(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' && c != '\t' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// trimOWS drops leading and trailing spaces and tabs.
+func trimOWS(s string) string {
+	for len(s) > 0 && (s[0] == ' ' || s[0] == '\t') {
+		s = s[1:]
+	}
+	for len(s) > 0 && (s[len(s)-1] == ' ' || s[len(s)-1] == '\t') {
+		s = s[:len(s)-1]
+	}
+	return s
+}
+
+// tokenChars is the set of characters allowed in a token.
+var tokenChars = func() (t [256]bool) {
+	for c := '0'; c <= '9'; c++ {
+		t[c] = true
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		t[c] = true
+		t[c-'a'+'A'] = true
+	}
+	for _, c := range "!#$%&'*+-.^_`|~" {
+		t[c] = true
+	}
+	return t
+}()
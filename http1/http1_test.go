@@ -0,0 +1,260 @@
+package http1
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+func readRequest(t *testing.T, b []byte) (*http.Request, []byte) {
+	t.Helper()
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatalf("expected nil error reading body, got %v", err)
+	}
+	return req, body
+}
+
+func readResponse(t *testing.T, b []byte) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), nil)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("expected nil error reading body, got %v", err)
+	}
+	return resp, body
+}
+
+func TestRequestContentLength(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	w := NewWriter(b).
+		RequestLine("POST", "/submit?x=1").
+		Header("Host", "example.com").
+		Header("Content-Type", "  text/plain ").
+		ContentLength().
+		EndHeaders().
+		BodyString("hello ").
+		Body([]byte("world")).
+		End()
+	if w.Err() != nil {
+		t.Fatalf("expected nil error, got %v", w.Err())
+	}
+	req, body := readRequest(t, b.Bytes())
+	if req.Method != "POST" || req.RequestURI != "/submit?x=1" || req.Host != "example.com" {
+		t.Fatalf("unexpected request line or host: %s %s %s", req.Method, req.RequestURI, req.Host)
+	}
+	if req.ContentLength != 11 || string(body) != "hello world" {
+		t.Fatalf("expected 11 byte body hello world, got %d byte body %q", req.ContentLength, body)
+	}
+	if req.Header.Get("Content-Type") != "text/plain" {
+		t.Fatalf("expected text/plain, got %q", req.Header.Get("Content-Type"))
+	}
+	if !bytes.HasPrefix(b.Bytes(), []byte("POST /submit?x=1 HTTP/1.1\r\n")) {
+		t.Fatalf("unexpected request line in %q", b.Bytes())
+	}
+}
+
+func TestResponseContentLength(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	w := NewWriter(b).StatusLine(404, "").ContentLength().Header("X-Test", "1").EndHeaders()
+
+	// Prepending to the buffer must not confuse the length.
+	b.PrependString("")
+	w.BodyString(strings.Repeat("x", 12345)).End()
+	if w.Err() != nil {
+		t.Fatalf("expected nil error, got %v", w.Err())
+	}
+	resp, body := readResponse(t, b.Bytes())
+	if resp.StatusCode != 404 || resp.Status != "404 Not Found" {
+		t.Fatalf("expected 404 Not Found, got %q", resp.Status)
+	}
+	if resp.ContentLength != 12345 || len(body) != 12345 {
+		t.Fatalf("expected 12345 byte body, got %d and %d", resp.ContentLength, len(body))
+	}
+	if resp.Header.Get("X-Test") != "1" {
+		t.Fatalf("expected X-Test to be 1, got %q", resp.Header.Get("X-Test"))
+	}
+}
+
+func TestEmptyBody(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	NewWriter(b).StatusLine(200, "All Good").ContentLength().EndHeaders().End()
+	resp, body := readResponse(t, b.Bytes())
+	if resp.Status != "200 All Good" || resp.ContentLength != 0 || len(body) != 0 {
+		t.Fatalf("expected an empty 200 All Good, got %q with %d bytes", resp.Status, len(body))
+	}
+}
+
+func TestChunked(t *testing.T) {
+	t.Run("request with trailers", func(t *testing.T) {
+		b := safebuffer.NewResizableBuffer(nil)
+		w := NewWriter(b).
+			RequestLine("PUT", "/upload").
+			Header("Host", "example.com").
+			Header("Trailer", "X-Checksum").
+			Chunked().
+			EndHeaders().
+			BodyString("hello ").
+			BodyString("").
+			Body(bytes.Repeat([]byte{'x'}, 300)).
+			Trailer("X-Checksum", "abc123").
+			End()
+		if w.Err() != nil {
+			t.Fatalf("expected nil error, got %v", w.Err())
+		}
+		req, body := readRequest(t, b.Bytes())
+		if string(body) != "hello "+strings.Repeat("x", 300) {
+			t.Fatalf("unexpected body %q", body)
+		}
+		if len(req.TransferEncoding) != 1 || req.TransferEncoding[0] != "chunked" {
+			t.Fatalf("expected chunked, got %v", req.TransferEncoding)
+		}
+		if req.Trailer.Get("X-Checksum") != "abc123" {
+			t.Fatalf("expected trailer abc123, got %v", req.Trailer)
+		}
+		if !bytes.Contains(b.Bytes(), []byte("\r\n12c\r\n")) {
+			t.Fatalf("expected a hex chunk size, got %q", b.Bytes())
+		}
+	})
+
+	t.Run("response without trailers", func(t *testing.T) {
+		b := safebuffer.NewResizableBuffer(nil)
+		NewWriter(b).StatusLine(200, "").Chunked().EndHeaders().BodyString("abc").End()
+		if !bytes.HasSuffix(b.Bytes(), []byte("\r\n3\r\nabc\r\n0\r\n\r\n")) {
+			t.Fatalf("unexpected chunked body in %q", b.Bytes())
+		}
+		_, body := readResponse(t, b.Bytes())
+		if string(body) != "abc" {
+			t.Fatalf("expected abc, got %q", body)
+		}
+	})
+}
+
+func TestContentLengthBackpatched(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	w := NewWriter(b).StatusLine(200, "").ContentLength().Header("X", "1").EndHeaders()
+	body := b.Len()
+	w.BodyString("hello")
+	first := &b.Bytes()[body]
+	w.End()
+	if &b.Bytes()[body] != first {
+		t.Fatal("expected the body not to be moved")
+	}
+	expected := "HTTP/1.1 200 OK\r\nContent-Length: 5" + strings.Repeat(" ", contentLengthSize-1) + "\r\nX: 1\r\n\r\nhello"
+	if string(b.Bytes()) != expected {
+		t.Fatalf("expected %q, got %q", expected, b.Bytes())
+	}
+}
+
+func TestPipelined(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	NewWriter(b).RequestLine("GET", "/a").Header("Host", "x").EndHeaders().End()
+	NewWriter(b).RequestLine("POST", "/b").Header("Host", "x").ContentLength().EndHeaders().BodyString("hi").End()
+	r := bufio.NewReader(bytes.NewReader(b.Bytes()))
+	for _, expected := range []string{"/a", "/b"} {
+		req, err := http.ReadRequest(r)
+		if err != nil || req.RequestURI != expected {
+			t.Fatalf("expected %s, nil, got %v", expected, err)
+		}
+		io.ReadAll(req.Body)
+	}
+}
+
+func TestValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(w *Writer) *Writer
+		err  error
+	}{
+		{"empty method", func(w *Writer) *Writer { return w.RequestLine("", "/") }, ErrInvalidMethod},
+		{"method with space", func(w *Writer) *Writer { return w.RequestLine("GET X", "/") }, ErrInvalidMethod},
+		{"empty target", func(w *Writer) *Writer { return w.RequestLine("GET", "") }, ErrInvalidTarget},
+		{"target with space", func(w *Writer) *Writer { return w.RequestLine("GET", "/a b") }, ErrInvalidTarget},
+		{"target with newline", func(w *Writer) *Writer { return w.RequestLine("GET", "/a\r\nX: y") }, ErrInvalidTarget},
+		{"status too small", func(w *Writer) *Writer { return w.StatusLine(99, "") }, ErrInvalidStatus},
+		{"status too big", func(w *Writer) *Writer { return w.StatusLine(1000, "") }, ErrInvalidStatus},
+		{"reason with newline", func(w *Writer) *Writer { return w.StatusLine(200, "OK\r\n") }, ErrInvalidStatus},
+		{"header name with colon", func(w *Writer) *Writer { return w.StatusLine(200, "").Header("X:Y", "1") }, ErrInvalidHeaderName},
+		{"empty header name", func(w *Writer) *Writer { return w.StatusLine(200, "").Header("", "1") }, ErrInvalidHeaderName},
+		{"header value with newline", func(w *Writer) *Writer { return w.StatusLine(200, "").Header("X", "a\r\nInjected: 1") }, ErrInvalidHeaderValue},
+		{"folded header value", func(w *Writer) *Writer { return w.StatusLine(200, "").Header("X", "a\r\n b") }, ErrInvalidHeaderValue},
+		{"header value with nul", func(w *Writer) *Writer { return w.StatusLine(200, "").Header("X", "a\x00") }, ErrInvalidHeaderValue},
+		{"content length header", func(w *Writer) *Writer { return w.StatusLine(200, "").Header("content-length", "5") }, ErrFramingHeader},
+		{"transfer encoding header", func(w *Writer) *Writer {
+			return w.StatusLine(200, "").ContentLength().Header("Transfer-Encoding", "chunked")
+		}, ErrFramingHeader},
+		{"content length trailer", func(w *Writer) *Writer {
+			return w.StatusLine(200, "").Chunked().EndHeaders().Trailer("Content-Length", "5")
+		}, ErrFramingHeader},
+		{"trailer name", func(w *Writer) *Writer {
+			return w.StatusLine(200, "").Chunked().EndHeaders().Trailer("X Y", "1")
+		}, ErrInvalidHeaderName},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := safebuffer.NewResizableBuffer(nil)
+			w := test.fn(NewWriter(b))
+			w.Header("Later", "ignored")
+			if w.Err() != test.err {
+				t.Fatalf("expected %v, got %v", test.err, w.Err())
+			}
+			if bytes.Contains(b.Bytes(), []byte("ignored")) {
+				t.Fatal("expected writes after an error to be ignored")
+			}
+		})
+	}
+
+	t.Run("tab in value", func(t *testing.T) {
+		b := safebuffer.NewResizableBuffer(nil)
+		w := NewWriter(b).StatusLine(200, "").Header("X", "a\tb")
+		if w.Err() != nil {
+			t.Fatalf("expected nil error, got %v", w.Err())
+		}
+	})
+}
+
+func TestOrderPanics(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(w *Writer)
+	}{
+		{"header before start line", func(w *Writer) { w.Header("A", "b") }},
+		{"two start lines", func(w *Writer) { w.StatusLine(200, "").RequestLine("GET", "/") }},
+		{"body before headers end", func(w *Writer) { w.StatusLine(200, "").BodyString("x") }},
+		{"header after headers end", func(w *Writer) { w.StatusLine(200, "").EndHeaders().Header("A", "b") }},
+		{"trailer without chunked", func(w *Writer) { w.StatusLine(200, "").EndHeaders().Trailer("A", "b") }},
+		{"chunked with length", func(w *Writer) { w.StatusLine(200, "").ContentLength().Chunked() }},
+		{"length with chunked", func(w *Writer) { w.StatusLine(200, "").Chunked().ContentLength() }},
+		{"end twice", func(w *Writer) { w.StatusLine(200, "").EndHeaders().End().End() }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+			test.fn(NewWriter(safebuffer.NewResizableBuffer(nil)))
+		})
+	}
+}
+
+func TestBufferError(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil).WithMaxSize(32)
+	w := NewWriter(b).StatusLine(200, "").ContentLength().EndHeaders().BodyString(strings.Repeat("x", 100)).End()
+	if w.Err() != safebuffer.ErrTooLarge {
+		t.Fatalf("expected ErrTooLarge, got %v", w.Err())
+	}
+}
@@ -0,0 +1,49 @@
+package safebuffer
+
+import "errors"
+
+// ErrSubBufferOverflow is the error a linked sub-buffer holds once a write would take it past
+// the length it was made with.
+var ErrSubBufferOverflow = errors.New("safebuffer: write would overflow the sub-buffer")
+
+// LinkedSubBuffer is like SubBuffer, but the returned buffer stays linked to this one. If this
+// buffer grows or moves its data to make room for a prepend, the sub-buffer follows it to the
+// new backing array, so its writes are never lost. The sub-buffer cannot grow past the length
+// given. Writes that would go past it are ignored and Err returns ErrSubBufferOverflow. Using
+// the sub-buffer after this buffer is reset, drained, rolled back or has data inserted or
+// deleted panics, since it no longer has anywhere to point.
+func (b *ResizableBuffer) LinkedSubBuffer(length int) *ResizableBuffer {
+	if length < 0 {
+		length = min(len(b.buffer)-b.end(), b.left())
+	}
+	if !b.ensureCapacity(length) {
+		return &ResizableBuffer{buffer: []byte{}, err: b.err, linked: true}
+	}
+	sub := &ResizableBuffer{
+		linked:        true,
+		parent:        b,
+		parentGen:     b.epoch,
+		linkOffset:    b.offset,
+		linkLength:    length,
+		linkPrepended: b.prepended,
+	}
+	b.offset += length
+	sub.buffer = b.buffer[b.end()-length : b.end() : b.end()]
+	return sub
+}
+
+// resolve points a linked sub-buffer at where its data now is in its parent.
+func (b *ResizableBuffer) resolve() {
+	p := b.parent
+	if p.epoch != b.parentGen {
+		panic("safebuffer: linked sub-buffer used after its parent was reset or had data dropped")
+	}
+	p.check()
+	pos := p.start + b.linkOffset + p.prepended - b.linkPrepended
+	s := p.buffer[pos : pos+b.linkLength : pos+b.linkLength]
+	if len(s) != len(b.buffer) || len(s) > 0 && &s[0] != &b.buffer[0] {
+		// Anything made from this sub-buffer is now stale too.
+		b.buffer = s
+		b.gen++
+	}
+}
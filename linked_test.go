@@ -0,0 +1,138 @@
+package safebuffer
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLinkedSubBuffer(t *testing.T) {
+	t.Run("follows parent reallocation", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("a")
+		sub := rb.LinkedSubBuffer(4)
+		rb.CopyBytes(bytes.Repeat([]byte{'z'}, 100))
+		sub.Uint32(0x01020304, false)
+		expected := append([]byte{'a', 1, 2, 3, 4}, bytes.Repeat([]byte{'z'}, 100)...)
+		if !bytes.Equal(rb.Bytes(), expected) {
+			t.Fatalf("expected %v, got %v", expected, rb.Bytes())
+		}
+	})
+
+	t.Run("follows parent prepends", func(t *testing.T) {
+		for _, headroom := range []int{0, 2, 64} {
+			rb := NewResizableBuffer(nil).WithHeadroom(headroom).CopyString("a")
+			sub := rb.LinkedSubBuffer(3)
+			rb.CopyString("b").PrependString("<<<").PrependByte('>')
+			sub.CopyString("xy").PrependByte('w')
+			if string(rb.Bytes()) != "><<<awxyb" {
+				t.Fatalf("headroom %d: expected ><<<awxyb, got %q", headroom, rb.Bytes())
+			}
+			if string(sub.Bytes()) != "wxy" {
+				t.Fatalf("headroom %d: expected wxy, got %q", headroom, sub.Bytes())
+			}
+		}
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		rb := NewResizableBuffer(make([]byte, 64)).CopyString("a")
+		sub := rb.LinkedSubBuffer(3)
+		rb.CopyString("b")
+		sub.CopyString("xy").Uint16(1, true)
+		if sub.Err() != ErrSubBufferOverflow {
+			t.Fatalf("expected ErrSubBufferOverflow, got %v", sub.Err())
+		}
+		if string(rb.Bytes()) != "axy\x00b" {
+			t.Fatalf("expected parent to be untouched past the sub-buffer, got %q", rb.Bytes())
+		}
+		if _, err := sub.Write([]byte("z")); err != ErrSubBufferOverflow {
+			t.Fatalf("expected ErrSubBufferOverflow to stick, got %v", err)
+		}
+		sub.Reset(false).PrependString("123")
+		if sub.Err() != nil || string(rb.Bytes()) != "a123b" {
+			t.Fatalf("expected a123b, got %q, %v", rb.Bytes(), sub.Err())
+		}
+		sub.PrependByte('0')
+		if sub.Err() != ErrSubBufferOverflow {
+			t.Fatalf("expected ErrSubBufferOverflow, got %v", sub.Err())
+		}
+	})
+
+	t.Run("read from", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		sub := rb.LinkedSubBuffer(5)
+		if n, err := sub.ReadFrom(strings.NewReader("hello")); err != nil || n != 5 {
+			t.Fatalf("expected 5, nil, got %d, %v", n, err)
+		}
+		sub = rb.LinkedSubBuffer(5)
+		if _, err := sub.ReadFrom(strings.NewReader("hello world")); err != ErrSubBufferOverflow {
+			t.Fatalf("expected ErrSubBufferOverflow, got %v", err)
+		}
+		if string(rb.Bytes()) != "hellohello" {
+			t.Fatalf("expected hellohello, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("read into", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		sub := rb.LinkedSubBuffer(3)
+		if _, err := sub.ReadInto(stringReader{s: "hello"}, 10); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if _, err := sub.ReadInto(stringReader{s: "hello"}, 10); err != ErrSubBufferOverflow {
+			t.Fatalf("expected ErrSubBufferOverflow, got %v", err)
+		}
+		if string(rb.Bytes()) != "hel" {
+			t.Fatalf("expected hel, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("max size", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(4)
+		sub := rb.LinkedSubBuffer(8)
+		if rb.Err() != ErrTooLarge || sub.Err() != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v and %v", rb.Err(), sub.Err())
+		}
+		sub.CopyString("abc")
+		if sub.Len() != 0 {
+			t.Fatal("expected writes to be ignored")
+		}
+	})
+
+	t.Run("nested", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("<")
+		sub := rb.LinkedSubBuffer(6)
+		subSub := sub.CopyString("[").LinkedSubBuffer(4)
+		sub.CopyString("]")
+		rb.CopyString(">").PrependBytes(make([]byte, 100))
+		subSub.CopyString("abcd")
+		if string(rb.Bytes()[100:]) != "<[abcd]>" {
+			t.Fatalf("expected <[abcd]>, got %q", rb.Bytes()[100:])
+		}
+	})
+
+	stale := []struct {
+		name string
+		fn   func(b *ResizableBuffer)
+	}{
+		{"reset", func(b *ResizableBuffer) { b.Reset(false) }},
+		{"destroy", func(b *ResizableBuffer) { b.Destroy() }},
+		{"insert", func(b *ResizableBuffer) { b.InsertByte(1, 'x') }},
+		{"delete", func(b *ResizableBuffer) { b.DeleteRange(0, 1) }},
+		{"rollback", func(b *ResizableBuffer) { b.RollbackTo(b.Mark(), false) }},
+		{"drain", func(b *ResizableBuffer) { b.WriteTo(io.Discard) }},
+	}
+	for _, test := range stale {
+		t.Run("stale after "+test.name, func(t *testing.T) {
+			rb := NewResizableBuffer(nil).CopyString("ab")
+			sub := rb.LinkedSubBuffer(4)
+			test.fn(rb)
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+			sub.Byte(1)
+		})
+	}
+}
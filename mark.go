@@ -0,0 +1,96 @@
+package safebuffer
+
+// Mark is a point in a ResizableBuffer that can be rolled back to. This is made with Mark.
+type Mark struct {
+	depth     int
+	length    int
+	prepended int
+	edits     uint64
+	err       error
+}
+
+// Mark returns the current state of the buffer so that everything written after it can be
+// undone with RollbackTo, or kept with Commit. Marks nest, and each one must be released
+// with either RollbackTo or Commit. Reset releases all open marks.
+func (b *ResizableBuffer) Mark() Mark {
+	b.marks++
+	return Mark{
+		depth:     b.marks,
+		length:    b.offset,
+		prepended: b.prepended,
+		edits:     b.editsFrom + uint64(len(b.edits)),
+		err:       b.err,
+	}
+}
+
+// release releases the mark given and any marks made after it. This panics if it was already
+// released, since that is always a bug in the caller.
+func (b *ResizableBuffer) release(m Mark) {
+	if m.depth == 0 || m.depth > b.marks {
+		panic("safebuffer: mark was already released")
+	}
+	b.marks = m.depth - 1
+}
+
+// RollbackTo undoes everything written since the mark was made, including prepends, and
+// restores the error the buffer had at the time. Can optionally zero out the discarded bytes
+// to prevent information leaks. This always happens if the buffer is in secure mode. The mark
+// and any marks made after it are released. This panics if data the mark covers was drained,
+// or had data inserted into or deleted from it, since it can no longer be restored.
+func (b *ResizableBuffer) RollbackTo(m Mark, zeroOut bool) *ResizableBuffer {
+	b.release(m)
+	if m.edits < b.editsFrom {
+		panic("safebuffer: buffer was drained past the mark")
+	}
+
+	// Follow the edits made since the mark. Those in the bytes prepended since the mark change
+	// how many of them there are, which all get dropped. markStart and markEnd are where the
+	// data the mark covers now is, in the same terms as the edits.
+	markStart, markEnd := -m.prepended, m.length-m.prepended
+	extra := 0
+	for _, e := range b.edits[m.edits-b.editsFrom:] {
+		switch {
+		case e.pos >= markEnd:
+		case e.n > 0 && e.pos <= markStart, e.n < 0 && e.pos-e.n <= markStart:
+			extra += e.n
+			markStart += e.n
+			markEnd += e.n
+		default:
+			panic("safebuffer: data was inserted or deleted before the mark")
+		}
+	}
+	b.dropped()
+
+	// Bytes prepended since the mark sit in front of the data the mark covers.
+	front := b.prepended - m.prepended + extra
+	if front > b.offset || b.offset-front < m.length {
+		panic("safebuffer: buffer was drained or shrunk past the mark")
+	}
+	if extra != 0 {
+		// Dropping the edited prepends moves everything after them, so placeholders need to be
+		// told.
+		b.edits = append(b.edits, edit{pos: markStart - extra, n: -extra})
+	}
+	end := b.end()
+	discard := func(s []byte) {
+		if zeroOut {
+			clear(s)
+		} else {
+			b.wipe(s)
+		}
+	}
+	discard(b.buffer[b.start : b.start+front])
+	b.start += front
+	b.offset = m.length
+	b.prepended = m.prepended
+	discard(b.buffer[b.end():end])
+	b.err = m.err
+	return b
+}
+
+// Commit keeps everything written since the mark was made. The mark and any marks made after
+// it are released.
+func (b *ResizableBuffer) Commit(m Mark) *ResizableBuffer {
+	b.release(m)
+	return b
+}
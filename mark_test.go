@@ -0,0 +1,203 @@
+package safebuffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRollbackTo(t *testing.T) {
+	t.Run("appends", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("keep")
+		m := rb.Mark()
+		rb.CopyString(" discard").Uint64(1, true)
+		if rb.RollbackTo(m, false) != rb {
+			t.Fatal("expected RollbackTo to return the buffer")
+		}
+		if string(rb.Bytes()) != "keep" {
+			t.Fatalf("expected keep, got %q", rb.Bytes())
+		}
+		rb.CopyString("!")
+		if string(rb.Bytes()) != "keep!" {
+			t.Fatalf("expected keep!, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("prepends", func(t *testing.T) {
+		for _, headroom := range []int{0, 4, 64} {
+			rb := NewResizableBuffer(nil).WithHeadroom(headroom).CopyString("body").PrependString("<")
+			m := rb.Mark()
+			rb.PrependString("discard:").CopyString(":discard").PrependUint32(1, false)
+			rb.RollbackTo(m, false)
+			if string(rb.Bytes()) != "<body" {
+				t.Fatalf("headroom %d: expected <body, got %q", headroom, rb.Bytes())
+			}
+			rb.PrependString(">")
+			if string(rb.Bytes()) != "><body" {
+				t.Fatalf("headroom %d: expected ><body, got %q", headroom, rb.Bytes())
+			}
+		}
+	})
+
+	t.Run("placeholders before the mark", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		p := rb.ReserveUint16(false)
+		rb.CopyString("ab")
+		m := rb.Mark()
+		rb.PrependString("xyz").CopyString("cd")
+		rb.RollbackTo(m, false)
+		p.Set(0x0102)
+		if !bytes.Equal(rb.Bytes(), []byte{1, 2, 'a', 'b'}) {
+			t.Fatalf("expected placeholder to still be usable, got %v", rb.Bytes())
+		}
+	})
+
+	t.Run("zero out", func(t *testing.T) {
+		for _, secure := range []bool{false, true} {
+			rb := NewResizableBuffer(nil).CopyString("keep")
+			if secure {
+				rb.WithSecureWipe()
+			}
+			m := rb.Mark()
+			rb.CopyString("secret").PrependString("secret")
+			rb.RollbackTo(m, !secure)
+			if bytes.Contains(rb.buffer, []byte("secret")) {
+				t.Fatalf("secure %v: expected discarded bytes to be zeroed, got %q", secure, rb.buffer)
+			}
+		}
+	})
+
+	t.Run("restores error", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(8).CopyString("abcd")
+		m := rb.Mark()
+		rb.CopyString("efgh").CopyString("ijkl")
+		if rb.Err() != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", rb.Err())
+		}
+		rb.RollbackTo(m, false)
+		if rb.Err() != nil {
+			t.Fatalf("expected nil error, got %v", rb.Err())
+		}
+		rb.CopyString("1234")
+		if string(rb.Bytes()) != "abcd1234" {
+			t.Fatalf("expected abcd1234, got %q", rb.Bytes())
+		}
+	})
+}
+
+func TestMarkNesting(t *testing.T) {
+	t.Run("commit inner then rollback outer", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("a")
+		outer := rb.Mark()
+		rb.CopyString("b")
+		inner := rb.Mark()
+		rb.CopyString("c")
+		rb.Commit(inner)
+		if string(rb.Bytes()) != "abc" {
+			t.Fatalf("expected abc, got %q", rb.Bytes())
+		}
+		rb.RollbackTo(outer, false)
+		if string(rb.Bytes()) != "a" {
+			t.Fatalf("expected a, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("rollback inner then outer", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("a")
+		outer := rb.Mark()
+		rb.CopyString("b")
+		inner := rb.Mark()
+		rb.PrependString("c")
+		rb.RollbackTo(inner, false)
+		if string(rb.Bytes()) != "ab" {
+			t.Fatalf("expected ab, got %q", rb.Bytes())
+		}
+		rb.Commit(outer)
+		if string(rb.Bytes()) != "ab" {
+			t.Fatalf("expected ab, got %q", rb.Bytes())
+		}
+	})
+
+	expectPanic := func(t *testing.T, fn func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic")
+			}
+		}()
+		fn()
+	}
+
+	t.Run("released by outer", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		outer := rb.Mark()
+		inner := rb.Mark()
+		rb.Commit(outer)
+		expectPanic(t, func() { rb.RollbackTo(inner, false) })
+	})
+
+	t.Run("released twice", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		m := rb.Mark()
+		rb.Commit(m)
+		expectPanic(t, func() { rb.Commit(m) })
+	})
+
+	t.Run("released by reset", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		m := rb.Mark()
+		rb.Reset(false)
+		expectPanic(t, func() { rb.RollbackTo(m, false) })
+	})
+
+	t.Run("insert before the mark", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("01234567")
+		m := rb.Mark()
+		rb.CopyString("89").InsertString(5, "xx")
+		expectPanic(t, func() { rb.RollbackTo(m, false) })
+	})
+
+	t.Run("front deleted", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("01234567")
+		m := rb.Mark()
+		rb.CopyString("89").DeleteRange(0, 2).CopyString("ab")
+		expectPanic(t, func() { rb.RollbackTo(m, false) })
+	})
+
+	t.Run("empty edits before the mark", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("0123")
+		m := rb.Mark()
+		rb.CopyString("4567").DeleteRange(2, 2).InsertBytes(1, nil)
+		rb.RollbackTo(m, false)
+		if string(rb.Bytes()) != "0123" {
+			t.Fatalf("expected 0123, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("edits in prepends since the mark", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("ab")
+		p := rb.ReserveUint16(false)
+		rb.CopyString("cd")
+		m := rb.Mark()
+		rb.PrependString("hdr").InsertByte(1, 'q').DeleteRange(2, 4).CopyString("ef")
+		rb.RollbackTo(m, false)
+		p.SetLength()
+		expected := []byte{'a', 'b', 0, 2, 'c', 'd'}
+		if !bytes.Equal(rb.Bytes(), expected) {
+			t.Fatalf("expected %v, got %v", expected, rb.Bytes())
+		}
+	})
+
+	t.Run("edits after the mark", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("0123")
+		m := rb.Mark()
+		rb.CopyString("4567").InsertString(6, "xx").DeleteRange(4, 5)
+		rb.RollbackTo(m, false)
+		if string(rb.Bytes()) != "0123" {
+			t.Fatalf("expected 0123, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("zero mark", func(t *testing.T) {
+		expectPanic(t, func() { NewResizableBuffer(nil).Commit(Mark{}) })
+	})
+}
@@ -0,0 +1,119 @@
+// Package msgpack encodes MessagePack straight into a safebuffer.ResizableBuffer and decodes
+// it from a byte slice. The encoder always picks the smallest format that fits, and the
+// decoder hands back views into the input instead of copying wherever it can.
+package msgpack
+
+import "errors"
+
+var (
+	// ErrTypeMismatch is returned when the next value is not of the type being read. The read
+	// position is not moved.
+	ErrTypeMismatch = errors.New("msgpack: unexpected type")
+
+	// ErrOverflow is returned when an integer does not fit in the type being read.
+	ErrOverflow = errors.New("msgpack: integer overflows the type being read")
+
+	// ErrInvalid is returned when the data is not valid MessagePack, such as the never used
+	// byte 0xc1 or a malformed timestamp.
+	ErrInvalid = errors.New("msgpack: invalid data")
+
+	// ErrTooLong is held by a Writer after a string, binary, array, map or extension that is
+	// too long for MessagePack to describe, or an array or map header with a negative count.
+	ErrTooLong = errors.New("msgpack: length does not fit in 32 bits")
+)
+
+// Type is the kind of a MessagePack value, ignoring which format it was encoded in.
+type Type int
+
+// The types of MessagePack value. Invalid is only returned alongside an error.
+const (
+	Invalid Type = iota
+	Nil
+	Bool
+	Int
+	Float
+	String
+	Binary
+	Array
+	Map
+	Ext
+)
+
+// TimestampExt is the extension type used for timestamps.
+const TimestampExt int8 = -1
+
+// Format bytes from the specification.
+const (
+	fmtPosFixintMax = 0x7f
+	fmtFixmap       = 0x80
+	fmtFixarray     = 0x90
+	fmtFixstr       = 0xa0
+	fmtNil          = 0xc0
+	fmtNeverUsed    = 0xc1
+	fmtFalse        = 0xc2
+	fmtTrue         = 0xc3
+	fmtBin8         = 0xc4
+	fmtBin16        = 0xc5
+	fmtBin32        = 0xc6
+	fmtExt8         = 0xc7
+	fmtExt16        = 0xc8
+	fmtExt32        = 0xc9
+	fmtFloat32      = 0xca
+	fmtFloat64      = 0xcb
+	fmtUint8        = 0xcc
+	fmtUint16       = 0xcd
+	fmtUint32       = 0xce
+	fmtUint64       = 0xcf
+	fmtInt8         = 0xd0
+	fmtInt16        = 0xd1
+	fmtInt32        = 0xd2
+	fmtInt64        = 0xd3
+	fmtFixext1      = 0xd4
+	fmtFixext2      = 0xd5
+	fmtFixext4      = 0xd6
+	fmtFixext8      = 0xd7
+	fmtFixext16     = 0xd8
+	fmtStr8         = 0xd9
+	fmtStr16        = 0xda
+	fmtStr32        = 0xdb
+	fmtArray16      = 0xdc
+	fmtArray32      = 0xdd
+	fmtMap16        = 0xde
+	fmtMap32        = 0xdf
+	fmtNegFixintMin = 0xe0
+)
+
+// typeOf returns the type of the value starting with the byte given.
+func typeOf(b byte) Type {
+	switch {
+	case b <= fmtPosFixintMax || b >= fmtNegFixintMin:
+		return Int
+	case b < fmtFixarray:
+		return Map
+	case b < fmtFixstr:
+		return Array
+	case b < fmtNil:
+		return String
+	}
+	switch b {
+	case fmtNil:
+		return Nil
+	case fmtFalse, fmtTrue:
+		return Bool
+	case fmtBin8, fmtBin16, fmtBin32:
+		return Binary
+	case fmtExt8, fmtExt16, fmtExt32, fmtFixext1, fmtFixext2, fmtFixext4, fmtFixext8, fmtFixext16:
+		return Ext
+	case fmtFloat32, fmtFloat64:
+		return Float
+	case fmtUint8, fmtUint16, fmtUint32, fmtUint64, fmtInt8, fmtInt16, fmtInt32, fmtInt64:
+		return Int
+	case fmtStr8, fmtStr16, fmtStr32:
+		return String
+	case fmtArray16, fmtArray32:
+		return Array
+	case fmtMap16, fmtMap32:
+		return Map
+	}
+	return Invalid
+}
@@ -0,0 +1,274 @@
+package msgpack
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+func hexBytes(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(w *Writer)
+		eq   []byte
+	}{
+		{"nil", func(w *Writer) { w.Nil() }, []byte{0xc0}},
+		{"true", func(w *Writer) { w.Bool(true) }, []byte{0xc3}},
+		{"false", func(w *Writer) { w.Bool(false) }, []byte{0xc2}},
+		{"positive fixint", func(w *Writer) { w.Int(127) }, []byte{0x7f}},
+		{"uint8", func(w *Writer) { w.Int(128) }, []byte{0xcc, 0x80}},
+		{"uint16", func(w *Writer) { w.Uint(256) }, []byte{0xcd, 0x01, 0x00}},
+		{"uint32", func(w *Writer) { w.Uint(1 << 16) }, []byte{0xce, 0, 1, 0, 0}},
+		{"uint64", func(w *Writer) { w.Uint(1 << 32) }, []byte{0xcf, 0, 0, 0, 1, 0, 0, 0, 0}},
+		{"negative fixint", func(w *Writer) { w.Int(-32) }, []byte{0xe0}},
+		{"minus one", func(w *Writer) { w.Int(-1) }, []byte{0xff}},
+		{"int8", func(w *Writer) { w.Int(-33) }, []byte{0xd0, 0xdf}},
+		{"int16", func(w *Writer) { w.Int(-129) }, []byte{0xd1, 0xff, 0x7f}},
+		{"int32", func(w *Writer) { w.Int(math.MinInt16 - 1) }, []byte{0xd2, 0xff, 0xff, 0x7f, 0xff}},
+		{"int64", func(w *Writer) { w.Int(math.MinInt64) }, []byte{0xd3, 0x80, 0, 0, 0, 0, 0, 0, 0}},
+		{"float32", func(w *Writer) { w.Float32(1.5) }, []byte{0xca, 0x3f, 0xc0, 0, 0}},
+		{"float64", func(w *Writer) { w.Float64(1.5) }, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"fixstr", func(w *Writer) { w.String("hi") }, []byte{0xa2, 'h', 'i'}},
+		{"empty fixstr", func(w *Writer) { w.String("") }, []byte{0xa0}},
+		{"str8", func(w *Writer) { w.String(strings.Repeat("a", 32)) }, hexBytes([]byte{0xd9, 32}, bytes.Repeat([]byte{'a'}, 32))},
+		{"str16", func(w *Writer) { w.StringBytes(bytes.Repeat([]byte{'a'}, 256)) }, hexBytes([]byte{0xda, 1, 0}, bytes.Repeat([]byte{'a'}, 256))},
+		{"str32", func(w *Writer) { w.String(strings.Repeat("a", 1<<16)) }, hexBytes([]byte{0xdb, 0, 1, 0, 0}, bytes.Repeat([]byte{'a'}, 1<<16))},
+		{"bin8", func(w *Writer) { w.Binary([]byte{1, 2}) }, []byte{0xc4, 2, 1, 2}},
+		{"bin16", func(w *Writer) { w.Binary(make([]byte, 256)) }, hexBytes([]byte{0xc5, 1, 0}, make([]byte, 256))},
+		{"bin32", func(w *Writer) { w.Binary(make([]byte, 1<<16)) }, hexBytes([]byte{0xc6, 0, 1, 0, 0}, make([]byte, 1<<16))},
+		{"fixarray", func(w *Writer) { w.ArrayHeader(15) }, []byte{0x9f}},
+		{"array16", func(w *Writer) { w.ArrayHeader(16) }, []byte{0xdc, 0, 16}},
+		{"array32", func(w *Writer) { w.ArrayHeader(1 << 16) }, []byte{0xdd, 0, 1, 0, 0}},
+		{"fixmap", func(w *Writer) { w.MapHeader(1).String("a").Int(1) }, []byte{0x81, 0xa1, 'a', 1}},
+		{"map16", func(w *Writer) { w.MapHeader(16) }, []byte{0xde, 0, 16}},
+		{"map32", func(w *Writer) { w.MapHeader(1 << 16) }, []byte{0xdf, 0, 1, 0, 0}},
+		{"fixext1", func(w *Writer) { w.Ext(5, []byte{1}) }, []byte{0xd4, 5, 1}},
+		{"fixext2", func(w *Writer) { w.Ext(5, []byte{1, 2}) }, []byte{0xd5, 5, 1, 2}},
+		{"fixext4", func(w *Writer) { w.Ext(5, make([]byte, 4)) }, []byte{0xd6, 5, 0, 0, 0, 0}},
+		{"fixext8", func(w *Writer) { w.Ext(5, make([]byte, 8)) }, hexBytes([]byte{0xd7, 5}, make([]byte, 8))},
+		{"fixext16", func(w *Writer) { w.Ext(-5, make([]byte, 16)) }, hexBytes([]byte{0xd8, 0xfb}, make([]byte, 16))},
+		{"ext8", func(w *Writer) { w.Ext(5, []byte{1, 2, 3}) }, []byte{0xc7, 3, 5, 1, 2, 3}},
+		{"empty ext8", func(w *Writer) { w.Ext(5, nil) }, []byte{0xc7, 0, 5}},
+		{"ext16", func(w *Writer) { w.Ext(5, make([]byte, 256)) }, hexBytes([]byte{0xc8, 1, 0, 5}, make([]byte, 256))},
+		{"ext32", func(w *Writer) { w.Ext(5, make([]byte, 1<<16)) }, hexBytes([]byte{0xc9, 0, 1, 0, 0, 5}, make([]byte, 1<<16))},
+		{"timestamp32", func(w *Writer) { w.Time(time.Unix(1, 0)) }, []byte{0xd6, 0xff, 0, 0, 0, 1}},
+		{"timestamp64", func(w *Writer) { w.Time(time.Unix(1, 1)) }, []byte{0xd7, 0xff, 0, 0, 0, 0x04, 0, 0, 0, 1}},
+		{"timestamp96", func(w *Writer) { w.Time(time.Unix(-1, 0)) }, []byte{0xc7, 12, 0xff, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := safebuffer.NewResizableBuffer(nil)
+			w := NewWriter(b)
+			test.fn(w)
+			if w.Err() != nil {
+				t.Fatalf("expected nil error, got %v", w.Err())
+			}
+			if !bytes.Equal(b.Bytes(), test.eq) {
+				t.Fatalf("expected % x, got % x", test.eq, b.Bytes())
+			}
+
+			// Every value written must be readable back as one value. Headers are written
+			// without their items, so only the header is read.
+			r := NewReader(b.Bytes())
+			for r.Len() > 0 {
+				var err error
+				switch typ, _ := r.Peek(); typ {
+				case Array:
+					_, err = r.ReadArrayHeader()
+				case Map:
+					_, err = r.ReadMapHeader()
+				default:
+					err = r.Skip()
+				}
+				if err != nil {
+					t.Fatalf("expected nil error reading back, got %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	ts := time.Date(2300, 1, 2, 3, 4, 5, 6, time.UTC)
+	ints := []int64{0, 1, 127, 128, 255, 256, 65535, 65536, math.MaxInt64, -1, -32, -33, -128, -129, -32768, -32769, math.MinInt64}
+	w := NewWriter(b).ArrayHeader(len(ints))
+	for _, v := range ints {
+		w.Int(v)
+	}
+	w.MapHeader(2).String("name").String("safebuffer").String("data").Binary([]byte{1, 2, 3})
+	w.Nil().Bool(true).Float32(2.5).Float64(math.Pi).Uint(math.MaxUint64).Time(ts).Ext(42, []byte("ext"))
+
+	r := NewReader(b.Bytes())
+	n, err := r.ReadArrayHeader()
+	if err != nil || n != len(ints) {
+		t.Fatalf("expected %d, nil, got %d, %v", len(ints), n, err)
+	}
+	for _, expected := range ints {
+		if v, err := r.ReadInt(); err != nil || v != expected {
+			t.Fatalf("expected %d, nil, got %d, %v", expected, v, err)
+		}
+	}
+	if n, err := r.ReadMapHeader(); err != nil || n != 2 {
+		t.Fatalf("expected 2, nil, got %d, %v", n, err)
+	}
+	if s, err := r.ReadString(); err != nil || s != "name" {
+		t.Fatalf("expected name, got %q, %v", s, err)
+	}
+	if s, err := r.ReadStringBytes(); err != nil || string(s) != "safebuffer" {
+		t.Fatalf("expected safebuffer, got %q, %v", s, err)
+	}
+	if err := r.Skip(); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if p, err := r.ReadBinary(); err != nil || !bytes.Equal(p, []byte{1, 2, 3}) {
+		t.Fatalf("expected 1 2 3, got %v, %v", p, err)
+	}
+	if err := r.ReadNil(); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if v, err := r.ReadBool(); err != nil || !v {
+		t.Fatalf("expected true, got %v, %v", v, err)
+	}
+	if v, err := r.ReadFloat32(); err != nil || v != 2.5 {
+		t.Fatalf("expected 2.5, got %v, %v", v, err)
+	}
+	if v, err := r.ReadFloat64(); err != nil || v != math.Pi {
+		t.Fatalf("expected pi, got %v, %v", v, err)
+	}
+	if v, err := r.ReadUint(); err != nil || v != math.MaxUint64 {
+		t.Fatalf("expected max uint64, got %v, %v", v, err)
+	}
+	if v, err := r.ReadTime(); err != nil || !v.Equal(ts) {
+		t.Fatalf("expected %v, got %v, %v", ts, v, err)
+	}
+	if typ, data, err := r.ReadExt(); err != nil || typ != 42 || string(data) != "ext" {
+		t.Fatalf("expected 42 ext, got %d %q, %v", typ, data, err)
+	}
+	if r.Len() != 0 {
+		t.Fatalf("expected everything to be read, %d bytes left", r.Len())
+	}
+}
+
+func TestTimeFormats(t *testing.T) {
+	times := []time.Time{
+		time.Unix(0, 0),
+		time.Unix(math.MaxUint32, 0),
+		time.Unix(math.MaxUint32+1, 0),
+		time.Unix(1<<34-1, 999999999),
+		time.Unix(1<<34, 0),
+		time.Unix(-62135596800, 0),
+		time.Unix(1, 500),
+	}
+	sizes := []int{6, 6, 10, 10, 15, 15, 10}
+	for i, ts := range times {
+		b := safebuffer.NewResizableBuffer(nil)
+		NewWriter(b).Time(ts)
+		if b.Len() != sizes[i] {
+			t.Fatalf("%v: expected %d bytes, got %d", ts, sizes[i], b.Len())
+		}
+		v, err := NewReader(b.Bytes()).ReadTime()
+		if err != nil || !v.Equal(ts) {
+			t.Fatalf("expected %v, got %v, %v", ts, v, err)
+		}
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		fn   func(r *Reader) error
+		err  error
+	}{
+		{"empty", nil, func(r *Reader) error { _, err := r.ReadInt(); return err }, safebuffer.ErrShortRead},
+		{"short uint16", []byte{0xcd, 1}, func(r *Reader) error { _, err := r.ReadInt(); return err }, safebuffer.ErrShortRead},
+		{"short string", []byte{0xa3, 'a'}, func(r *Reader) error { _, err := r.ReadString(); return err }, safebuffer.ErrShortRead},
+		{"int as string", []byte{1}, func(r *Reader) error { _, err := r.ReadString(); return err }, ErrTypeMismatch},
+		{"string as int", []byte{0xa0}, func(r *Reader) error { _, err := r.ReadInt(); return err }, ErrTypeMismatch},
+		{"float64 as float32", []byte{0xcb, 0, 0, 0, 0, 0, 0, 0, 0}, func(r *Reader) error { _, err := r.ReadFloat32(); return err }, ErrTypeMismatch},
+		{"uint64 as int64", []byte{0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, func(r *Reader) error { _, err := r.ReadInt(); return err }, ErrOverflow},
+		{"negative as uint", []byte{0xff}, func(r *Reader) error { _, err := r.ReadUint(); return err }, ErrOverflow},
+		{"array as map", []byte{0x90}, func(r *Reader) error { _, err := r.ReadMapHeader(); return err }, ErrTypeMismatch},
+		{"never used", []byte{0xc1}, func(r *Reader) error { _, err := r.Peek(); return err }, ErrInvalid},
+		{"skip never used", []byte{0x91, 0xc1}, func(r *Reader) error { return r.Skip() }, ErrInvalid},
+		{"skip short array", []byte{0x92, 1}, func(r *Reader) error { return r.Skip() }, safebuffer.ErrShortRead},
+		{"bad timestamp length", []byte{0xd5, 0xff, 0, 0}, func(r *Reader) error { _, err := r.ReadTime(); return err }, ErrInvalid},
+		{"bad timestamp nanoseconds", []byte{0xc7, 12, 0xff, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0}, func(r *Reader) error { _, err := r.ReadTime(); return err }, ErrInvalid},
+		{"ext as timestamp", []byte{0xd4, 1, 0}, func(r *Reader) error { _, err := r.ReadTime(); return err }, ErrTypeMismatch},
+		{"deep nesting", bytes.Repeat([]byte{0x91}, maxSkipDepth+2), func(r *Reader) error { return r.Skip() }, ErrInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewReader(test.data)
+			if err := test.fn(r); err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if r.Offset() != 0 {
+				t.Fatalf("expected the read position not to move, got %d", r.Offset())
+			}
+		})
+	}
+}
+
+func TestPeek(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	NewWriter(b).Nil().Bool(false).Int(-5).Float32(1).String("a").Binary(nil).ArrayHeader(0).MapHeader(0).Ext(1, nil)
+	r := NewReader(b.Bytes())
+	for _, expected := range []Type{Nil, Bool, Int, Float, String, Binary, Array, Map, Ext} {
+		typ, err := r.Peek()
+		if err != nil || typ != expected {
+			t.Fatalf("expected %v, nil, got %v, %v", expected, typ, err)
+		}
+		r.Skip()
+	}
+}
+
+func TestReaderDoesNotAllocate(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	NewWriter(b).String("hello").Binary([]byte("world")).Int(-1000).Float64(1.5).Ext(3, []byte{1, 2}).ArrayHeader(2).Int(1).Int(2)
+	data := b.Bytes()
+	allocs := testing.AllocsPerRun(100, func() {
+		r := NewReader(data)
+		r.ReadStringBytes()
+		r.ReadBinary()
+		r.ReadInt()
+		r.ReadFloat64()
+		r.ReadExt()
+		r.Skip()
+	})
+	if allocs > 1 {
+		t.Fatalf("expected at most the reader to be allocated, got %v allocations", allocs)
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil).WithMaxSize(4)
+	w := NewWriter(b).String("hello")
+	if w.Err() != safebuffer.ErrTooLarge {
+		t.Fatalf("expected ErrTooLarge, got %v", w.Err())
+	}
+
+	w = NewWriter(safebuffer.NewResizableBuffer(nil))
+	w.length(math.MaxUint32+1, 0, 0, fmtBin8, fmtBin16, fmtBin32)
+	w.Int(1)
+	if w.Err() != ErrTooLong || w.b.Len() != 0 {
+		t.Fatalf("expected ErrTooLong and nothing written, got %v and %d bytes", w.Err(), w.b.Len())
+	}
+
+	for _, header := range []func(w *Writer, n int) *Writer{(*Writer).ArrayHeader, (*Writer).MapHeader} {
+		w = NewWriter(safebuffer.NewResizableBuffer(nil))
+		header(w, -1).Int(1)
+		if w.Err() != ErrTooLong || w.b.Len() != 0 {
+			t.Fatalf("expected ErrTooLong and nothing written, got %v and %d bytes", w.Err(), w.b.Len())
+		}
+	}
+}
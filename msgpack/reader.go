@@ -0,0 +1,481 @@
+package msgpack
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// Reader decodes MessagePack values from a byte slice. Strings, binary data and extensions
+// can be read as views into the slice, so nothing is copied or allocated. A read that fails
+// does not move the read position. This is single threaded.
+type Reader struct {
+	p   []byte
+	off int
+}
+
+// NewReader creates a new Reader over the slice given. The slice is not copied, so if it came
+// from ResizableBuffer.Bytes, it is only valid until the next call to Reset.
+func NewReader(p []byte) *Reader {
+	return &Reader{p: p}
+}
+
+// Offset returns the number of bytes that have been read.
+func (r *Reader) Offset() int {
+	return r.off
+}
+
+// Len returns the number of bytes left to read.
+func (r *Reader) Len() int {
+	return len(r.p) - r.off
+}
+
+// cursor reads from the data after the read position. Reads only move the reader once they
+// have fully succeeded, by calling done.
+type cursor struct {
+	p   []byte
+	off int
+}
+
+func (r *Reader) cursor() cursor {
+	return cursor{p: r.p[r.off:]}
+}
+
+func (r *Reader) done(c cursor) {
+	r.off += c.off
+}
+
+func (c *cursor) next(n int) ([]byte, error) {
+	if n < 0 || len(c.p)-c.off < n {
+		return nil, safebuffer.ErrShortRead
+	}
+	s := c.p[c.off : c.off+n]
+	c.off += n
+	return s, nil
+}
+
+func (c *cursor) byte() (byte, error) {
+	s, err := c.next(1)
+	if err != nil {
+		return 0, err
+	}
+	return s[0], nil
+}
+
+// uint reads a big endian unsigned integer of n bytes.
+func (c *cursor) uint(n int) (uint64, error) {
+	s, err := c.next(n)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 1:
+		return uint64(s[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(s)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(s)), nil
+	}
+	return binary.BigEndian.Uint64(s), nil
+}
+
+// length reads the length that follows a str, bin, array, map or ext format byte.
+func (c *cursor) length(b byte) (int, error) {
+	var n uint64
+	var err error
+	switch b {
+	case fmtStr8, fmtBin8, fmtExt8:
+		n, err = c.uint(1)
+	case fmtStr16, fmtBin16, fmtArray16, fmtMap16, fmtExt16:
+		n, err = c.uint(2)
+	default:
+		n, err = c.uint(4)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if n > math.MaxInt32 {
+		return 0, ErrInvalid
+	}
+	return int(n), nil
+}
+
+// Peek returns the type of the next value without reading it.
+func (r *Reader) Peek() (Type, error) {
+	c := r.cursor()
+	b, err := c.byte()
+	if err != nil {
+		return Invalid, err
+	}
+	if t := typeOf(b); t != Invalid {
+		return t, nil
+	}
+	return Invalid, ErrInvalid
+}
+
+// ReadNil reads nil.
+func (r *Reader) ReadNil() error {
+	c := r.cursor()
+	b, err := c.byte()
+	if err != nil {
+		return err
+	}
+	if b != fmtNil {
+		return ErrTypeMismatch
+	}
+	r.done(c)
+	return nil
+}
+
+// ReadBool reads a boolean.
+func (r *Reader) ReadBool() (bool, error) {
+	c := r.cursor()
+	b, err := c.byte()
+	if err != nil {
+		return false, err
+	}
+	if b != fmtTrue && b != fmtFalse {
+		return false, ErrTypeMismatch
+	}
+	r.done(c)
+	return b == fmtTrue, nil
+}
+
+// integer reads an integer in any format. Unsigned values are returned in u with neg false,
+// and negative values in i with neg true.
+func (c *cursor) integer() (u uint64, i int64, neg bool, err error) {
+	b, err := c.byte()
+	if err != nil {
+		return 0, 0, false, err
+	}
+	switch {
+	case b <= fmtPosFixintMax:
+		return uint64(b), 0, false, nil
+	case b >= fmtNegFixintMin:
+		return 0, int64(int8(b)), true, nil
+	}
+	switch b {
+	case fmtUint8, fmtUint16, fmtUint32, fmtUint64:
+		u, err = c.uint(1 << (b - fmtUint8))
+		return u, 0, false, err
+	case fmtInt8, fmtInt16, fmtInt32, fmtInt64:
+		n := 1 << (b - fmtInt8)
+		u, err = c.uint(n)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		// Sign extend from n bytes.
+		shift := 64 - 8*n
+		i = int64(u<<shift) >> shift
+		if i >= 0 {
+			return uint64(i), 0, false, nil
+		}
+		return 0, i, true, nil
+	}
+	return 0, 0, false, ErrTypeMismatch
+}
+
+// ReadInt reads an integer in any format as an int64.
+func (r *Reader) ReadInt() (int64, error) {
+	c := r.cursor()
+	u, i, neg, err := c.integer()
+	if err != nil {
+		return 0, err
+	}
+	if !neg {
+		if u > math.MaxInt64 {
+			return 0, ErrOverflow
+		}
+		i = int64(u)
+	}
+	r.done(c)
+	return i, nil
+}
+
+// ReadUint reads an integer in any format as a uint64.
+func (r *Reader) ReadUint() (uint64, error) {
+	c := r.cursor()
+	u, _, neg, err := c.integer()
+	if err != nil {
+		return 0, err
+	}
+	if neg {
+		return 0, ErrOverflow
+	}
+	r.done(c)
+	return u, nil
+}
+
+// ReadFloat32 reads a single precision float.
+func (r *Reader) ReadFloat32() (float32, error) {
+	c := r.cursor()
+	b, err := c.byte()
+	if err != nil {
+		return 0, err
+	}
+	if b != fmtFloat32 {
+		return 0, ErrTypeMismatch
+	}
+	u, err := c.uint(4)
+	if err != nil {
+		return 0, err
+	}
+	r.done(c)
+	return math.Float32frombits(uint32(u)), nil
+}
+
+// ReadFloat64 reads a float of either precision as a float64.
+func (r *Reader) ReadFloat64() (float64, error) {
+	c := r.cursor()
+	b, err := c.byte()
+	if err != nil {
+		return 0, err
+	}
+	var v float64
+	switch b {
+	case fmtFloat32:
+		u, err := c.uint(4)
+		if err != nil {
+			return 0, err
+		}
+		v = float64(math.Float32frombits(uint32(u)))
+	case fmtFloat64:
+		u, err := c.uint(8)
+		if err != nil {
+			return 0, err
+		}
+		v = math.Float64frombits(u)
+	default:
+		return 0, ErrTypeMismatch
+	}
+	r.done(c)
+	return v, nil
+}
+
+// ReadStringBytes reads a string and returns a view of it, without copying.
+func (r *Reader) ReadStringBytes() ([]byte, error) {
+	c := r.cursor()
+	b, err := c.byte()
+	if err != nil {
+		return nil, err
+	}
+	n := int(b - fmtFixstr)
+	switch {
+	case typeOf(b) != String:
+		return nil, ErrTypeMismatch
+	case b >= fmtStr8:
+		if n, err = c.length(b); err != nil {
+			return nil, err
+		}
+	}
+	s, err := c.next(n)
+	if err != nil {
+		return nil, err
+	}
+	r.done(c)
+	return s, nil
+}
+
+// ReadString reads a string.
+func (r *Reader) ReadString() (string, error) {
+	s, err := r.ReadStringBytes()
+	return string(s), err
+}
+
+// ReadBinary reads binary data and returns a view of it, without copying.
+func (r *Reader) ReadBinary() ([]byte, error) {
+	c := r.cursor()
+	b, err := c.byte()
+	if err != nil {
+		return nil, err
+	}
+	if typeOf(b) != Binary {
+		return nil, ErrTypeMismatch
+	}
+	n, err := c.length(b)
+	if err != nil {
+		return nil, err
+	}
+	s, err := c.next(n)
+	if err != nil {
+		return nil, err
+	}
+	r.done(c)
+	return s, nil
+}
+
+// header reads the count of an array or map.
+func (r *Reader) header(t Type, fix byte) (int, error) {
+	c := r.cursor()
+	b, err := c.byte()
+	if err != nil {
+		return 0, err
+	}
+	if typeOf(b) != t {
+		return 0, ErrTypeMismatch
+	}
+	n := int(b - fix)
+	if b >= fmtArray16 {
+		if n, err = c.length(b); err != nil {
+			return 0, err
+		}
+	}
+	r.done(c)
+	return n, nil
+}
+
+// ReadArrayHeader reads the header of an array and returns the number of items in it.
+func (r *Reader) ReadArrayHeader() (int, error) {
+	return r.header(Array, fmtFixarray)
+}
+
+// ReadMapHeader reads the header of a map and returns the number of pairs in it.
+func (r *Reader) ReadMapHeader() (int, error) {
+	return r.header(Map, fmtFixmap)
+}
+
+// ext reads an extension.
+func (c *cursor) ext() (int8, []byte, error) {
+	b, err := c.byte()
+	if err != nil {
+		return 0, nil, err
+	}
+	var n int
+	switch b {
+	case fmtFixext1, fmtFixext2, fmtFixext4, fmtFixext8, fmtFixext16:
+		n = 1 << (b - fmtFixext1)
+	case fmtExt8, fmtExt16, fmtExt32:
+		if n, err = c.length(b); err != nil {
+			return 0, nil, err
+		}
+	default:
+		return 0, nil, ErrTypeMismatch
+	}
+	typ, err := c.byte()
+	if err != nil {
+		return 0, nil, err
+	}
+	data, err := c.next(n)
+	if err != nil {
+		return 0, nil, err
+	}
+	return int8(typ), data, nil
+}
+
+// ReadExt reads an extension and returns its type and a view of its data, without copying.
+func (r *Reader) ReadExt() (int8, []byte, error) {
+	c := r.cursor()
+	typ, data, err := c.ext()
+	if err != nil {
+		return 0, nil, err
+	}
+	r.done(c)
+	return typ, data, nil
+}
+
+// ReadTime reads a timestamp extension. The time returned is in the local time zone.
+func (r *Reader) ReadTime() (time.Time, error) {
+	c := r.cursor()
+	typ, data, err := c.ext()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if typ != TimestampExt {
+		return time.Time{}, ErrTypeMismatch
+	}
+	var sec int64
+	var nsec uint32
+	switch len(data) {
+	case 4:
+		sec = int64(binary.BigEndian.Uint32(data))
+	case 8:
+		v := binary.BigEndian.Uint64(data)
+		sec = int64(v & (1<<34 - 1))
+		nsec = uint32(v >> 34)
+	case 12:
+		nsec = binary.BigEndian.Uint32(data)
+		sec = int64(binary.BigEndian.Uint64(data[4:]))
+	default:
+		return time.Time{}, ErrInvalid
+	}
+	if nsec > 999999999 {
+		return time.Time{}, ErrInvalid
+	}
+	r.done(c)
+	return time.Unix(sec, int64(nsec)), nil
+}
+
+// Skip skips the next value, including everything inside it if it is an array or map.
+func (r *Reader) Skip() error {
+	c := r.cursor()
+	if err := c.skip(0); err != nil {
+		return err
+	}
+	r.done(c)
+	return nil
+}
+
+// maxSkipDepth is how deeply Skip follows nested arrays and maps.
+const maxSkipDepth = 512
+
+func (c *cursor) skip(depth int) error {
+	if depth > maxSkipDepth {
+		return ErrInvalid
+	}
+	if c.off >= len(c.p) {
+		return safebuffer.ErrShortRead
+	}
+	b := c.p[c.off]
+	var n, items int
+	var err error
+	switch t := typeOf(b); t {
+	case Invalid:
+		return ErrInvalid
+	case Nil, Bool:
+		_, err = c.next(1)
+		return err
+	case Int:
+		_, _, _, err = c.integer()
+		return err
+	case Float:
+		c.off++
+		_, err = c.next(4 << (b - fmtFloat32))
+		return err
+	case Ext:
+		_, _, err = c.ext()
+		return err
+	case String, Binary:
+		c.off++
+		n = int(b - fmtFixstr)
+		if b >= fmtBin8 {
+			if n, err = c.length(b); err != nil {
+				return err
+			}
+		}
+		_, err = c.next(n)
+		return err
+	case Array, Map:
+		fix := byte(fmtFixarray)
+		if t == Map {
+			fix = fmtFixmap
+		}
+		c.off++
+		items = int(b - fix)
+		if b >= fmtArray16 {
+			if items, err = c.length(b); err != nil {
+				return err
+			}
+		}
+		if t == Map {
+			items *= 2
+		}
+		for i := 0; i < items; i++ {
+			if err := c.skip(depth + 1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package msgpack
+
+import (
+	"math"
+	"time"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// Writer writes MessagePack values into a ResizableBuffer. Arrays and maps are written as a
+// header giving the number of items, followed by the items themselves. Once an error is held,
+// all writes are ignored, so a chain of writes can be checked once at the end with Err.
+type Writer struct {
+	b   *safebuffer.ResizableBuffer
+	err error
+}
+
+// NewWriter creates a new Writer that appends to the buffer given.
+func NewWriter(b *safebuffer.ResizableBuffer) *Writer {
+	return &Writer{b: b}
+}
+
+// Err returns the error held by the writer, or the error held by the buffer.
+func (w *Writer) Err() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.b.Err()
+}
+
+// length writes the smallest of the three formats given that fits n, or the fixed format if
+// n is below fixMax. fix is 0 if there is no fixed format.
+func (w *Writer) length(n int, fix byte, fixMax int, f8, f16, f32 byte) bool {
+	if w.err != nil {
+		return false
+	}
+	switch {
+	case n < 0:
+		w.err = ErrTooLong
+		return false
+	case n < fixMax:
+		w.b.Byte(fix | byte(n))
+	case f8 != 0 && n <= math.MaxUint8:
+		w.b.Byte(f8).Byte(byte(n))
+	case n <= math.MaxUint16:
+		w.b.Byte(f16).Uint16(uint16(n), false)
+	case uint64(n) <= math.MaxUint32:
+		w.b.Byte(f32).Uint32(uint32(n), false)
+	default:
+		w.err = ErrTooLong
+		return false
+	}
+	return true
+}
+
+// timestampExtByte is TimestampExt as it is written.
+const timestampExtByte = byte(0xff)
+
+// Nil writes nil.
+func (w *Writer) Nil() *Writer {
+	if w.err != nil {
+		return w
+	}
+	w.b.Byte(fmtNil)
+	return w
+}
+
+// Bool writes a boolean.
+func (w *Writer) Bool(v bool) *Writer {
+	if w.err != nil {
+		return w
+	}
+	if v {
+		w.b.Byte(fmtTrue)
+	} else {
+		w.b.Byte(fmtFalse)
+	}
+	return w
+}
+
+// Int writes a signed integer in the smallest format that holds it.
+func (w *Writer) Int(v int64) *Writer {
+	if w.err != nil {
+		return w
+	}
+	switch {
+	case v >= 0:
+		return w.Uint(uint64(v))
+	case v >= -32:
+		w.b.Byte(byte(v))
+	case v >= math.MinInt8:
+		w.b.Byte(fmtInt8).Byte(byte(v))
+	case v >= math.MinInt16:
+		w.b.Byte(fmtInt16).Int16(int16(v), false)
+	case v >= math.MinInt32:
+		w.b.Byte(fmtInt32).Int32(int32(v), false)
+	default:
+		w.b.Byte(fmtInt64).Int64(v, false)
+	}
+	return w
+}
+
+// Uint writes an unsigned integer in the smallest format that holds it.
+func (w *Writer) Uint(v uint64) *Writer {
+	if w.err != nil {
+		return w
+	}
+	switch {
+	case v <= fmtPosFixintMax:
+		w.b.Byte(byte(v))
+	case v <= math.MaxUint8:
+		w.b.Byte(fmtUint8).Byte(byte(v))
+	case v <= math.MaxUint16:
+		w.b.Byte(fmtUint16).Uint16(uint16(v), false)
+	case v <= math.MaxUint32:
+		w.b.Byte(fmtUint32).Uint32(uint32(v), false)
+	default:
+		w.b.Byte(fmtUint64).Uint64(v, false)
+	}
+	return w
+}
+
+// Float32 writes a single precision float.
+func (w *Writer) Float32(v float32) *Writer {
+	if w.err != nil {
+		return w
+	}
+	w.b.Byte(fmtFloat32).Float32(v, false)
+	return w
+}
+
+// Float64 writes a double precision float.
+func (w *Writer) Float64(v float64) *Writer {
+	if w.err != nil {
+		return w
+	}
+	w.b.Byte(fmtFloat64).Float64(v, false)
+	return w
+}
+
+// String writes a UTF-8 string.
+func (w *Writer) String(s string) *Writer {
+	if w.length(len(s), fmtFixstr, 32, fmtStr8, fmtStr16, fmtStr32) {
+		w.b.CopyString(s)
+	}
+	return w
+}
+
+// StringBytes writes a UTF-8 string from a byte slice.
+func (w *Writer) StringBytes(p []byte) *Writer {
+	if w.length(len(p), fmtFixstr, 32, fmtStr8, fmtStr16, fmtStr32) {
+		w.b.CopyBytes(p)
+	}
+	return w
+}
+
+// Binary writes binary data.
+func (w *Writer) Binary(p []byte) *Writer {
+	if w.length(len(p), 0, 0, fmtBin8, fmtBin16, fmtBin32) {
+		w.b.CopyBytes(p)
+	}
+	return w
+}
+
+// ArrayHeader starts an array of n items.
+func (w *Writer) ArrayHeader(n int) *Writer {
+	w.length(n, fmtFixarray, 16, 0, fmtArray16, fmtArray32)
+	return w
+}
+
+// MapHeader starts a map of n pairs. Each key must be followed by its value.
+func (w *Writer) MapHeader(n int) *Writer {
+	w.length(n, fmtFixmap, 16, 0, fmtMap16, fmtMap32)
+	return w
+}
+
+// Ext writes an extension of the type given.
+func (w *Writer) Ext(typ int8, data []byte) *Writer {
+	if w.err != nil {
+		return w
+	}
+	switch len(data) {
+	case 1:
+		w.b.Byte(fmtFixext1)
+	case 2:
+		w.b.Byte(fmtFixext2)
+	case 4:
+		w.b.Byte(fmtFixext4)
+	case 8:
+		w.b.Byte(fmtFixext8)
+	case 16:
+		w.b.Byte(fmtFixext16)
+	default:
+		if !w.length(len(data), 0, 0, fmtExt8, fmtExt16, fmtExt32) {
+			return w
+		}
+	}
+	w.b.Byte(byte(typ)).CopyBytes(data)
+	return w
+}
+
+// Time writes a timestamp extension, in the smallest of the three timestamp formats that
+// holds it.
+func (w *Writer) Time(t time.Time) *Writer {
+	if w.err != nil {
+		return w
+	}
+	sec, nsec := t.Unix(), uint32(t.Nanosecond())
+	switch {
+	case sec >= 0 && sec <= math.MaxUint32 && nsec == 0:
+		w.b.Byte(fmtFixext4).Byte(timestampExtByte).Uint32(uint32(sec), false)
+	case sec >= 0 && sec < 1<<34:
+		w.b.Byte(fmtFixext8).Byte(timestampExtByte).Uint64(uint64(nsec)<<34|uint64(sec), false)
+	default:
+		w.b.Byte(fmtExt8).Byte(12).Byte(timestampExtByte).Uint32(nsec, false).Int64(sec, false)
+	}
+	return w
+}
@@ -0,0 +1,197 @@
+package safebuffer
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Placeholder is a region of a ResizableBuffer that was reserved so it can be filled in once
+// the value is known, such as a length prefix or checksum. Placeholders keep track of data
+// prepended, inserted or deleted before them after they were reserved. Using one after the
+// buffer is reset, drained, rolled back past it or has data inserted into or deleted from it
+// panics, since it no longer knows where its data is.
+type Placeholder struct {
+	b         *ResizableBuffer
+	offset    int
+	prepended int
+	edits     uint64
+	n         int
+}
+
+// Reserve reserves n zeroed bytes at the end of the consumed buffer and returns a placeholder
+// that can be used to fill them in later. If the buffer has hit its maximum size, the
+// placeholder returned is empty and filling it does nothing.
+func (b *ResizableBuffer) Reserve(n int) Placeholder {
+	if !b.ensureCapacity(n) {
+		return Placeholder{}
+	}
+	end := b.end()
+	clear(b.buffer[end : end+n])
+	edits := b.editsFrom + uint64(len(b.edits))
+	p := Placeholder{b: b, offset: b.offset, prepended: b.prepended, edits: edits, n: n}
+	b.offset += n
+	return p
+}
+
+// Offset returns the offset of the placeholder within the consumed buffer.
+func (p Placeholder) Offset() int {
+	if p.b == nil {
+		return 0
+	}
+	b := p.b
+	if p.edits < b.editsFrom {
+		panic("safebuffer: placeholder used after its buffer was reset or drained")
+	}
+
+	// Follow the inserts and deletes made since the placeholder was reserved.
+	pos := p.offset - p.prepended
+	for _, e := range b.edits[p.edits-b.editsFrom:] {
+		switch {
+		case e.n > 0 && e.pos <= pos:
+			pos += e.n
+		case e.n > 0 && e.pos >= pos+p.n:
+		case e.n < 0 && e.pos-e.n <= pos:
+			pos += e.n
+		case e.n < 0 && e.pos >= pos+p.n:
+		default:
+			panic("safebuffer: placeholder used after data was inserted into or deleted from it")
+		}
+	}
+	off := pos + b.prepended
+	if off+p.n > b.offset {
+		panic("safebuffer: placeholder used after its buffer was rolled back past it")
+	}
+	return off
+}
+
+// Len returns the number of bytes reserved.
+func (p Placeholder) Len() int {
+	return p.n
+}
+
+// Bytes returns the reserved bytes so they can be written to directly.
+func (p Placeholder) Bytes() []byte {
+	if p.b == nil {
+		return nil
+	}
+	start := p.b.start + p.Offset()
+	return p.b.buffer[start : start+p.n]
+}
+
+// Fill copies the bytes specified into the placeholder. Any bytes past the length of the
+// placeholder are ignored.
+func (p Placeholder) Fill(v []byte) {
+	copy(p.Bytes(), v)
+}
+
+// BytesSince returns the number of bytes that have been written after the end of the placeholder.
+func (p Placeholder) BytesSince() int {
+	if p.b == nil {
+		return 0
+	}
+	return p.b.offset - p.Offset() - p.n
+}
+
+// lengthSince returns the number of bytes written since the placeholder, or false if it is
+// more than max. The buffer's error is set to ErrTooLarge in that case, since writing the
+// length truncated would corrupt the data.
+func (p Placeholder) lengthSince(max uint64) (uint64, bool) {
+	n := uint64(p.BytesSince())
+	if n > max {
+		if p.b.err == nil {
+			p.b.err = ErrTooLarge
+		}
+		return 0, false
+	}
+	return n, true
+}
+
+// Uint16Placeholder is a placeholder for a uint16.
+type Uint16Placeholder struct {
+	Placeholder
+	littleEndian bool
+}
+
+// ReserveUint16 reserves space for a uint16 that can be set later.
+func (b *ResizableBuffer) ReserveUint16(littleEndian bool) Uint16Placeholder {
+	return Uint16Placeholder{Placeholder: b.Reserve(2), littleEndian: littleEndian}
+}
+
+// Set writes the value into the placeholder.
+func (p Uint16Placeholder) Set(v uint16) {
+	if p.b == nil {
+		return
+	}
+	if p.littleEndian {
+		binary.LittleEndian.PutUint16(p.Bytes(), v)
+	} else {
+		binary.BigEndian.PutUint16(p.Bytes(), v)
+	}
+}
+
+// SetLength writes the number of bytes written since the placeholder into it. If the length
+// does not fit in a uint16, the placeholder is left alone and Err returns ErrTooLarge.
+func (p Uint16Placeholder) SetLength() {
+	if n, ok := p.lengthSince(math.MaxUint16); ok {
+		p.Set(uint16(n))
+	}
+}
+
+// Uint32Placeholder is a placeholder for a uint32.
+type Uint32Placeholder struct {
+	Placeholder
+	littleEndian bool
+}
+
+// ReserveUint32 reserves space for a uint32 that can be set later.
+func (b *ResizableBuffer) ReserveUint32(littleEndian bool) Uint32Placeholder {
+	return Uint32Placeholder{Placeholder: b.Reserve(4), littleEndian: littleEndian}
+}
+
+// Set writes the value into the placeholder.
+func (p Uint32Placeholder) Set(v uint32) {
+	if p.b == nil {
+		return
+	}
+	if p.littleEndian {
+		binary.LittleEndian.PutUint32(p.Bytes(), v)
+	} else {
+		binary.BigEndian.PutUint32(p.Bytes(), v)
+	}
+}
+
+// SetLength writes the number of bytes written since the placeholder into it. If the length
+// does not fit in a uint32, the placeholder is left alone and Err returns ErrTooLarge.
+func (p Uint32Placeholder) SetLength() {
+	if n, ok := p.lengthSince(math.MaxUint32); ok {
+		p.Set(uint32(n))
+	}
+}
+
+// Uint64Placeholder is a placeholder for a uint64.
+type Uint64Placeholder struct {
+	Placeholder
+	littleEndian bool
+}
+
+// ReserveUint64 reserves space for a uint64 that can be set later.
+func (b *ResizableBuffer) ReserveUint64(littleEndian bool) Uint64Placeholder {
+	return Uint64Placeholder{Placeholder: b.Reserve(8), littleEndian: littleEndian}
+}
+
+// Set writes the value into the placeholder.
+func (p Uint64Placeholder) Set(v uint64) {
+	if p.b == nil {
+		return
+	}
+	if p.littleEndian {
+		binary.LittleEndian.PutUint64(p.Bytes(), v)
+	} else {
+		binary.BigEndian.PutUint64(p.Bytes(), v)
+	}
+}
+
+// SetLength writes the number of bytes written since the placeholder into it.
+func (p Uint64Placeholder) SetLength() {
+	p.Set(uint64(p.BytesSince()))
+}
@@ -0,0 +1,184 @@
+package safebuffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReserve(t *testing.T) {
+	t.Run("zeroes reserved bytes", func(t *testing.T) {
+		buffer := bytes.Repeat([]byte{0xff}, 100)
+		rb := NewResizableBuffer(buffer)
+		rb.Byte(1)
+		p := rb.Reserve(3)
+		if !bytes.Equal(rb.Bytes(), []byte{1, 0, 0, 0}) {
+			t.Fatalf("expected [1 0 0 0], got %v", rb.Bytes())
+		}
+		if p.Offset() != 1 || p.Len() != 3 {
+			t.Fatalf("expected offset 1 and length 3, got %d and %d", p.Offset(), p.Len())
+		}
+	})
+
+	t.Run("fill after growth", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		p := rb.Reserve(2)
+		rb.CopyString("some data that makes the buffer grow")
+		p.Fill([]byte{7, 8, 9})
+		if !bytes.Equal(rb.Bytes()[:3], []byte{7, 8, 's'}) {
+			t.Fatalf("expected placeholder to be filled, got %v", rb.Bytes()[:3])
+		}
+		if p.BytesSince() != 36 {
+			t.Fatalf("expected 36 bytes since, got %d", p.BytesSince())
+		}
+	})
+
+	t.Run("survives prepend", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("ab")
+		p := rb.Reserve(1)
+		rb.CopyString("cd")
+		rb.PrependString("xyz")
+		p.Fill([]byte{'!'})
+		if string(rb.Bytes()) != "xyzab!cd" {
+			t.Fatalf("expected xyzab!cd, got %q", rb.Bytes())
+		}
+		if p.BytesSince() != 2 {
+			t.Fatalf("expected 2 bytes since, got %d", p.BytesSince())
+		}
+	})
+}
+
+func TestReserveTyped(t *testing.T) {
+	t.Run("uint16 length prefix", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		p := rb.ReserveUint16(false)
+		rb.CopyString("hello")
+		p.SetLength()
+		expected := append([]byte{0, 5}, "hello"...)
+		if !bytes.Equal(rb.Bytes(), expected) {
+			t.Fatalf("expected %v, got %v", expected, rb.Bytes())
+		}
+	})
+
+	t.Run("uint32 length prefix", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		p := rb.ReserveUint32(true)
+		rb.CopyString("hello")
+		p.SetLength()
+		expected := NewResizableBuffer(nil).Uint32(5, true).CopyString("hello").Bytes()
+		if !bytes.Equal(rb.Bytes(), expected) {
+			t.Fatalf("expected %v, got %v", expected, rb.Bytes())
+		}
+	})
+
+	t.Run("uint16 length too large", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		p := rb.ReserveUint16(false)
+		rb.CopyBytes(make([]byte, 70000))
+		p.SetLength()
+		if rb.Err() != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", rb.Err())
+		}
+		if !bytes.Equal(rb.Bytes()[:2], []byte{0, 0}) {
+			t.Fatalf("expected placeholder to be left alone, got %v", rb.Bytes()[:2])
+		}
+	})
+
+	t.Run("uint64 set", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		p := rb.ReserveUint64(false)
+		rb.Byte(1)
+		p.Set(0x0102030405060708)
+		expected := []byte{1, 2, 3, 4, 5, 6, 7, 8, 1}
+		if !bytes.Equal(rb.Bytes(), expected) {
+			t.Fatalf("expected %v, got %v", expected, rb.Bytes())
+		}
+	})
+
+	t.Run("nested tlv", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		rb.Byte(1)
+		outer := rb.ReserveUint16(false)
+		rb.Byte(2)
+		inner := rb.ReserveUint16(false)
+		rb.CopyString("abc")
+		inner.SetLength()
+		outer.SetLength()
+		expected := []byte{1, 0, 6, 2, 0, 3, 'a', 'b', 'c'}
+		if !bytes.Equal(rb.Bytes(), expected) {
+			t.Fatalf("expected %v, got %v", expected, rb.Bytes())
+		}
+	})
+}
+
+func TestPlaceholderEdits(t *testing.T) {
+	expectPanic := func(t *testing.T, fn func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic")
+			}
+		}()
+		fn()
+	}
+
+	t.Run("follows inserts and deletes before it", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("abcdef")
+		p := rb.ReserveUint16(false)
+		rb.CopyString("xy")
+		rb.InsertString(2, "123").DeleteRange(1, 2).InsertString(12, "z")
+		p.SetLength()
+		expected := append([]byte("a123cdef"), 0, 3, 'x', 'y', 'z')
+		if !bytes.Equal(rb.Bytes(), expected) {
+			t.Fatalf("expected %v, got %v", expected, rb.Bytes())
+		}
+	})
+
+	t.Run("follows nested inserts", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		outer := rb.Reserve(0)
+		rb.CopyString("ab")
+		inner := rb.Reserve(0)
+		rb.CopyString("cd")
+		rb.InsertByte(inner.Offset(), byte(inner.BytesSince()))
+		rb.InsertByte(outer.Offset(), byte(outer.BytesSince()))
+		expected := []byte{5, 'a', 'b', 2, 'c', 'd'}
+		if !bytes.Equal(rb.Bytes(), expected) {
+			t.Fatalf("expected %v, got %v", expected, rb.Bytes())
+		}
+	})
+
+	t.Run("empty inserts and deletes", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		p := rb.ReserveUint32(false)
+		rb.CopyString("abcdef")
+		rb.DeleteRange(6, 6).DeleteRange(0, 0).InsertBytes(2, nil).InsertString(0, "")
+		p.SetLength()
+		expected := append([]byte{0, 0, 0, 6}, "abcdef"...)
+		if !bytes.Equal(rb.Bytes(), expected) {
+			t.Fatalf("expected %v, got %v", expected, rb.Bytes())
+		}
+	})
+
+	t.Run("front delete", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("abc")
+		p := rb.ReserveUint16(false)
+		rb.CopyString("xy")
+		rb.DeleteRange(0, 3)
+		expectPanic(t, p.SetLength)
+	})
+
+	t.Run("edited inside", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("abc")
+		p := rb.Reserve(4)
+		rb.CopyString("xy")
+		rb.DeleteRange(4, 6)
+		expectPanic(t, func() { p.Fill([]byte("1234")) })
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		p := rb.Reserve(2)
+		rb.Reset(false).CopyString("abcd")
+		expectPanic(t, func() { p.Fill([]byte("12")) })
+	})
+}
@@ -0,0 +1,95 @@
+package safebuffer
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultPoolClasses are the capacity classes used by NewBufferPool when none are given.
+var DefaultPoolClasses = []int{256, 1024, 4096, 16384, 65536}
+
+// PoolStats holds counters for a BufferPool.
+type PoolStats struct {
+	// Hits is the number of calls to Get that were given a pooled buffer.
+	Hits uint64
+
+	// Misses is the number of calls to Get that had to allocate a new buffer.
+	Misses uint64
+
+	// DroppedOversized is the number of buffers given to Put that were bigger than the
+	// largest class and so were not kept.
+	DroppedOversized uint64
+}
+
+// BufferPool is a pool of ResizableBuffers bucketed by capacity class. This is safe to use
+// from multiple goroutines, but each buffer it hands out is still single threaded.
+type BufferPool struct {
+	classes []int
+	pools   []sync.Pool
+	zeroOut bool
+
+	hits             atomic.Uint64
+	misses           atomic.Uint64
+	droppedOversized atomic.Uint64
+}
+
+// NewBufferPool creates a new BufferPool. zeroOut is passed to Reset when a buffer is returned
+// to the pool. classes are the capacities buffers are bucketed by, and DefaultPoolClasses is
+// used if none are given. Buffers bigger than the largest class are not kept.
+func NewBufferPool(zeroOut bool, classes ...int) *BufferPool {
+	if len(classes) == 0 {
+		classes = DefaultPoolClasses
+	}
+	classes = append([]int(nil), classes...)
+	sort.Ints(classes)
+	return &BufferPool{
+		classes: classes,
+		pools:   make([]sync.Pool, len(classes)),
+		zeroOut: zeroOut,
+	}
+}
+
+// Get returns an empty buffer with a capacity of at least size. If size is bigger than the
+// largest class, a buffer of exactly that size is allocated.
+func (p *BufferPool) Get(size int) *ResizableBuffer {
+	i := sort.SearchInts(p.classes, size)
+	if i == len(p.classes) {
+		p.misses.Add(1)
+		return NewResizableBuffer(make([]byte, size))
+	}
+	if b, _ := p.pools[i].Get().(*ResizableBuffer); b != nil {
+		p.hits.Add(1)
+		return b
+	}
+	p.misses.Add(1)
+	return NewResizableBuffer(make([]byte, p.classes[i]))
+}
+
+// Put resets the buffer and returns it to the pool. Any options set on the buffer are cleared.
+// The buffer must not be used after this is called.
+func (p *BufferPool) Put(b *ResizableBuffer) {
+	size := len(b.buffer)
+	if size > p.classes[len(p.classes)-1] {
+		p.droppedOversized.Add(1)
+		return
+	}
+
+	// Find the largest class the buffer can serve.
+	i := sort.SearchInts(p.classes, size+1) - 1
+	if i < 0 {
+		return
+	}
+	b.Reset(p.zeroOut)
+	*b = ResizableBuffer{buffer: b.buffer, gen: b.gen, epoch: b.epoch, editsFrom: b.editsFrom}
+	p.pools[i].Put(b)
+}
+
+// Stats returns the counters for the pool.
+func (p *BufferPool) Stats() PoolStats {
+	return PoolStats{
+		Hits:             p.hits.Load(),
+		Misses:           p.misses.Load(),
+		DroppedOversized: p.droppedOversized.Load(),
+	}
+}
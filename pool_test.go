@@ -0,0 +1,106 @@
+package safebuffer
+
+import (
+	"bytes"
+	"testing"
+)
+
+// getPooled puts the buffer into the pool and gets one back until it is a hit. sync.Pool is
+// allowed to drop items, so a single round trip is not guaranteed to hit.
+func getPooled(t *testing.T, p *BufferPool, b *ResizableBuffer, size int) *ResizableBuffer {
+	t.Helper()
+	for i := 0; i < 100; i++ {
+		hits := p.Stats().Hits
+		p.Put(b)
+		got := p.Get(size)
+		if p.Stats().Hits != hits {
+			return got
+		}
+		b = got
+	}
+	t.Fatal("expected a pool hit")
+	return nil
+}
+
+func TestBufferPool(t *testing.T) {
+	t.Run("default classes", func(t *testing.T) {
+		p := NewBufferPool(false)
+		b := p.Get(100)
+		if len(b.buffer) != 256 {
+			t.Fatalf("expected a 256 byte buffer, got %d", len(b.buffer))
+		}
+		if p.Stats().Misses != 1 {
+			t.Fatalf("expected 1 miss, got %d", p.Stats().Misses)
+		}
+	})
+
+	t.Run("classes are sorted", func(t *testing.T) {
+		p := NewBufferPool(false, 4096, 64, 512)
+		if len(p.Get(65).buffer) != 512 {
+			t.Fatal("expected the 512 byte class")
+		}
+		if len(p.Get(64).buffer) != 64 {
+			t.Fatal("expected the 64 byte class")
+		}
+	})
+
+	t.Run("reuses and resets buffers", func(t *testing.T) {
+		p := NewBufferPool(false, 64, 512)
+		b := p.Get(10).WithMaxSize(20).WithHeadroom(4)
+		b.CopyString("hello")
+		b = getPooled(t, p, b, 64)
+		if b.Len() != 0 || b.start != 0 || b.maxSize != 0 || b.headroom != 0 {
+			t.Fatal("expected buffer to be reset")
+		}
+		if len(b.buffer) != 64 {
+			t.Fatalf("expected a 64 byte buffer, got %d", len(b.buffer))
+		}
+	})
+
+	t.Run("linked sub-buffers go stale", func(t *testing.T) {
+		p := NewBufferPool(false, 64)
+		b := p.Get(64).CopyString("content")
+		sub := b.LinkedSubBuffer(4)
+		b = getPooled(t, p, b, 64).CopyString("recycled data")
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected a panic")
+			}
+			if string(b.Bytes()) != "recycled data" {
+				t.Fatalf("expected the recycled buffer to be untouched, got %q", b.Bytes())
+			}
+		}()
+		sub.CopyString("XXXX")
+	})
+
+	t.Run("zero out", func(t *testing.T) {
+		p := NewBufferPool(true, 64)
+		b := p.Get(64).CopyString("secret")
+		b = getPooled(t, p, b, 64)
+		if bytes.Contains(b.buffer, []byte("secret")) {
+			t.Fatal("expected buffer to be zeroed")
+		}
+	})
+
+	t.Run("grown buffers move class", func(t *testing.T) {
+		p := NewBufferPool(false, 64, 512)
+		b := p.Get(64).CopyBytes(make([]byte, 300))
+		b = getPooled(t, p, b, 512)
+		if len(b.buffer) < 512 {
+			t.Fatalf("expected a buffer of at least 512 bytes, got %d", len(b.buffer))
+		}
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		p := NewBufferPool(false, 64)
+		b := p.Get(1000)
+		if len(b.buffer) != 1000 {
+			t.Fatalf("expected a 1000 byte buffer, got %d", len(b.buffer))
+		}
+		p.Put(b)
+		p.Put(NewResizableBuffer(make([]byte, 65)))
+		if p.Stats().DroppedOversized != 2 {
+			t.Fatalf("expected 2 dropped buffers, got %d", p.Stats().DroppedOversized)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+// Package protowire writes the Protocol Buffers wire format straight into a
+// safebuffer.ResizableBuffer and reads it back field by field, without generated code. The
+// bytes written match those produced by google.golang.org/protobuf/encoding/protowire for the
+// same fields.
+package protowire
+
+import "errors"
+
+// ErrInvalid is returned when the data is not a valid encoding, such as a reserved wire type,
+// a field number out of range or an end group tag that does not match its start.
+var ErrInvalid = errors.New("protowire: invalid data")
+
+// Number is a field number.
+type Number int32
+
+// The range of valid field numbers.
+const (
+	MinValidNumber Number = 1
+	MaxValidNumber Number = 1<<29 - 1
+)
+
+// Type is a wire type.
+type Type int8
+
+// The wire types.
+const (
+	VarintType     Type = 0
+	Fixed64Type    Type = 1
+	BytesType      Type = 2
+	StartGroupType Type = 3
+	EndGroupType   Type = 4
+	Fixed32Type    Type = 5
+)
+
+// maxSkipDepth is how deeply groups can be nested before Reader.Next gives up.
+const maxSkipDepth = 512
+
+// tag packs a field number and wire type into the value of a tag.
+func tag(num Number, typ Type) uint64 {
+	return uint64(num)<<3 | uint64(typ&7)
+}
+
+// zigzag maps signed integers to unsigned ones so that small magnitudes stay small.
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+func unzigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
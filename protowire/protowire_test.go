@@ -0,0 +1,257 @@
+package protowire
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+func fixture(s string) []byte {
+	p, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// The fixtures below are the bytes google.golang.org/protobuf/encoding/protowire appends for
+// the same calls.
+func TestWriter(t *testing.T) {
+	long := bytes.Repeat([]byte{'a'}, 200)
+	tests := []struct {
+		name string
+		fn   func(w *Writer)
+		eq   []byte
+	}{
+		{"varint", func(w *Writer) { w.Varint(1, 150) }, fixture("08 9601")},
+		{"int32 negative", func(w *Writer) { w.Int32(1, -1) }, fixture("08 ffffffffffffffffff01")},
+		{"int64 min", func(w *Writer) { w.Int64(2, math.MinInt64) }, fixture("10 80808080808080808001")},
+		{"uint32 max", func(w *Writer) { w.Uint32(3, math.MaxUint32) }, fixture("18 ffffffff0f")},
+		{"uint64 max", func(w *Writer) { w.Uint64(1, math.MaxUint64) }, fixture("08 ffffffffffffffffff01")},
+		{"sint32 negative", func(w *Writer) { w.Sint32(1, -1) }, fixture("08 01")},
+		{"sint32 min", func(w *Writer) { w.Sint32(1, math.MinInt32) }, fixture("08 ffffffff0f")},
+		{"sint64 positive", func(w *Writer) { w.Sint64(1, 1) }, fixture("08 02")},
+		{"sint64 min", func(w *Writer) { w.Sint64(1, math.MinInt64) }, fixture("08 ffffffffffffffffff01")},
+		{"bool true", func(w *Writer) { w.Bool(1, true) }, fixture("08 01")},
+		{"bool false", func(w *Writer) { w.Bool(1, false) }, fixture("08 00")},
+		{"fixed32", func(w *Writer) { w.Fixed32(1, 0x01020304) }, fixture("0d 04030201")},
+		{"fixed64", func(w *Writer) { w.Fixed64(1, 0x0102030405060708) }, fixture("09 0807060504030201")},
+		{"sfixed32", func(w *Writer) { w.Sfixed32(1, -2) }, fixture("0d feffffff")},
+		{"sfixed64", func(w *Writer) { w.Sfixed64(1, -2) }, fixture("09 feffffffffffffff")},
+		{"float", func(w *Writer) { w.Float(1, 1.5) }, fixture("0d 0000c03f")},
+		{"double", func(w *Writer) { w.Double(1, 1.5) }, fixture("09 000000000000f83f")},
+		{"string", func(w *Writer) { w.String(2, "testing") }, fixture("12 07 74657374696e67")},
+		{"empty bytes", func(w *Writer) { w.Bytes(1, nil) }, fixture("0a 00")},
+		{"two byte tag", func(w *Writer) { w.Varint(16, 1) }, fixture("8001 01")},
+		{"max field number", func(w *Writer) { w.Fixed32(MaxValidNumber, 0) }, fixture("fdffffff0f 00000000")},
+		{"raw tag", func(w *Writer) { w.Tag(1, StartGroupType) }, fixture("0b")},
+		{"message", func(w *Writer) { w.BeginMessage(3).Varint(1, 150).End() }, fixture("1a 03 089601")},
+		{"empty message", func(w *Writer) { w.BeginMessage(1).End() }, fixture("0a 00")},
+		{
+			"nested messages",
+			func(w *Writer) { w.BeginMessage(1).BeginMessage(2).Varint(1, 1).End().String(3, "a").End() },
+			fixture("0a 07 12 02 0801 1a 01 61"),
+		},
+		{
+			"message with a two byte length",
+			func(w *Writer) { w.BeginMessage(1).Bytes(1, long).End() },
+			append(fixture("0a cb01 0a c801"), long...),
+		},
+		{
+			"packed",
+			func(w *Writer) { w.BeginMessage(4).RawVarint(3).RawVarint(270).RawVarint(86942).End() },
+			fixture("22 06 03 8e02 9ea705"),
+		},
+		{
+			"packed fixed",
+			func(w *Writer) { w.BeginMessage(5).RawFixed32(1).RawFixed64(2).End() },
+			fixture("2a 0c 01000000 0200000000000000"),
+		},
+		{"group", func(w *Writer) { w.BeginGroup(2).Varint(1, 1).End() }, fixture("13 0801 14")},
+		{
+			"group in a message",
+			func(w *Writer) { w.BeginMessage(1).BeginGroup(2).End().End() },
+			fixture("0a 02 13 14"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := safebuffer.NewResizableBuffer(nil)
+			w := NewWriter(b)
+			test.fn(w)
+			if w.Err() != nil {
+				t.Fatalf("expected nil error, got %v", w.Err())
+			}
+			if w.Depth() != 0 {
+				t.Fatalf("expected every message to be ended, %d still open", w.Depth())
+			}
+			if !bytes.Equal(b.Bytes(), test.eq) {
+				t.Fatalf("expected %x, got %x", test.eq, b.Bytes())
+			}
+		})
+	}
+}
+
+func TestWriterAfterPrepend(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	w := NewWriter(b).BeginMessage(1).Varint(1, 1)
+	b.PrependBytes([]byte("header"))
+	w.End()
+	if expected := append([]byte("header"), fixture("0a 02 0801")...); !bytes.Equal(b.Bytes(), expected) {
+		t.Fatalf("expected %x, got %x", expected, b.Bytes())
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	t.Run("buffer error", func(t *testing.T) {
+		b := safebuffer.NewResizableBuffer(nil).WithMaxSize(4)
+		w := NewWriter(b).BeginMessage(1).String(1, "too long").End()
+		if w.Err() != safebuffer.ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", w.Err())
+		}
+		if w.Depth() != 0 {
+			t.Fatalf("expected End to still close the message, %d open", w.Depth())
+		}
+	})
+
+	panics := []struct {
+		name string
+		fn   func(w *Writer)
+	}{
+		{"field number 0", func(w *Writer) { w.Varint(0, 1) }},
+		{"field number too large", func(w *Writer) { w.Varint(MaxValidNumber+1, 1) }},
+		{"end without begin", func(w *Writer) { w.End() }},
+	}
+	for _, test := range panics {
+		t.Run(test.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+			test.fn(NewWriter(safebuffer.NewResizableBuffer(nil)))
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	b := safebuffer.NewResizableBuffer(nil)
+	NewWriter(b).
+		Int32(1, -5).
+		Sint32(2, -5).
+		Sint64(3, math.MinInt64).
+		Bool(4, true).
+		Float(5, 1.5).
+		Double(6, -2.25).
+		Sfixed64(7, -3).
+		String(8, "hello").
+		BeginMessage(9).Uint64(1, 7).End().
+		BeginGroup(10).BeginGroup(10).End().Fixed32(1, 9).End().
+		BeginMessage(11).RawVarint(1).RawVarint(300).End().
+		Fixed64(MaxValidNumber, 1)
+
+	r := NewReader(b.Bytes())
+	next := func(num Number, typ Type) Field {
+		t.Helper()
+		f, err := r.Next()
+		if err != nil {
+			t.Fatalf("field %d: expected nil error, got %v", num, err)
+		}
+		if f.Number != num || f.Type != typ {
+			t.Fatalf("expected field %d of type %d, got field %d of type %d", num, typ, f.Number, f.Type)
+		}
+		return f
+	}
+
+	if v := next(1, VarintType).Int32(); v != -5 {
+		t.Fatalf("expected -5, got %d", v)
+	}
+	if v := next(2, VarintType).Sint32(); v != -5 {
+		t.Fatalf("expected -5, got %d", v)
+	}
+	if v := next(3, VarintType).Sint64(); v != math.MinInt64 {
+		t.Fatalf("expected min int64, got %d", v)
+	}
+	if !next(4, VarintType).Bool() {
+		t.Fatal("expected true")
+	}
+	if v := next(5, Fixed32Type).Float(); v != 1.5 {
+		t.Fatalf("expected 1.5, got %v", v)
+	}
+	if v := next(6, Fixed64Type).Double(); v != -2.25 {
+		t.Fatalf("expected -2.25, got %v", v)
+	}
+	if v := next(7, Fixed64Type).Int64(); v != -3 {
+		t.Fatalf("expected -3, got %d", v)
+	}
+	if v := next(8, BytesType).String(); v != "hello" {
+		t.Fatalf("expected hello, got %q", v)
+	}
+
+	m := next(9, BytesType).Message()
+	if f, err := m.Next(); err != nil || f.Number != 1 || f.Value != 7 || m.Len() != 0 {
+		t.Fatalf("expected the nested message to hold 1: 7, got %+v, %v", f, err)
+	}
+
+	g := next(10, StartGroupType)
+	if !bytes.Equal(g.Bytes, fixture("53 54 0d 09000000")) {
+		t.Fatalf("expected the group contents, got %x", g.Bytes)
+	}
+
+	packed := next(11, BytesType).Message()
+	for _, expected := range []uint64{1, 300} {
+		if v, err := packed.Varint(); err != nil || v != expected {
+			t.Fatalf("expected %d, got %d, %v", expected, v, err)
+		}
+	}
+
+	if v := next(MaxValidNumber, Fixed64Type).Value; v != 1 {
+		t.Fatalf("expected 1, got %d", v)
+	}
+	if r.Len() != 0 || r.Offset() != b.Len() {
+		t.Fatalf("expected everything to be read, %d bytes left", r.Len())
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, safebuffer.ErrShortRead},
+		{"short varint", fixture("08 96"), safebuffer.ErrShortRead},
+		{"varint overflow", fixture("08 ffffffffffffffffff02"), safebuffer.ErrVarintOverflow},
+		{"short fixed32", fixture("0d 010203"), safebuffer.ErrShortRead},
+		{"short fixed64", fixture("09 01020304050607"), safebuffer.ErrShortRead},
+		{"short bytes", fixture("0a 05 0102"), safebuffer.ErrShortRead},
+		{"huge length", fixture("0a ffffffffffffffffff01"), safebuffer.ErrShortRead},
+		{"field number 0", fixture("00 01"), ErrInvalid},
+		{"field number too large", fixture("8080808010 00"), ErrInvalid},
+		{"reserved wire type", fixture("0e"), ErrInvalid},
+		{"end group without start", fixture("0c"), ErrInvalid},
+		{"mismatched end group", fixture("0b 14"), ErrInvalid},
+		{"unterminated group", fixture("0b 0801"), safebuffer.ErrShortRead},
+		{"deep groups", bytes.Repeat([]byte{0x0b}, maxSkipDepth+2), ErrInvalid},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewReader(test.data)
+			if _, err := r.Next(); err != test.err {
+				t.Fatalf("expected %v, got %v", test.err, err)
+			}
+			if r.Offset() != 0 {
+				t.Fatalf("expected the read position not to move, got %d", r.Offset())
+			}
+		})
+	}
+
+	r := NewReader(fixture("010203"))
+	if _, err := r.Fixed32(); err != safebuffer.ErrShortRead || r.Offset() != 0 {
+		t.Fatalf("expected ErrShortRead without moving, got %v at %d", err, r.Offset())
+	}
+}
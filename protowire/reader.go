@@ -0,0 +1,250 @@
+package protowire
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// Field is a single field read by Reader.Next. Which of Value and Bytes is set depends on the
+// wire type.
+type Field struct {
+	Number Number
+	Type   Type
+
+	// Value holds the value of varint, fixed32 and fixed64 fields.
+	Value uint64
+
+	// Bytes holds the contents of length-delimited fields and groups. It is a view into the
+	// data being read, not a copy. For groups, it does not include the end group tag.
+	Bytes []byte
+}
+
+// Int32 returns the value of an int32 field.
+func (f Field) Int32() int32 {
+	return int32(f.Value)
+}
+
+// Int64 returns the value of an int64 field.
+func (f Field) Int64() int64 {
+	return int64(f.Value)
+}
+
+// Uint32 returns the value of a uint32 or fixed32 field.
+func (f Field) Uint32() uint32 {
+	return uint32(f.Value)
+}
+
+// Sint32 returns the value of a zigzag encoded sint32 field.
+func (f Field) Sint32() int32 {
+	return int32(unzigzag(uint64(uint32(f.Value))))
+}
+
+// Sint64 returns the value of a zigzag encoded sint64 field.
+func (f Field) Sint64() int64 {
+	return unzigzag(f.Value)
+}
+
+// Bool returns the value of a bool field.
+func (f Field) Bool() bool {
+	return f.Value != 0
+}
+
+// Float returns the value of a float field.
+func (f Field) Float() float32 {
+	return math.Float32frombits(uint32(f.Value))
+}
+
+// Double returns the value of a double field.
+func (f Field) Double() float64 {
+	return math.Float64frombits(f.Value)
+}
+
+// String returns a copy of the contents of a string field.
+func (f Field) String() string {
+	return string(f.Bytes)
+}
+
+// Message returns a Reader over the contents of a nested message, group or packed field.
+func (f Field) Message() *Reader {
+	return NewReader(f.Bytes)
+}
+
+// Reader reads Protocol Buffers fields from a byte slice, one at a time. The contents of
+// length-delimited fields are views into the slice, so nothing is copied. A read that fails
+// does not move the read position. This is single threaded.
+type Reader struct {
+	p   []byte
+	off int
+}
+
+// NewReader creates a new Reader over the slice given. The slice is not copied, so if it came
+// from ResizableBuffer.Bytes, it is only valid until the next call to Reset.
+func NewReader(p []byte) *Reader {
+	return &Reader{p: p}
+}
+
+// Offset returns the number of bytes that have been read.
+func (r *Reader) Offset() int {
+	return r.off
+}
+
+// Len returns the number of bytes left to read. A message has been fully read once this is 0.
+func (r *Reader) Len() int {
+	return len(r.p) - r.off
+}
+
+// cursor reads from the data after the read position. Reads only move the reader once they
+// have fully succeeded, by calling done.
+type cursor struct {
+	p   []byte
+	off int
+}
+
+func (r *Reader) cursor() cursor {
+	return cursor{p: r.p[r.off:]}
+}
+
+func (r *Reader) done(c cursor) {
+	r.off += c.off
+}
+
+func (c *cursor) next(n uint64) ([]byte, error) {
+	if uint64(len(c.p)-c.off) < n {
+		return nil, safebuffer.ErrShortRead
+	}
+	s := c.p[c.off : c.off+int(n)]
+	c.off += int(n)
+	return s, nil
+}
+
+func (c *cursor) uvarint() (uint64, error) {
+	v, n := binary.Uvarint(c.p[c.off:])
+	if n == 0 {
+		return 0, safebuffer.ErrShortRead
+	}
+	if n < 0 {
+		return 0, safebuffer.ErrVarintOverflow
+	}
+	c.off += n
+	return v, nil
+}
+
+func (c *cursor) tag() (Number, Type, error) {
+	v, err := c.uvarint()
+	if err != nil {
+		return 0, 0, err
+	}
+	num := v >> 3
+	if num < uint64(MinValidNumber) || num > uint64(MaxValidNumber) {
+		return 0, 0, ErrInvalid
+	}
+	return Number(num), Type(v & 7), nil
+}
+
+// field reads the rest of a field after its tag. depth is how many groups it is nested in.
+func (c *cursor) field(f *Field, depth int) error {
+	switch f.Type {
+	case VarintType:
+		v, err := c.uvarint()
+		f.Value = v
+		return err
+	case Fixed32Type:
+		s, err := c.next(4)
+		if err != nil {
+			return err
+		}
+		f.Value = uint64(binary.LittleEndian.Uint32(s))
+	case Fixed64Type:
+		s, err := c.next(8)
+		if err != nil {
+			return err
+		}
+		f.Value = binary.LittleEndian.Uint64(s)
+	case BytesType:
+		n, err := c.uvarint()
+		if err != nil {
+			return err
+		}
+		f.Bytes, err = c.next(n)
+		return err
+	case StartGroupType:
+		if depth >= maxSkipDepth {
+			return ErrInvalid
+		}
+		start := c.off
+		for {
+			end := c.off
+			var inner Field
+			var err error
+			inner.Number, inner.Type, err = c.tag()
+			if err != nil {
+				return err
+			}
+			if inner.Type == EndGroupType {
+				if inner.Number != f.Number {
+					return ErrInvalid
+				}
+				f.Bytes = c.p[start:end]
+				return nil
+			}
+			if err := c.field(&inner, depth+1); err != nil {
+				return err
+			}
+		}
+	default:
+		// An end group tag with no start, or one of the reserved wire types.
+		return ErrInvalid
+	}
+	return nil
+}
+
+// Next reads the next field. Groups are read up to and including their end group tag.
+func (r *Reader) Next() (Field, error) {
+	c := r.cursor()
+	var f Field
+	var err error
+	f.Number, f.Type, err = c.tag()
+	if err != nil {
+		return Field{}, err
+	}
+	if err := c.field(&f, 0); err != nil {
+		return Field{}, err
+	}
+	r.done(c)
+	return f, nil
+}
+
+// Varint reads a varint with no tag, as used inside packed repeated fields.
+func (r *Reader) Varint() (uint64, error) {
+	c := r.cursor()
+	v, err := c.uvarint()
+	if err != nil {
+		return 0, err
+	}
+	r.done(c)
+	return v, nil
+}
+
+// Fixed32 reads a fixed32 value with no tag, as used inside packed repeated fields.
+func (r *Reader) Fixed32() (uint32, error) {
+	c := r.cursor()
+	s, err := c.next(4)
+	if err != nil {
+		return 0, err
+	}
+	r.done(c)
+	return binary.LittleEndian.Uint32(s), nil
+}
+
+// Fixed64 reads a fixed64 value with no tag, as used inside packed repeated fields.
+func (r *Reader) Fixed64() (uint64, error) {
+	c := r.cursor()
+	s, err := c.next(8)
+	if err != nil {
+		return 0, err
+	}
+	r.done(c)
+	return binary.LittleEndian.Uint64(s), nil
+}
@@ -0,0 +1,190 @@
+package protowire
+
+import (
+	"math"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// frame is a message, packed field or group that is still being written.
+type frame struct {
+	num   Number
+	group bool
+
+	// body marks where the contents start, so the length can be inserted in front of them.
+	body safebuffer.Placeholder
+}
+
+// Writer writes Protocol Buffers fields into a ResizableBuffer. Nested messages are written
+// between BeginMessage and End, and their length is inserted in front of them once they are
+// complete, so nothing is encoded twice. Writing a field number outside of the valid range
+// panics. Errors come from the buffer and are sticky, so a chain of writes can be checked once
+// at the end with Err. This is single threaded.
+type Writer struct {
+	b     *safebuffer.ResizableBuffer
+	stack []frame
+}
+
+// NewWriter creates a new Writer that appends to the buffer given.
+func NewWriter(b *safebuffer.ResizableBuffer) *Writer {
+	return &Writer{b: b}
+}
+
+// Err returns the error held by the buffer.
+func (w *Writer) Err() error {
+	return w.b.Err()
+}
+
+// Depth returns the number of messages, packed fields and groups that are still open.
+func (w *Writer) Depth() int {
+	return len(w.stack)
+}
+
+// Tag writes the tag for a field. Most of the time the methods that write a whole field
+// should be used instead.
+func (w *Writer) Tag(num Number, typ Type) *Writer {
+	if num < MinValidNumber || num > MaxValidNumber {
+		panic("protowire: field number out of range")
+	}
+	w.b.Uvarint(tag(num, typ))
+	return w
+}
+
+// Varint writes a varint field.
+func (w *Writer) Varint(num Number, v uint64) *Writer {
+	w.Tag(num, VarintType).b.Uvarint(v)
+	return w
+}
+
+// Int32 writes an int32 field. Negative values are sign extended, so they take 10 bytes.
+func (w *Writer) Int32(num Number, v int32) *Writer {
+	return w.Varint(num, uint64(int64(v)))
+}
+
+// Int64 writes an int64 field.
+func (w *Writer) Int64(num Number, v int64) *Writer {
+	return w.Varint(num, uint64(v))
+}
+
+// Uint32 writes a uint32 field.
+func (w *Writer) Uint32(num Number, v uint32) *Writer {
+	return w.Varint(num, uint64(v))
+}
+
+// Uint64 writes a uint64 field.
+func (w *Writer) Uint64(num Number, v uint64) *Writer {
+	return w.Varint(num, v)
+}
+
+// Sint32 writes a zigzag encoded sint32 field.
+func (w *Writer) Sint32(num Number, v int32) *Writer {
+	return w.Varint(num, zigzag(int64(v)))
+}
+
+// Sint64 writes a zigzag encoded sint64 field.
+func (w *Writer) Sint64(num Number, v int64) *Writer {
+	return w.Varint(num, zigzag(v))
+}
+
+// Bool writes a bool field.
+func (w *Writer) Bool(num Number, v bool) *Writer {
+	if v {
+		return w.Varint(num, 1)
+	}
+	return w.Varint(num, 0)
+}
+
+// Fixed32 writes a fixed32 field.
+func (w *Writer) Fixed32(num Number, v uint32) *Writer {
+	w.Tag(num, Fixed32Type).b.Uint32(v, true)
+	return w
+}
+
+// Fixed64 writes a fixed64 field.
+func (w *Writer) Fixed64(num Number, v uint64) *Writer {
+	w.Tag(num, Fixed64Type).b.Uint64(v, true)
+	return w
+}
+
+// Sfixed32 writes a sfixed32 field.
+func (w *Writer) Sfixed32(num Number, v int32) *Writer {
+	return w.Fixed32(num, uint32(v))
+}
+
+// Sfixed64 writes a sfixed64 field.
+func (w *Writer) Sfixed64(num Number, v int64) *Writer {
+	return w.Fixed64(num, uint64(v))
+}
+
+// Float writes a float field.
+func (w *Writer) Float(num Number, v float32) *Writer {
+	return w.Fixed32(num, math.Float32bits(v))
+}
+
+// Double writes a double field.
+func (w *Writer) Double(num Number, v float64) *Writer {
+	return w.Fixed64(num, math.Float64bits(v))
+}
+
+// Bytes writes a bytes field.
+func (w *Writer) Bytes(num Number, v []byte) *Writer {
+	w.Tag(num, BytesType).b.Uvarint(uint64(len(v))).CopyBytes(v)
+	return w
+}
+
+// String writes a string field.
+func (w *Writer) String(num Number, v string) *Writer {
+	w.Tag(num, BytesType).b.Uvarint(uint64(len(v))).CopyString(v)
+	return w
+}
+
+// BeginMessage starts a nested message field. Write its fields and then call End. This also
+// starts packed repeated fields, whose values are written with the Raw methods.
+func (w *Writer) BeginMessage(num Number) *Writer {
+	w.Tag(num, BytesType)
+	w.stack = append(w.stack, frame{num: num, body: w.b.Reserve(0)})
+	return w
+}
+
+// BeginGroup starts a group field. Write its fields and then call End.
+func (w *Writer) BeginGroup(num Number) *Writer {
+	w.Tag(num, StartGroupType)
+	w.stack = append(w.stack, frame{num: num, group: true})
+	return w
+}
+
+// End ends the innermost message, packed field or group. Nothing else may be written to the
+// buffer while a message is open, other than through the writer.
+func (w *Writer) End() *Writer {
+	n := len(w.stack)
+	if n == 0 {
+		panic("protowire: End called without a message or group to end")
+	}
+	f := w.stack[n-1]
+	w.stack = w.stack[:n-1]
+	if f.group {
+		return w.Tag(f.num, EndGroupType)
+	}
+	if w.b.Err() == nil {
+		w.b.InsertUvarint(f.body.Offset(), uint64(f.body.BytesSince()))
+	}
+	return w
+}
+
+// RawVarint writes a varint with no tag, as used inside packed repeated fields.
+func (w *Writer) RawVarint(v uint64) *Writer {
+	w.b.Uvarint(v)
+	return w
+}
+
+// RawFixed32 writes a fixed32 value with no tag, as used inside packed repeated fields.
+func (w *Writer) RawFixed32(v uint32) *Writer {
+	w.b.Uint32(v, true)
+	return w
+}
+
+// RawFixed64 writes a fixed64 value with no tag, as used inside packed repeated fields.
+func (w *Writer) RawFixed64(v uint64) *Writer {
+	w.b.Uint64(v, true)
+	return w
+}
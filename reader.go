@@ -0,0 +1,197 @@
+package safebuffer
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var (
+	// ErrShortRead is returned when there is not enough data left in a ReadableBuffer to
+	// complete a read. The read position is not moved when this is returned.
+	ErrShortRead = errors.New("safebuffer: not enough data to read")
+
+	// ErrInvalidCRLF is returned by ReadableBuffer.CRLF when the next two bytes are not a CRLF.
+	ErrInvalidCRLF = errors.New("safebuffer: expected CRLF")
+
+	// ErrVarintOverflow is returned when a variable length integer does not fit in 64 bits.
+	ErrVarintOverflow = errors.New("safebuffer: varint overflows a 64-bit integer")
+)
+
+// ReadableBuffer is a bounds checked cursor over a byte slice. It mirrors the write methods
+// of ResizableBuffer so data written with one can be read back with the other. This is
+// single threaded.
+type ReadableBuffer struct {
+	buffer []byte
+	offset int
+}
+
+// NewReadableBuffer creates a new ReadableBuffer over the slice given. The slice is not copied,
+// so if it came from ResizableBuffer.Bytes, it is only valid until the next call to Reset.
+func NewReadableBuffer(b []byte) *ReadableBuffer {
+	return &ReadableBuffer{buffer: b}
+}
+
+func (r *ReadableBuffer) next(n int) ([]byte, error) {
+	if n < 0 || len(r.buffer)-r.offset < n {
+		return nil, ErrShortRead
+	}
+	s := r.buffer[r.offset : r.offset+n]
+	r.offset += n
+	return s, nil
+}
+
+// Next returns the next n bytes and moves past them. The returned slice is a view into the
+// underlying slice, not a copy.
+func (r *ReadableBuffer) Next(n int) ([]byte, error) {
+	return r.next(n)
+}
+
+// CopyBytes fills the slice given with the next len(p) bytes.
+func (r *ReadableBuffer) CopyBytes(p []byte) error {
+	s, err := r.next(len(p))
+	if err != nil {
+		return err
+	}
+	copy(p, s)
+	return nil
+}
+
+// CopyString reads the next n bytes as a string.
+func (r *ReadableBuffer) CopyString(n int) (string, error) {
+	s, err := r.next(n)
+	if err != nil {
+		return "", err
+	}
+	return string(s), nil
+}
+
+// Byte reads a single byte.
+func (r *ReadableBuffer) Byte() (byte, error) {
+	if r.offset >= len(r.buffer) {
+		return 0, ErrShortRead
+	}
+	bt := r.buffer[r.offset]
+	r.offset++
+	return bt, nil
+}
+
+// CRLF reads a CRLF. If the next two bytes are not a CRLF, ErrInvalidCRLF is returned and
+// the read position is not moved.
+func (r *ReadableBuffer) CRLF() error {
+	if len(r.buffer)-r.offset < 2 {
+		return ErrShortRead
+	}
+	if r.buffer[r.offset] != '\r' || r.buffer[r.offset+1] != '\n' {
+		return ErrInvalidCRLF
+	}
+	r.offset += 2
+	return nil
+}
+
+// Uint16 reads a uint16.
+func (r *ReadableBuffer) Uint16(littleEndian bool) (uint16, error) {
+	s, err := r.next(2)
+	if err != nil {
+		return 0, err
+	}
+	if littleEndian {
+		return binary.LittleEndian.Uint16(s), nil
+	}
+	return binary.BigEndian.Uint16(s), nil
+}
+
+// Uint32 reads a uint32.
+func (r *ReadableBuffer) Uint32(littleEndian bool) (uint32, error) {
+	s, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	if littleEndian {
+		return binary.LittleEndian.Uint32(s), nil
+	}
+	return binary.BigEndian.Uint32(s), nil
+}
+
+// Uint64 reads a uint64.
+func (r *ReadableBuffer) Uint64(littleEndian bool) (uint64, error) {
+	s, err := r.next(8)
+	if err != nil {
+		return 0, err
+	}
+	if littleEndian {
+		return binary.LittleEndian.Uint64(s), nil
+	}
+	return binary.BigEndian.Uint64(s), nil
+}
+
+// Int16 reads a int16.
+func (r *ReadableBuffer) Int16(littleEndian bool) (int16, error) {
+	v, err := r.Uint16(littleEndian)
+	return int16(v), err
+}
+
+// Int32 reads a int32.
+func (r *ReadableBuffer) Int32(littleEndian bool) (int32, error) {
+	v, err := r.Uint32(littleEndian)
+	return int32(v), err
+}
+
+// Int64 reads a int64.
+func (r *ReadableBuffer) Int64(littleEndian bool) (int64, error) {
+	v, err := r.Uint64(littleEndian)
+	return int64(v), err
+}
+
+// Float32 reads a float32.
+func (r *ReadableBuffer) Float32(littleEndian bool) (float32, error) {
+	v, err := r.Uint32(littleEndian)
+	return math.Float32frombits(v), err
+}
+
+// Float64 reads a float64.
+func (r *ReadableBuffer) Float64(littleEndian bool) (float64, error) {
+	v, err := r.Uint64(littleEndian)
+	return math.Float64frombits(v), err
+}
+
+// Uvarint reads a variable length integer written by ResizableBuffer.Uvarint or binary.PutUvarint.
+func (r *ReadableBuffer) Uvarint() (uint64, error) {
+	v, n := binary.Uvarint(r.buffer[r.offset:])
+	if n == 0 {
+		return 0, ErrShortRead
+	}
+	if n < 0 {
+		return 0, ErrVarintOverflow
+	}
+	r.offset += n
+	return v, nil
+}
+
+// Varint reads a zigzag encoded variable length integer written by ResizableBuffer.Varint or
+// binary.PutVarint.
+func (r *ReadableBuffer) Varint() (int64, error) {
+	v, err := r.Uvarint()
+	return int64(v>>1) ^ -int64(v&1), err
+}
+
+// Skip moves the read position forward by n bytes.
+func (r *ReadableBuffer) Skip(n int) error {
+	_, err := r.next(n)
+	return err
+}
+
+// Offset returns the number of bytes that have been read.
+func (r *ReadableBuffer) Offset() int {
+	return r.offset
+}
+
+// Len returns the number of bytes left to read.
+func (r *ReadableBuffer) Len() int {
+	return len(r.buffer) - r.offset
+}
+
+// Remaining returns the bytes left to read without moving the read position.
+func (r *ReadableBuffer) Remaining() []byte {
+	return r.buffer[r.offset:]
+}
@@ -0,0 +1,264 @@
+package safebuffer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func TestNewReadableBuffer(t *testing.T) {
+	s := []byte{1, 2, 3}
+	r := NewReadableBuffer(s)
+	if r == nil {
+		t.Fatal("NewReadableBuffer(s) should return a non-nil ReadableBuffer")
+	}
+	if &r.buffer[0] != &s[0] {
+		t.Fatal("NewReadableBuffer(s) should return a ReadableBuffer with the same buffer as s")
+	}
+	if r.Len() != 3 {
+		t.Fatalf("expected 3 bytes left, got %d", r.Len())
+	}
+}
+
+type readCase struct {
+	name  string
+	write func(b *ResizableBuffer)
+	read  func(r *ReadableBuffer) (any, error)
+	eq    any
+}
+
+func testReadCases(t *testing.T, tests []readCase) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rb := NewResizableBuffer(nil)
+			test.write(rb)
+			data := rb.Bytes()
+
+			t.Run("round trip", func(t *testing.T) {
+				r := NewReadableBuffer(data)
+				v, err := test.read(r)
+				if err != nil {
+					t.Fatalf("expected nil error, got %v", err)
+				}
+				if x, ok := v.([]byte); ok {
+					if !bytes.Equal(x, test.eq.([]byte)) {
+						t.Fatalf("expected %v, got %v", test.eq, x)
+					}
+				} else if v != test.eq {
+					t.Fatalf("expected %v, got %v", test.eq, v)
+				}
+				if r.Len() != 0 {
+					t.Fatalf("expected all bytes to be read, %d left", r.Len())
+				}
+			})
+
+			if len(data) == 0 {
+				return
+			}
+			t.Run("short data", func(t *testing.T) {
+				r := NewReadableBuffer(data[:len(data)-1])
+				if _, err := test.read(r); err != ErrShortRead {
+					t.Fatalf("expected ErrShortRead, got %v", err)
+				}
+				if r.Offset() != 0 {
+					t.Fatalf("expected offset to be 0, got %d", r.Offset())
+				}
+			})
+		})
+	}
+}
+
+func TestReadableBufferRoundTrip(t *testing.T) {
+	testReadCases(t, []readCase{
+		{
+			name:  "bytes",
+			write: func(b *ResizableBuffer) { b.CopyBytes([]byte{1, 2, 3}) },
+			read: func(r *ReadableBuffer) (any, error) {
+				p := make([]byte, 3)
+				return p, r.CopyBytes(p)
+			},
+			eq: []byte{1, 2, 3},
+		},
+		{
+			name:  "next",
+			write: func(b *ResizableBuffer) { b.CopyBytes([]byte{1, 2, 3}) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Next(3) },
+			eq:    []byte{1, 2, 3},
+		},
+		{
+			name:  "string",
+			write: func(b *ResizableBuffer) { b.CopyString("hello") },
+			read:  func(r *ReadableBuffer) (any, error) { return r.CopyString(5) },
+			eq:    "hello",
+		},
+		{
+			name:  "byte",
+			write: func(b *ResizableBuffer) { b.Byte(7) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Byte() },
+			eq:    byte(7),
+		},
+		{
+			name:  "crlf",
+			write: func(b *ResizableBuffer) { b.CRLF() },
+			read:  func(r *ReadableBuffer) (any, error) { return nil, r.CRLF() },
+			eq:    nil,
+		},
+		{
+			name:  "uint16 little endian",
+			write: func(b *ResizableBuffer) { b.Uint16(0x0102, true) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Uint16(true) },
+			eq:    uint16(0x0102),
+		},
+		{
+			name:  "uint16 big endian",
+			write: func(b *ResizableBuffer) { b.Uint16(0x0102, false) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Uint16(false) },
+			eq:    uint16(0x0102),
+		},
+		{
+			name:  "uint32 little endian",
+			write: func(b *ResizableBuffer) { b.Uint32(0x01020304, true) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Uint32(true) },
+			eq:    uint32(0x01020304),
+		},
+		{
+			name:  "uint32 big endian",
+			write: func(b *ResizableBuffer) { b.Uint32(0x01020304, false) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Uint32(false) },
+			eq:    uint32(0x01020304),
+		},
+		{
+			name:  "uint64 little endian",
+			write: func(b *ResizableBuffer) { b.Uint64(0x0102030405060708, true) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Uint64(true) },
+			eq:    uint64(0x0102030405060708),
+		},
+		{
+			name:  "uint64 big endian",
+			write: func(b *ResizableBuffer) { b.Uint64(0x0102030405060708, false) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Uint64(false) },
+			eq:    uint64(0x0102030405060708),
+		},
+		{
+			name:  "int16",
+			write: func(b *ResizableBuffer) { b.Int16(-2, true) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Int16(true) },
+			eq:    int16(-2),
+		},
+		{
+			name:  "int32",
+			write: func(b *ResizableBuffer) { b.Int32(-2, false) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Int32(false) },
+			eq:    int32(-2),
+		},
+		{
+			name:  "int64",
+			write: func(b *ResizableBuffer) { b.Int64(-2, true) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Int64(true) },
+			eq:    int64(-2),
+		},
+		{
+			name:  "float32",
+			write: func(b *ResizableBuffer) { b.Float32(1.2, false) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Float32(false) },
+			eq:    float32(1.2),
+		},
+		{
+			name:  "float64",
+			write: func(b *ResizableBuffer) { b.Float64(1.2, true) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Float64(true) },
+			eq:    float64(1.2),
+		},
+		{
+			name:  "uvarint",
+			write: func(b *ResizableBuffer) { b.Uvarint(1 << 40) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Uvarint() },
+			eq:    uint64(1 << 40),
+		},
+		{
+			name:  "varint",
+			write: func(b *ResizableBuffer) { b.Varint(-12345) },
+			read:  func(r *ReadableBuffer) (any, error) { return r.Varint() },
+			eq:    int64(-12345),
+		},
+	})
+}
+
+func TestReadableBufferVarint(t *testing.T) {
+	t.Run("binary compatible", func(t *testing.T) {
+		data := binary.AppendVarint(binary.AppendUvarint(nil, 300), -2)
+		r := NewReadableBuffer(data)
+		u, err := r.Uvarint()
+		if err != nil || u != 300 {
+			t.Fatalf("expected 300, got %d (%v)", u, err)
+		}
+		v, err := r.Varint()
+		if err != nil || v != -2 {
+			t.Fatalf("expected -2, got %d (%v)", v, err)
+		}
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		data := bytes.Repeat([]byte{0xff}, 11)
+		r := NewReadableBuffer(data)
+		if _, err := r.Uvarint(); err != ErrVarintOverflow {
+			t.Fatalf("expected ErrVarintOverflow, got %v", err)
+		}
+		if r.Offset() != 0 {
+			t.Fatalf("expected offset to be 0, got %d", r.Offset())
+		}
+	})
+}
+
+func TestReadableBufferCRLF(t *testing.T) {
+	r := NewReadableBuffer([]byte("\n\r"))
+	if err := r.CRLF(); err != ErrInvalidCRLF {
+		t.Fatalf("expected ErrInvalidCRLF, got %v", err)
+	}
+	if r.Offset() != 0 {
+		t.Fatalf("expected offset to be 0, got %d", r.Offset())
+	}
+}
+
+func TestReadableBufferSkip(t *testing.T) {
+	r := NewReadableBuffer([]byte{1, 2, 3})
+	if err := r.Skip(2); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if !bytes.Equal(r.Remaining(), []byte{3}) {
+		t.Fatalf("expected [3], got %v", r.Remaining())
+	}
+	if err := r.Skip(2); err != ErrShortRead {
+		t.Fatalf("expected ErrShortRead, got %v", err)
+	}
+	if err := r.Skip(-1); err != ErrShortRead {
+		t.Fatalf("expected ErrShortRead, got %v", err)
+	}
+}
+
+func TestReadableBufferSequence(t *testing.T) {
+	rb := NewResizableBuffer(nil).
+		CopyString("Data: ").
+		Uint32(42, true).
+		Float64(3.5, false).
+		CRLF()
+	r := NewReadableBuffer(rb.Bytes())
+	s, err := r.CopyString(6)
+	if err != nil || s != "Data: " {
+		t.Fatalf("expected \"Data: \", got %q (%v)", s, err)
+	}
+	u, err := r.Uint32(true)
+	if err != nil || u != 42 {
+		t.Fatalf("expected 42, got %d (%v)", u, err)
+	}
+	f, err := r.Float64(false)
+	if err != nil || f != 3.5 {
+		t.Fatalf("expected 3.5, got %v (%v)", f, err)
+	}
+	if err := r.CRLF(); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if _, err := r.Byte(); err != ErrShortRead {
+		t.Fatalf("expected ErrShortRead, got %v", err)
+	}
+}
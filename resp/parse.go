@@ -0,0 +1,272 @@
+package resp
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+)
+
+const (
+	// MaxBulkLength is the longest bulk string Parse accepts, which matches the default limit
+	// in Redis.
+	MaxBulkLength = 512 << 20
+
+	// MaxDepth is how deeply Parse lets aggregates nest.
+	MaxDepth = 512
+)
+
+// Parse parses the first value in p and returns it along with the number of bytes it took up.
+// If p ends before the value does, ErrIncomplete is returned, and Parse should be called again
+// with more data. The value does not point into p, so p can be reused once this returns.
+func Parse(p []byte) (Value, int, error) {
+	ps := parser{p: p}
+	v, err := ps.value(0)
+	if err != nil {
+		return Value{}, 0, err
+	}
+	return v, ps.off, nil
+}
+
+type parser struct {
+	p   []byte
+	off int
+}
+
+// line returns the rest of the current line and moves past its CRLF.
+func (ps *parser) line() ([]byte, error) {
+	i := bytes.IndexByte(ps.p[ps.off:], '\n')
+	if i < 0 {
+		return nil, ErrIncomplete
+	}
+	if i == 0 || ps.p[ps.off+i-1] != '\r' {
+		return nil, ErrProtocol
+	}
+	s := ps.p[ps.off : ps.off+i-1]
+	ps.off += i + 1
+	return s, nil
+}
+
+// integer parses the rest of the current line as a decimal integer.
+func (ps *parser) integer() (int64, error) {
+	s, err := ps.line()
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseInt(string(s), 10, 64)
+	if err != nil {
+		return 0, ErrProtocol
+	}
+	return v, nil
+}
+
+// bulk parses a length and then that many bytes followed by a CRLF. A length of -1 is the
+// RESP2 null, which is reported with ok set to false.
+func (ps *parser) bulk() (s []byte, ok bool, err error) {
+	n, err := ps.integer()
+	if err != nil {
+		return nil, false, err
+	}
+	if n == -1 {
+		return nil, false, nil
+	}
+	if n < 0 || n > MaxBulkLength {
+		return nil, false, ErrProtocol
+	}
+	if int64(len(ps.p)-ps.off) < n+2 {
+		return nil, false, ErrIncomplete
+	}
+	end := ps.off + int(n)
+	if ps.p[end] != '\r' || ps.p[end+1] != '\n' {
+		return nil, false, ErrProtocol
+	}
+	s = ps.p[ps.off:end]
+	ps.off = end + 2
+	return s, true, nil
+}
+
+// count parses the number of values in an aggregate of the kind given, with each pair in a
+// map or attribute counting as two values. A null array gives -1.
+func (ps *parser) count(k Kind) (int64, error) {
+	n, err := ps.integer()
+	if err != nil {
+		return 0, err
+	}
+	if n == -1 && k == Array {
+		return -1, nil
+	}
+	if n < 0 {
+		return 0, ErrProtocol
+	}
+	if k == Map || k == Attribute {
+		// A count this large cannot be real, and would overflow once doubled.
+		if n > math.MaxInt64/2 {
+			return 0, ErrProtocol
+		}
+		n *= 2
+	}
+	return n, nil
+}
+
+// aggregate parses a count and then that many values.
+func (ps *parser) aggregate(v *Value, depth int) error {
+	n, err := ps.count(v.Kind)
+	if err != nil {
+		return err
+	}
+	if n == -1 {
+		v.IsNull = true
+		return nil
+	}
+	// Each value takes at least 3 bytes, so a count that could not fit in what is left is
+	// not allocated for up front.
+	v.Elems = make([]Value, 0, min(n, int64(len(ps.p)-ps.off)/3))
+	for i := int64(0); i < n; i++ {
+		e, err := ps.value(depth + 1)
+		if err != nil {
+			return err
+		}
+		v.Elems = append(v.Elems, e)
+	}
+	return nil
+}
+
+// skip moves past the next value without building it, or only past the header if it is an
+// aggregate, in which case the number of values in it is returned. This only checks enough to
+// find where the value ends, so it should be parsed with value once it is all there.
+func (ps *parser) skip(depth int) (int64, error) {
+	if depth > MaxDepth {
+		return 0, ErrProtocol
+	}
+	if ps.off >= len(ps.p) {
+		return 0, ErrIncomplete
+	}
+	k := Kind(ps.p[ps.off])
+	ps.off++
+
+	var err error
+	switch k {
+	case SimpleString, Error, BigNumber, Null, Boolean, Double:
+		_, err = ps.line()
+	case Integer:
+		_, err = ps.integer()
+	case BulkString, BulkError, VerbatimString:
+		_, _, err = ps.bulk()
+	case Array, Set, Push, Map, Attribute:
+		n, err := ps.count(k)
+		return max(n, 0), err
+	default:
+		err = ErrProtocol
+	}
+	return 0, err
+}
+
+func (ps *parser) value(depth int) (Value, error) {
+	if depth > MaxDepth {
+		return Value{}, ErrProtocol
+	}
+	if ps.off >= len(ps.p) {
+		return Value{}, ErrIncomplete
+	}
+	v := Value{Kind: Kind(ps.p[ps.off])}
+	ps.off++
+
+	switch v.Kind {
+	case SimpleString, Error, BigNumber:
+		s, err := ps.line()
+		if err != nil {
+			return Value{}, err
+		}
+		if v.Kind == BigNumber && !validBigNumber(s) {
+			return Value{}, ErrProtocol
+		}
+		v.Str = string(s)
+	case Integer:
+		n, err := ps.integer()
+		if err != nil {
+			return Value{}, err
+		}
+		v.Int = n
+	case BulkString, BulkError, VerbatimString:
+		s, ok, err := ps.bulk()
+		if err != nil {
+			return Value{}, err
+		}
+		if !ok {
+			if v.Kind != BulkString {
+				return Value{}, ErrProtocol
+			}
+			v.IsNull = true
+			break
+		}
+		if v.Kind == VerbatimString {
+			if len(s) < 4 || s[3] != ':' {
+				return Value{}, ErrProtocol
+			}
+			v.Format = string(s[:3])
+			s = s[4:]
+		}
+		v.Str = string(s)
+	case Null:
+		s, err := ps.line()
+		if err != nil {
+			return Value{}, err
+		}
+		if len(s) != 0 {
+			return Value{}, ErrProtocol
+		}
+	case Boolean:
+		s, err := ps.line()
+		if err != nil {
+			return Value{}, err
+		}
+		switch string(s) {
+		case "t":
+			v.Bool = true
+		case "f":
+		default:
+			return Value{}, ErrProtocol
+		}
+	case Double:
+		s, err := ps.line()
+		if err != nil {
+			return Value{}, err
+		}
+		switch string(s) {
+		case "inf":
+			v.Float = math.Inf(1)
+		case "-inf":
+			v.Float = math.Inf(-1)
+		case "nan":
+			v.Float = math.NaN()
+		default:
+			f, err := strconv.ParseFloat(string(s), 64)
+			if err != nil {
+				return Value{}, ErrProtocol
+			}
+			v.Float = f
+		}
+	case Array, Set, Push, Map, Attribute:
+		if err := ps.aggregate(&v, depth); err != nil {
+			return Value{}, err
+		}
+	default:
+		return Value{}, ErrProtocol
+	}
+	return v, nil
+}
+
+// validBigNumber checks that s is an optionally signed run of decimal digits.
+func validBigNumber(s []byte) bool {
+	if len(s) > 0 && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	if len(s) == 0 {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package resp
+
+import (
+	"io"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// readSize is how much Reader asks for from the underlying reader at a time.
+const readSize = 4096
+
+// Reader reads RESP values from an io.Reader, buffering whatever arrives past the end of the
+// current value for the next call. This is single threaded.
+type Reader struct {
+	r   io.Reader
+	buf *safebuffer.ResizableBuffer
+	err error
+
+	// scanned is how far into the buffer the next value has been checked, and pending holds
+	// how many values are still to come in each aggregate open at that point. This lets a
+	// value that arrives over many reads be checked once, and only parsed when it is all there.
+	scanned int
+	pending []int64
+}
+
+// NewReader creates a new Reader that reads from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: r, buf: safebuffer.NewResizableBuffer(nil)}
+}
+
+// ReadValue reads the next value. io.EOF is returned if r ends between values, and
+// io.ErrUnexpectedEOF if it ends part way through one. ErrProtocol is returned if the data
+// is not valid RESP, after which the Reader cannot be used.
+func (r *Reader) ReadValue() (Value, error) {
+	for {
+		done, err := r.scan()
+		if err != nil {
+			return Value{}, err
+		}
+		if done {
+			r.scanned = 0
+			v, n, err := Parse(r.buf.Bytes())
+			if err != nil {
+				return Value{}, err
+			}
+			if n == r.buf.Len() {
+				r.buf.Reset(false)
+			} else {
+				r.buf.DeleteRange(0, n)
+			}
+			return v, nil
+		}
+
+		if r.err != nil {
+			err := r.err
+			if err != io.EOF {
+				// Anything other than the end of the stream might go away, so the next call
+				// tries again.
+				r.err = nil
+			} else if r.buf.Len() != 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return Value{}, err
+		}
+		_, r.err = r.buf.ReadInto(r.r, readSize)
+	}
+}
+
+// scan carries on checking the next value from where the last call stopped, and reports
+// whether it is all in the buffer.
+func (r *Reader) scan() (bool, error) {
+	ps := parser{p: r.buf.Bytes(), off: r.scanned}
+	for {
+		n, err := ps.skip(len(r.pending))
+		if err == ErrIncomplete {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		r.scanned = ps.off
+
+		// The value fills a slot in the aggregate it is in, and any values it holds come next.
+		if len(r.pending) != 0 {
+			r.pending[len(r.pending)-1]--
+		}
+		if n != 0 {
+			r.pending = append(r.pending, n)
+		}
+		for len(r.pending) != 0 && r.pending[len(r.pending)-1] == 0 {
+			r.pending = r.pending[:len(r.pending)-1]
+		}
+		if len(r.pending) == 0 {
+			return true, nil
+		}
+	}
+}
+
+// Buffered returns the number of bytes read from r that have not been parsed yet.
+func (r *Reader) Buffered() int {
+	return r.buf.Len()
+}
@@ -0,0 +1,111 @@
+// Package resp encodes and decodes the Redis serialization protocol, covering both RESP2 and
+// RESP3. Values are written straight into a safebuffer.ResizableBuffer, and the parser works on
+// partial data so that it can be fed bytes as they arrive.
+package resp
+
+import "errors"
+
+var (
+	// ErrIncomplete is returned by Parse when the data ends before the value does. More data
+	// should be read and Parse called again with all of it.
+	ErrIncomplete = errors.New("resp: need more data")
+
+	// ErrProtocol is returned when the data is not valid RESP.
+	ErrProtocol = errors.New("resp: protocol error")
+
+	// ErrInvalidSimpleString is held by a Writer after a simple string or error that contains a
+	// CR or LF, which cannot be escaped.
+	ErrInvalidSimpleString = errors.New("resp: simple string or error contains CR or LF")
+
+	// ErrInvalidValue is held by a Writer after a value that cannot be written, such as a
+	// verbatim string format that is not three bytes or a big number that is not all digits.
+	ErrInvalidValue = errors.New("resp: invalid value")
+)
+
+// Kind is the type of a RESP value. Each kind is the byte that starts it on the wire.
+type Kind byte
+
+// The kinds of value in RESP2 and RESP3.
+const (
+	SimpleString   Kind = '+'
+	Error          Kind = '-'
+	Integer        Kind = ':'
+	BulkString     Kind = '$'
+	Array          Kind = '*'
+	Null           Kind = '_'
+	Boolean        Kind = '#'
+	Double         Kind = ','
+	BigNumber      Kind = '('
+	BulkError      Kind = '!'
+	VerbatimString Kind = '='
+	Map            Kind = '%'
+	Set            Kind = '~'
+	Push           Kind = '>'
+	Attribute      Kind = '|'
+)
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	switch k {
+	case SimpleString:
+		return "simple string"
+	case Error:
+		return "error"
+	case Integer:
+		return "integer"
+	case BulkString:
+		return "bulk string"
+	case Array:
+		return "array"
+	case Null:
+		return "null"
+	case Boolean:
+		return "boolean"
+	case Double:
+		return "double"
+	case BigNumber:
+		return "big number"
+	case BulkError:
+		return "bulk error"
+	case VerbatimString:
+		return "verbatim string"
+	case Map:
+		return "map"
+	case Set:
+		return "set"
+	case Push:
+		return "push"
+	case Attribute:
+		return "attribute"
+	}
+	return "unknown"
+}
+
+// Value is a parsed RESP value. Which fields are set depends on the kind.
+type Value struct {
+	Kind Kind
+
+	// Str holds simple strings, errors, bulk strings, bulk errors, the text of verbatim
+	// strings and the digits of big numbers.
+	Str string
+
+	// Format is the three letter format of a verbatim string, such as "txt".
+	Format string
+
+	// Int holds integers.
+	Int int64
+
+	// Float holds doubles.
+	Float float64
+
+	// Bool holds booleans.
+	Bool bool
+
+	// Elems holds the items of arrays, sets and pushes. For maps and attributes, it holds
+	// each key followed by its value.
+	Elems []Value
+
+	// IsNull is set for the RESP2 null bulk string and null array. The RESP3 null has its own
+	// kind.
+	IsNull bool
+}
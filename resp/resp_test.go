@@ -0,0 +1,299 @@
+package resp
+
+import (
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+var fixtures = []struct {
+	name  string
+	wire  string
+	write func(w *Writer)
+	value Value
+}{
+	{"simple string", "+OK\r\n", func(w *Writer) { w.SimpleString("OK") }, Value{Kind: SimpleString, Str: "OK"}},
+	{"error", "-ERR unknown command 'foo'\r\n", func(w *Writer) { w.Error("ERR unknown command 'foo'") }, Value{Kind: Error, Str: "ERR unknown command 'foo'"}},
+	{"integer", ":1000\r\n", func(w *Writer) { w.Integer(1000) }, Value{Kind: Integer, Int: 1000}},
+	{"negative integer", ":-42\r\n", func(w *Writer) { w.Integer(-42) }, Value{Kind: Integer, Int: -42}},
+	{"bulk string", "$5\r\nhello\r\n", func(w *Writer) { w.BulkString("hello") }, Value{Kind: BulkString, Str: "hello"}},
+	{"binary bulk string", "$4\r\na\r\nb\r\n", func(w *Writer) { w.BulkBytes([]byte("a\r\nb")) }, Value{Kind: BulkString, Str: "a\r\nb"}},
+	{"empty bulk string", "$0\r\n\r\n", func(w *Writer) { w.BulkString("") }, Value{Kind: BulkString, Str: ""}},
+	{"null bulk string", "$-1\r\n", func(w *Writer) { w.NullBulkString() }, Value{Kind: BulkString, IsNull: true}},
+	{"null array", "*-1\r\n", func(w *Writer) { w.NullArray() }, Value{Kind: Array, IsNull: true}},
+	{"null", "_\r\n", func(w *Writer) { w.Null() }, Value{Kind: Null}},
+	{"true", "#t\r\n", func(w *Writer) { w.Boolean(true) }, Value{Kind: Boolean, Bool: true}},
+	{"false", "#f\r\n", func(w *Writer) { w.Boolean(false) }, Value{Kind: Boolean}},
+	{"double", ",1.23\r\n", func(w *Writer) { w.Double(1.23) }, Value{Kind: Double, Float: 1.23}},
+	{"double exponent", ",1e+300\r\n", func(w *Writer) { w.Double(1e300) }, Value{Kind: Double, Float: 1e300}},
+	{"inf", ",inf\r\n", func(w *Writer) { w.Double(math.Inf(1)) }, Value{Kind: Double, Float: math.Inf(1)}},
+	{"negative inf", ",-inf\r\n", func(w *Writer) { w.Double(math.Inf(-1)) }, Value{Kind: Double, Float: math.Inf(-1)}},
+	{
+		"big number", "(3492890328409238509324850943850943825024385\r\n",
+		func(w *Writer) {
+			v, _ := new(big.Int).SetString("3492890328409238509324850943850943825024385", 10)
+			w.BigNumber(v)
+		},
+		Value{Kind: BigNumber, Str: "3492890328409238509324850943850943825024385"},
+	},
+	{"bulk error", "!21\r\nSYNTAX invalid syntax\r\n", func(w *Writer) { w.BulkError("SYNTAX invalid syntax") }, Value{Kind: BulkError, Str: "SYNTAX invalid syntax"}},
+	{"verbatim string", "=15\r\ntxt:Some string\r\n", func(w *Writer) { w.VerbatimString("txt", "Some string") }, Value{Kind: VerbatimString, Format: "txt", Str: "Some string"}},
+	{"empty array", "*0\r\n", func(w *Writer) { w.ArrayHeader(0) }, Value{Kind: Array, Elems: []Value{}}},
+	{
+		"command", "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n",
+		func(w *Writer) { w.Command("SET", "key", "value") },
+		Value{Kind: Array, Elems: []Value{{Kind: BulkString, Str: "SET"}, {Kind: BulkString, Str: "key"}, {Kind: BulkString, Str: "value"}}},
+	},
+	{
+		"nested array", "*2\r\n*2\r\n:1\r\n:2\r\n*1\r\n+Hello\r\n",
+		func(w *Writer) {
+			w.ArrayHeader(2).ArrayHeader(2).Integer(1).Integer(2).ArrayHeader(1).SimpleString("Hello")
+		},
+		Value{Kind: Array, Elems: []Value{
+			{Kind: Array, Elems: []Value{{Kind: Integer, Int: 1}, {Kind: Integer, Int: 2}}},
+			{Kind: Array, Elems: []Value{{Kind: SimpleString, Str: "Hello"}}},
+		}},
+	},
+	{
+		"map", "%2\r\n+first\r\n:1\r\n+second\r\n:2\r\n",
+		func(w *Writer) { w.MapHeader(2).SimpleString("first").Integer(1).SimpleString("second").Integer(2) },
+		Value{Kind: Map, Elems: []Value{{Kind: SimpleString, Str: "first"}, {Kind: Integer, Int: 1}, {Kind: SimpleString, Str: "second"}, {Kind: Integer, Int: 2}}},
+	},
+	{
+		"set", "~2\r\n+orange\r\n+apple\r\n",
+		func(w *Writer) { w.SetHeader(2).SimpleString("orange").SimpleString("apple") },
+		Value{Kind: Set, Elems: []Value{{Kind: SimpleString, Str: "orange"}, {Kind: SimpleString, Str: "apple"}}},
+	},
+	{
+		"push", ">3\r\n$7\r\nmessage\r\n$7\r\nchannel\r\n$5\r\nhello\r\n",
+		func(w *Writer) { w.PushHeader(3).BulkString("message").BulkString("channel").BulkString("hello") },
+		Value{Kind: Push, Elems: []Value{{Kind: BulkString, Str: "message"}, {Kind: BulkString, Str: "channel"}, {Kind: BulkString, Str: "hello"}}},
+	},
+	{
+		"attribute", "|1\r\n+ttl\r\n:3600\r\n",
+		func(w *Writer) { w.AttributeHeader(1).SimpleString("ttl").Integer(3600) },
+		Value{Kind: Attribute, Elems: []Value{{Kind: SimpleString, Str: "ttl"}, {Kind: Integer, Int: 3600}}},
+	},
+}
+
+func TestWriter(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			b := safebuffer.NewResizableBuffer(nil)
+			f.write(NewWriter(b))
+			if string(b.Bytes()) != f.wire {
+				t.Fatalf("expected %q, got %q", f.wire, b.Bytes())
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			// Trailing data after the value is left alone.
+			v, n, err := Parse([]byte(f.wire + "+next\r\n"))
+			if err != nil || n != len(f.wire) {
+				t.Fatalf("expected %d, nil, got %d, %v", len(f.wire), n, err)
+			}
+			if !reflect.DeepEqual(v, f.value) {
+				t.Fatalf("expected %+v, got %+v", f.value, v)
+			}
+
+			for i := 0; i < len(f.wire); i++ {
+				if _, _, err := Parse([]byte(f.wire[:i])); err != ErrIncomplete {
+					t.Fatalf("prefix of %d bytes: expected ErrIncomplete, got %v", i, err)
+				}
+			}
+		})
+	}
+
+	t.Run("nan", func(t *testing.T) {
+		v, _, err := Parse([]byte(",nan\r\n"))
+		if err != nil || v.Kind != Double || !math.IsNaN(v.Float) {
+			t.Fatalf("expected nan, got %+v, %v", v, err)
+		}
+		b := safebuffer.NewResizableBuffer(nil)
+		NewWriter(b).Double(math.NaN())
+		if string(b.Bytes()) != ",nan\r\n" {
+			t.Fatalf("expected ,nan, got %q", b.Bytes())
+		}
+	})
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"?\r\n",
+		"+OK\n",
+		":12a\r\n",
+		"$-2\r\n",
+		"$3\r\nabcd\r\n",
+		"!-1\r\n",
+		"=3\r\ntxt\r\n",
+		"_x\r\n",
+		"#x\r\n",
+		",1.2.3\r\n",
+		"(12a\r\n",
+		"(\r\n",
+		"*-2\r\n",
+		"%-1\r\n",
+		"%4611686018427387904\r\n",
+		"|9223372036854775807\r\n",
+		"*1\r\n?\r\n",
+		"$99999999999\r\n",
+		strings.Repeat("*1\r\n", MaxDepth+2) + ":1\r\n",
+	}
+	for _, wire := range tests {
+		if _, _, err := Parse([]byte(wire)); err != ErrProtocol {
+			t.Fatalf("%q: expected ErrProtocol, got %v", wire, err)
+		}
+	}
+}
+
+func TestWriterValue(t *testing.T) {
+	for _, f := range fixtures {
+		t.Run(f.name, func(t *testing.T) {
+			b := safebuffer.NewResizableBuffer(nil)
+			NewWriter(b).Value(f.value)
+			if string(b.Bytes()) != f.wire {
+				t.Fatalf("expected %q, got %q", f.wire, b.Bytes())
+			}
+		})
+	}
+}
+
+func TestWriterInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(w *Writer)
+		err  error
+	}{
+		{"simple string with newline", func(w *Writer) { w.SimpleString("a\nb") }, ErrInvalidSimpleString},
+		{"error with carriage return", func(w *Writer) { w.Error("a\rb") }, ErrInvalidSimpleString},
+		{"verbatim format", func(w *Writer) { w.VerbatimString("text", "hello") }, ErrInvalidValue},
+		{"big number", func(w *Writer) { w.Value(Value{Kind: BigNumber, Str: "12\r\n:1"}) }, ErrInvalidValue},
+		{"odd map", func(w *Writer) { w.Value(Value{Kind: Map, Elems: []Value{{Kind: Null}}}) }, ErrInvalidValue},
+		{"unknown kind", func(w *Writer) { w.Value(Value{Kind: 'x'}) }, ErrInvalidValue},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := safebuffer.NewResizableBuffer(nil)
+			w := NewWriter(b)
+			test.fn(w)
+			w.SimpleString("ignored")
+			if w.Err() != test.err {
+				t.Fatalf("expected %v, got %v", test.err, w.Err())
+			}
+			if b.Len() != 0 {
+				t.Fatalf("expected nothing to be written, got %q", b.Bytes())
+			}
+		})
+	}
+}
+
+func TestWriterErr(t *testing.T) {
+	w := NewWriter(safebuffer.NewResizableBuffer(nil).WithMaxSize(8))
+	w.Command("GET", "key")
+	if w.Err() != safebuffer.ErrTooLarge {
+		t.Fatalf("expected ErrTooLarge, got %v", w.Err())
+	}
+}
+
+func TestReader(t *testing.T) {
+	var wire strings.Builder
+	for _, f := range fixtures {
+		wire.WriteString(f.wire)
+	}
+	// Big enough to need several reads.
+	big := strings.Repeat("x", readSize*3)
+	wire.WriteString("$12288\r\n" + big + "\r\n")
+
+	for _, name := range []string{"whole", "one byte"} {
+		t.Run(name, func(t *testing.T) {
+			var src io.Reader = strings.NewReader(wire.String())
+			if name == "one byte" {
+				src = iotest.OneByteReader(src)
+			}
+			r := NewReader(src)
+			for _, f := range fixtures {
+				v, err := r.ReadValue()
+				if err != nil {
+					t.Fatalf("%s: expected nil error, got %v", f.name, err)
+				}
+				if !reflect.DeepEqual(v, f.value) {
+					t.Fatalf("%s: expected %+v, got %+v", f.name, f.value, v)
+				}
+			}
+			v, err := r.ReadValue()
+			if err != nil || v.Str != big {
+				t.Fatalf("expected the big bulk string, got %v", err)
+			}
+			if _, err := r.ReadValue(); err != io.EOF {
+				t.Fatalf("expected io.EOF, got %v", err)
+			}
+		})
+	}
+
+	t.Run("unexpected eof", func(t *testing.T) {
+		r := NewReader(strings.NewReader("+OK\r\n$5\r\nhel"))
+		if _, err := r.ReadValue(); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if _, err := r.ReadValue(); err != io.ErrUnexpectedEOF {
+			t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+		}
+	})
+
+	t.Run("retries after error", func(t *testing.T) {
+		testErr := errors.New("test error")
+		r := NewReader(io.MultiReader(strings.NewReader("+O"), iotest.ErrReader(testErr)))
+		if _, err := r.ReadValue(); err != testErr {
+			t.Fatalf("expected test error, got %v", err)
+		}
+		r.r = strings.NewReader("K\r\n")
+		v, err := r.ReadValue()
+		if err != nil || v.Str != "OK" {
+			t.Fatalf("expected OK, nil, got %+v, %v", v, err)
+		}
+	})
+
+	t.Run("large aggregate", func(t *testing.T) {
+		const n = 100000
+		b := safebuffer.NewResizableBuffer(nil)
+		w := NewWriter(b).ArrayHeader(n)
+		for i := 0; i < n; i++ {
+			w.MapHeader(1).BulkString("key").Integer(int64(i))
+		}
+		wire := string(b.Bytes())
+		r := NewReader(strings.NewReader(wire))
+
+		// Reading part of it keeps track of what has been checked so far.
+		r.r = strings.NewReader(wire[:readSize*2])
+		if _, err := r.ReadValue(); err != io.ErrUnexpectedEOF {
+			t.Fatalf("expected io.ErrUnexpectedEOF, got %v", err)
+		}
+		if r.scanned < readSize || len(r.pending) == 0 {
+			t.Fatalf("expected the scan to be kept, got %d bytes and %v", r.scanned, r.pending)
+		}
+
+		r.r, r.err = strings.NewReader(wire[readSize*2:]), nil
+		v, err := r.ReadValue()
+		if err != nil || len(v.Elems) != n || v.Elems[n-1].Elems[1].Int != n-1 {
+			t.Fatalf("expected %d maps, got %d, %v", n, len(v.Elems), err)
+		}
+	})
+
+	t.Run("protocol error", func(t *testing.T) {
+		r := NewReader(strings.NewReader("?\r\n"))
+		if _, err := r.ReadValue(); err != ErrProtocol {
+			t.Fatalf("expected ErrProtocol, got %v", err)
+		}
+	})
+}
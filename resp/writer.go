@@ -0,0 +1,263 @@
+package resp
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// Writer writes RESP values into a ResizableBuffer. Aggregates are written as a header giving
+// the number of items, followed by the items themselves. Once an error is held, all writes
+// are ignored, so a chain of writes can be checked once at the end with Err.
+type Writer struct {
+	b   *safebuffer.ResizableBuffer
+	err error
+}
+
+// NewWriter creates a new Writer that appends to the buffer given.
+func NewWriter(b *safebuffer.ResizableBuffer) *Writer {
+	return &Writer{b: b}
+}
+
+// Err returns the error held by the writer, or the error held by the buffer.
+func (w *Writer) Err() error {
+	if w.err != nil {
+		return w.err
+	}
+	return w.b.Err()
+}
+
+// line writes a kind byte, the string given and a CRLF. The string must not contain a CR or
+// LF since there is no way to escape them, so ErrInvalidSimpleString is held if it does.
+func (w *Writer) line(k Kind, s string) *Writer {
+	if w.err != nil {
+		return w
+	}
+	if strings.ContainsAny(s, "\r\n") {
+		w.err = ErrInvalidSimpleString
+		return w
+	}
+	w.b.Byte(byte(k)).CopyString(s).CRLF()
+	return w
+}
+
+// number writes a kind byte, an integer and a CRLF.
+func (w *Writer) number(k Kind, v int64) *Writer {
+	if w.err != nil {
+		return w
+	}
+	var scratch [20]byte
+	w.b.Byte(byte(k)).CopyBytes(strconv.AppendInt(scratch[:0], v, 10)).CRLF()
+	return w
+}
+
+// SimpleString writes a simple string. If this contains a CR or LF, ErrInvalidSimpleString is
+// held.
+func (w *Writer) SimpleString(s string) *Writer {
+	return w.line(SimpleString, s)
+}
+
+// Error writes a simple error. If this contains a CR or LF, ErrInvalidSimpleString is held.
+func (w *Writer) Error(s string) *Writer {
+	return w.line(Error, s)
+}
+
+// Integer writes an integer.
+func (w *Writer) Integer(v int64) *Writer {
+	return w.number(Integer, v)
+}
+
+// BulkString writes a bulk string.
+func (w *Writer) BulkString(s string) *Writer {
+	if w.err != nil {
+		return w
+	}
+	w.number(BulkString, int64(len(s)))
+	w.b.CopyString(s).CRLF()
+	return w
+}
+
+// BulkBytes writes a bulk string from a byte slice.
+func (w *Writer) BulkBytes(p []byte) *Writer {
+	if w.err != nil {
+		return w
+	}
+	w.number(BulkString, int64(len(p)))
+	w.b.CopyBytes(p).CRLF()
+	return w
+}
+
+// BulkError writes a bulk error.
+func (w *Writer) BulkError(s string) *Writer {
+	if w.err != nil {
+		return w
+	}
+	w.number(BulkError, int64(len(s)))
+	w.b.CopyString(s).CRLF()
+	return w
+}
+
+// VerbatimString writes a verbatim string. The format must be three bytes long, such as "txt"
+// or "mkd", otherwise ErrInvalidValue is held.
+func (w *Writer) VerbatimString(format, s string) *Writer {
+	if w.err != nil {
+		return w
+	}
+	if len(format) != 3 {
+		w.err = ErrInvalidValue
+		return w
+	}
+	w.number(VerbatimString, int64(len(s)+4))
+	w.b.CopyString(format).Byte(':').CopyString(s).CRLF()
+	return w
+}
+
+// Null writes the RESP3 null.
+func (w *Writer) Null() *Writer {
+	if w.err != nil {
+		return w
+	}
+	w.b.Byte(byte(Null)).CRLF()
+	return w
+}
+
+// NullBulkString writes the RESP2 null bulk string.
+func (w *Writer) NullBulkString() *Writer {
+	return w.number(BulkString, -1)
+}
+
+// NullArray writes the RESP2 null array.
+func (w *Writer) NullArray() *Writer {
+	return w.number(Array, -1)
+}
+
+// Boolean writes a boolean.
+func (w *Writer) Boolean(v bool) *Writer {
+	if v {
+		return w.line(Boolean, "t")
+	}
+	return w.line(Boolean, "f")
+}
+
+// Double writes a double.
+func (w *Writer) Double(v float64) *Writer {
+	switch {
+	case math.IsInf(v, 1):
+		return w.line(Double, "inf")
+	case math.IsInf(v, -1):
+		return w.line(Double, "-inf")
+	case math.IsNaN(v):
+		return w.line(Double, "nan")
+	}
+	if w.err != nil {
+		return w
+	}
+	var scratch [32]byte
+	w.b.Byte(byte(Double)).CopyBytes(strconv.AppendFloat(scratch[:0], v, 'g', -1, 64)).CRLF()
+	return w
+}
+
+// BigNumber writes a big number.
+func (w *Writer) BigNumber(v *big.Int) *Writer {
+	if w.err != nil {
+		return w
+	}
+	w.b.Byte(byte(BigNumber))
+	w.b.CopyBytes(v.Append(nil, 10)).CRLF()
+	return w
+}
+
+// ArrayHeader starts an array of n items.
+func (w *Writer) ArrayHeader(n int) *Writer {
+	return w.number(Array, int64(n))
+}
+
+// MapHeader starts a map of n pairs. Each key must be followed by its value.
+func (w *Writer) MapHeader(n int) *Writer {
+	return w.number(Map, int64(n))
+}
+
+// SetHeader starts a set of n items.
+func (w *Writer) SetHeader(n int) *Writer {
+	return w.number(Set, int64(n))
+}
+
+// PushHeader starts a push of n items.
+func (w *Writer) PushHeader(n int) *Writer {
+	return w.number(Push, int64(n))
+}
+
+// AttributeHeader starts an attribute of n pairs. The value it describes must follow it.
+func (w *Writer) AttributeHeader(n int) *Writer {
+	return w.number(Attribute, int64(n))
+}
+
+// Command writes a command the way clients send them, as an array of bulk strings.
+func (w *Writer) Command(args ...string) *Writer {
+	w.ArrayHeader(len(args))
+	for _, arg := range args {
+		w.BulkString(arg)
+	}
+	return w
+}
+
+// Value writes a parsed value back out. If the value could not have been parsed, such as a
+// big number that is not all digits or a map with an odd number of elements, ErrInvalidValue
+// is held.
+func (w *Writer) Value(v Value) *Writer {
+	if w.err != nil {
+		return w
+	}
+	switch v.Kind {
+	case SimpleString:
+		return w.SimpleString(v.Str)
+	case Error:
+		return w.Error(v.Str)
+	case Integer:
+		return w.Integer(v.Int)
+	case BulkString:
+		if v.IsNull {
+			return w.NullBulkString()
+		}
+		return w.BulkString(v.Str)
+	case Null:
+		return w.Null()
+	case Boolean:
+		return w.Boolean(v.Bool)
+	case Double:
+		return w.Double(v.Float)
+	case BigNumber:
+		if !validBigNumber([]byte(v.Str)) {
+			w.err = ErrInvalidValue
+			return w
+		}
+		w.line(BigNumber, v.Str)
+	case BulkError:
+		return w.BulkError(v.Str)
+	case VerbatimString:
+		return w.VerbatimString(v.Format, v.Str)
+	case Array, Set, Push:
+		if v.IsNull {
+			return w.NullArray()
+		}
+		w.number(v.Kind, int64(len(v.Elems)))
+		for _, e := range v.Elems {
+			w.Value(e)
+		}
+	case Map, Attribute:
+		if len(v.Elems)%2 != 0 {
+			w.err = ErrInvalidValue
+			return w
+		}
+		w.number(v.Kind, int64(len(v.Elems)/2))
+		for _, e := range v.Elems {
+			w.Value(e)
+		}
+	default:
+		w.err = ErrInvalidValue
+	}
+	return w
+}
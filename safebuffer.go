@@ -2,14 +2,76 @@ package safebuffer
 
 import (
 	"encoding/binary"
+	"errors"
 	"io"
 	"math"
+	"math/bits"
 )
 
+// ErrTooLarge is the error a ResizableBuffer holds once a write would take it past the
+// maximum size set with WithMaxSize.
+var ErrTooLarge = errors.New("safebuffer: buffer would exceed its maximum size")
+
 // ResizableBuffer is a buffer that can be resized. This is single threaded.
 type ResizableBuffer struct {
 	buffer []byte
 	offset int
+
+	// start is where the consumed buffer begins. Anything before it is headroom that prepends
+	// can write into without moving the consumed buffer.
+	start    int
+	headroom int
+
+	// prepended is the total number of bytes ever prepended. Placeholders use this to find
+	// their data after it has been shifted by a prepend.
+	prepended int
+
+	// maxSize is the most bytes the consumed buffer can hold, or 0 if it is unbounded. Once a
+	// write would go past it, err is set and all writes are ignored until Reset.
+	maxSize int
+	err     error
+
+	// secure makes the buffer wipe every byte it stops using, including old backing arrays.
+	secure bool
+
+	growth GrowthPolicy
+
+	// putAtGrowth lets writes at an offset grow the consumed buffer.
+	putAtGrowth bool
+
+	// marks is how many marks are open. Reset drops all of them.
+	marks int
+
+	// gen is bumped whenever slices previously handed out may no longer point at the
+	// consumed buffer, such as on Reset, reallocation or when data is moved. epoch is only
+	// bumped when data is dropped or moved within the consumed buffer, so it survives
+	// reallocation.
+	gen   uint64
+	epoch uint64
+
+	// edits logs the inserts and deletes made since the last Reset or drain, so placeholders
+	// can find where their data was moved to. editsFrom is how many were logged before the
+	// first one in edits. Resets and drains cannot be followed, so they clear the log.
+	edits     []edit
+	editsFrom uint64
+
+	// shared is set once a plain sub-buffer has been handed out. Those point straight into the
+	// backing array, so data cannot be moved within it until Reset without them overwriting it.
+	shared bool
+
+	// checked makes sub-buffers panic if they are used after the parent's gen changes. For a
+	// sub-buffer, parent and parentGen are what it checks against.
+	checked   bool
+	parent    *ResizableBuffer
+	parentGen uint64
+
+	// linked is set for sub-buffers made with LinkedSubBuffer. These check the parent's epoch
+	// instead, and find their slice again from linkOffset, linkLength and linkPrepended when
+	// the parent reallocates.
+	linked        bool
+	linkOffset    int
+	linkLength    int
+	linkPrepended int
 }
 
 // NewResizableBuffer creates a new ResizableBuffer. Can be nil if you want it to be fully dynamic.
@@ -22,55 +84,199 @@ func NewResizableBuffer(b []byte) *ResizableBuffer {
 	}
 }
 
-func (b *ResizableBuffer) ensureCapacity(n int) {
-	if len(b.buffer)-b.offset < n {
-		lt2 := (n + len(b.buffer)) * 2
-		buf := make([]byte, lt2, lt2)
-		copy(buf, b.buffer)
-		b.buffer = buf
+// WithHeadroom sets the amount of space kept free at the front of the buffer so that
+// prepends do not need to move the consumed buffer. If the buffer is empty, the space is
+// made straight away. Otherwise, it is made the next time a prepend runs out of room.
+func (b *ResizableBuffer) WithHeadroom(n int) *ResizableBuffer {
+	b.headroom = n
+	if b.offset == 0 {
+		b.makeHeadroom(0)
+	}
+	return b
+}
+
+// WithMaxSize sets the maximum number of bytes the consumed buffer can hold. Once a write
+// would go past this, the write is ignored and Err returns ErrTooLarge. All writes after that
+// are ignored too, so a chain of writes can be checked once at the end. A size of 0 or less
+// means the buffer is unbounded, which is the default.
+func (b *ResizableBuffer) WithMaxSize(n int) *ResizableBuffer {
+	b.maxSize = n
+	return b
+}
+
+// WithSecureWipe makes the buffer wipe data it no longer uses, so secrets written to it are
+// not left behind in memory. Old backing arrays are zeroed when the buffer grows, data that
+// is moved or drained is zeroed where it was, and Reset always zeroes the consumed buffer.
+// Use Destroy to wipe everything once the buffer is no longer needed.
+func (b *ResizableBuffer) WithSecureWipe() *ResizableBuffer {
+	b.secure = true
+	return b
+}
+
+// Destroy zeroes the whole backing array, including anything past the consumed buffer, and
+// leaves the buffer empty with any error cleared. The buffer can still be written to
+// afterwards.
+func (b *ResizableBuffer) Destroy() {
+	clear(b.buffer)
+	b.buffer = []byte{}
+	b.offset = 0
+	b.start = 0
+	b.err = nil
+	b.marks = 0
+	b.shared = false
+	b.edits = nil
+	b.lostEdits()
+	b.dropped()
+}
+
+// wipe zeroes the slice given if the buffer is in secure mode.
+func (b *ResizableBuffer) wipe(s []byte) {
+	if b.secure {
+		clear(s)
 	}
 }
 
+// Err returns the error that stopped writes to the buffer, or nil if there was none. This is
+// cleared by Reset.
+func (b *ResizableBuffer) Err() error {
+	return b.err
+}
+
+// edit is an insert of n bytes, or a delete of -n bytes, at pos. pos is the offset within
+// the consumed buffer less the number of bytes prepended at the time, so it does not change
+// when more is prepended.
+type edit struct {
+	pos int
+	n   int
+}
+
+// dropped is called when data in the consumed buffer is dropped or moved within it, which
+// makes all slices and sub-buffers of it stale.
+func (b *ResizableBuffer) dropped() {
+	b.gen++
+	b.epoch++
+}
+
+// edited logs an insert or delete at the offset given.
+func (b *ResizableBuffer) edited(off, n int) {
+	b.edits = append(b.edits, edit{pos: off - b.prepended, n: n})
+}
+
+// lostEdits is called when data is dropped in a way placeholders cannot follow, which makes
+// all of them stale.
+func (b *ResizableBuffer) lostEdits() {
+	b.editsFrom += uint64(len(b.edits)) + 1
+	b.edits = b.edits[:0]
+}
+
+func (b *ResizableBuffer) end() int {
+	return b.start + b.offset
+}
+
+// fits checks n more bytes can be written, setting the error if they cannot.
+func (b *ResizableBuffer) fits(n int) bool {
+	b.check()
+	if b.err != nil {
+		return false
+	}
+	if b.maxSize > 0 && b.offset+n > b.maxSize {
+		b.err = ErrTooLarge
+		return false
+	}
+	return true
+}
+
+// capSize limits the size of a new backing array so it is never bigger than the maximum size
+// allows, given front bytes will be in front of the consumed buffer.
+func (b *ResizableBuffer) capSize(size, front int) int {
+	if b.maxSize > 0 && size > front+b.maxSize {
+		return front + b.maxSize
+	}
+	return size
+}
+
+func (b *ResizableBuffer) ensureCapacity(n int) bool {
+	if !b.fits(n) {
+		return false
+	}
+	if len(b.buffer)-b.end() < n {
+		if b.linked {
+			b.err = ErrSubBufferOverflow
+			return false
+		}
+
+		// Space in front of the consumed buffer past the headroom was freed by draining it, so
+		// it is not kept.
+		front := min(b.start, b.headroom)
+		if !b.shared && len(b.buffer)-front-b.offset >= n {
+			// Sliding the consumed buffer back over the freed space makes enough room. This is
+			// not done while sub-buffers exist, since they would then write over moved data.
+			copy(b.buffer[front:], b.buffer[b.start:b.end()])
+			b.wipe(b.buffer[max(front+b.offset, b.start):b.end()])
+		} else {
+			lt2 := b.newCapacity(front+b.offset+n, front)
+			buf := make([]byte, lt2, lt2)
+			copy(buf[front:], b.buffer[b.start:b.end()])
+			b.wipe(b.buffer)
+			b.buffer = buf
+		}
+		b.start = front
+		b.gen++
+	}
+	return true
+}
+
 // CopyBytes copies the bytes specified into the consumed buffer.
 func (b *ResizableBuffer) CopyBytes(p []byte) *ResizableBuffer {
-	b.ensureCapacity(len(p))
-	copy(b.buffer[b.offset:], p)
+	if !b.ensureCapacity(len(p)) {
+		return b
+	}
+	copy(b.buffer[b.end():], p)
 	b.offset += len(p)
 	return b
 }
 
 // CopyString copies the string specified into the consumed buffer.
 func (b *ResizableBuffer) CopyString(p string) *ResizableBuffer {
-	b.ensureCapacity(len(p))
-	copy(b.buffer[b.offset:], p)
+	if !b.ensureCapacity(len(p)) {
+		return b
+	}
+	copy(b.buffer[b.end():], p)
 	b.offset += len(p)
 	return b
 }
 
 // Byte writes a single byte into the consumed buffer.
 func (b *ResizableBuffer) Byte(bt byte) *ResizableBuffer {
-	b.ensureCapacity(1)
-	b.buffer[b.offset] = bt
+	if !b.ensureCapacity(1) {
+		return b
+	}
+	b.buffer[b.end()] = bt
 	b.offset++
 	return b
 }
 
 // CRLF writes a CRLF into the consumed buffer.
 func (b *ResizableBuffer) CRLF() *ResizableBuffer {
-	b.ensureCapacity(2)
-	b.buffer[b.offset] = '\r'
-	b.buffer[b.offset+1] = '\n'
+	if !b.ensureCapacity(2) {
+		return b
+	}
+	end := b.end()
+	b.buffer[end] = '\r'
+	b.buffer[end+1] = '\n'
 	b.offset += 2
 	return b
 }
 
 // Uint16 writes a uint16 into the consumed buffer.
 func (b *ResizableBuffer) Uint16(v uint16, littleEndian bool) *ResizableBuffer {
-	b.ensureCapacity(2)
+	if !b.ensureCapacity(2) {
+		return b
+	}
 	if littleEndian {
-		binary.LittleEndian.PutUint16(b.buffer[b.offset:], v)
+		binary.LittleEndian.PutUint16(b.buffer[b.end():], v)
 	} else {
-		binary.BigEndian.PutUint16(b.buffer[b.offset:], v)
+		binary.BigEndian.PutUint16(b.buffer[b.end():], v)
 	}
 	b.offset += 2
 	return b
@@ -78,11 +284,13 @@ func (b *ResizableBuffer) Uint16(v uint16, littleEndian bool) *ResizableBuffer {
 
 // Uint32 writes a uint32 into the consumed buffer.
 func (b *ResizableBuffer) Uint32(v uint32, littleEndian bool) *ResizableBuffer {
-	b.ensureCapacity(4)
+	if !b.ensureCapacity(4) {
+		return b
+	}
 	if littleEndian {
-		binary.LittleEndian.PutUint32(b.buffer[b.offset:], v)
+		binary.LittleEndian.PutUint32(b.buffer[b.end():], v)
 	} else {
-		binary.BigEndian.PutUint32(b.buffer[b.offset:], v)
+		binary.BigEndian.PutUint32(b.buffer[b.end():], v)
 	}
 	b.offset += 4
 	return b
@@ -90,11 +298,13 @@ func (b *ResizableBuffer) Uint32(v uint32, littleEndian bool) *ResizableBuffer {
 
 // Uint64 writes a uint64 into the consumed buffer.
 func (b *ResizableBuffer) Uint64(v uint64, littleEndian bool) *ResizableBuffer {
-	b.ensureCapacity(8)
+	if !b.ensureCapacity(8) {
+		return b
+	}
 	if littleEndian {
-		binary.LittleEndian.PutUint64(b.buffer[b.offset:], v)
+		binary.LittleEndian.PutUint64(b.buffer[b.end():], v)
 	} else {
-		binary.BigEndian.PutUint64(b.buffer[b.offset:], v)
+		binary.BigEndian.PutUint64(b.buffer[b.end():], v)
 	}
 	b.offset += 8
 	return b
@@ -125,11 +335,42 @@ func (b *ResizableBuffer) Float64(v float64, littleEndian bool) *ResizableBuffer
 	return b.Uint64(math.Float64bits(v), littleEndian)
 }
 
+// UvarintSize returns the number of bytes Uvarint will use to encode the value.
+func UvarintSize(v uint64) int {
+	return (bits.Len64(v|1) + 6) / 7
+}
+
+// VarintSize returns the number of bytes Varint will use to encode the value.
+func VarintSize(v int64) int {
+	return UvarintSize(zigzag(v))
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
+
+// Uvarint writes a uint64 as a variable length integer into the consumed buffer. This uses
+// the same encoding as binary.PutUvarint.
+func (b *ResizableBuffer) Uvarint(v uint64) *ResizableBuffer {
+	if !b.ensureCapacity(UvarintSize(v)) {
+		return b
+	}
+	b.offset += binary.PutUvarint(b.buffer[b.end():], v)
+	return b
+}
+
+// Varint writes a int64 as a zigzag encoded variable length integer into the consumed buffer.
+// This uses the same encoding as binary.PutVarint.
+func (b *ResizableBuffer) Varint(v int64) *ResizableBuffer {
+	return b.Uvarint(zigzag(v))
+}
+
 // Bytes returns the bytes of the consumed buffer. Note that this slice is only valid
 // until the next call to Reset. After that function is called, it is not guaranteed that
-// this data will not be overwritten.
+// this data will not be overwritten. BytesView returns a slice that checks this.
 func (b *ResizableBuffer) Bytes() []byte {
-	return b.buffer[:b.offset]
+	b.check()
+	return b.buffer[b.start:b.end()]
 }
 
 // Len returns the length of the consumed buffer.
@@ -137,17 +378,53 @@ func (b *ResizableBuffer) Len() int {
 	return b.offset
 }
 
-func (b *ResizableBuffer) prependStart(n int, f func(b []byte)) *ResizableBuffer {
-	if len(b.buffer)-b.offset < n {
-		lt2 := (n + len(b.buffer)) * 2
+// makeHeadroom moves the consumed buffer so that there are n bytes plus some headroom free in
+// front of it, growing the buffer if it cannot fit. The headroom is at least the configured
+// amount, but grows with the consumed buffer so that repeated prepends only move it a
+// logarithmic number of times.
+func (b *ResizableBuffer) makeHeadroom(n int) {
+	room := b.headroom
+	if !b.linked {
+		// Linked sub-buffers cannot grow, so they only keep the configured amount.
+		room = max(room, b.offset)
+		if b.maxSize > 0 {
+			// There is no point keeping more room than can ever be prepended.
+			room = min(room, max(b.headroom, b.maxSize-b.offset-n))
+		}
+	}
+	want := n + room
+	if len(b.buffer)-b.offset < want {
+		if b.linked {
+			b.err = ErrSubBufferOverflow
+			return
+		}
+		lt2 := b.newCapacity(want+b.offset, want)
 		buf := make([]byte, lt2, lt2)
-		copy(buf[n:], b.buffer)
+		copy(buf[want:], b.buffer[b.start:b.end()])
+		b.wipe(b.buffer)
 		b.buffer = buf
 	} else {
-		copy(b.buffer[n:], b.buffer)
+		copy(b.buffer[want:], b.buffer[b.start:b.end()])
+		b.wipe(b.buffer[b.start:min(b.end(), want)])
 	}
-	f(b.buffer)
+	b.start = want
+	b.gen++
+}
+
+func (b *ResizableBuffer) prependStart(n int, f func(b []byte)) *ResizableBuffer {
+	if !b.fits(n) {
+		return b
+	}
+	if b.start < n {
+		b.makeHeadroom(n)
+		if b.err != nil {
+			return b
+		}
+	}
+	b.start -= n
+	f(b.buffer[b.start:])
 	b.offset += n
+	b.prepended += n
 	return b
 }
 
@@ -230,45 +507,207 @@ func (b *ResizableBuffer) PrependFloat64(v float64, littleEndian bool) *Resizabl
 	return b.PrependUint64(math.Float64bits(v), littleEndian)
 }
 
-// Reset resets the consumed buffer so it can be reused. Can optionally zero out
-// the buffer data we wrote to prevent information leaks.
+// PrependUvarint prepends a uint64 as a variable length integer into the consumed buffer.
+func (b *ResizableBuffer) PrependUvarint(v uint64) *ResizableBuffer {
+	return b.prependStart(UvarintSize(v), func(b []byte) {
+		binary.PutUvarint(b, v)
+	})
+}
+
+// PrependVarint prepends a int64 as a zigzag encoded variable length integer into the consumed buffer.
+func (b *ResizableBuffer) PrependVarint(v int64) *ResizableBuffer {
+	return b.PrependUvarint(zigzag(v))
+}
+
+// Reset resets the consumed buffer so it can be reused and clears any error. Can optionally
+// zero out the buffer data we wrote to prevent information leaks. This always happens if
+// the buffer is in secure mode.
 func (b *ResizableBuffer) Reset(zeroOut bool) *ResizableBuffer {
-	if zeroOut {
-		clear(b.buffer[:b.offset])
+	if zeroOut || b.secure {
+		clear(b.buffer[b.start:b.end()])
 	}
 	b.offset = 0
+	b.start = min(b.headroom, len(b.buffer))
+	b.err = nil
+	b.marks = 0
+	b.shared = false
+	b.lostEdits()
+	b.dropped()
 	return b
 }
 
+// left returns how many more bytes the consumed buffer can hold before it hits its maximum size.
+func (b *ResizableBuffer) left() int {
+	if b.linked {
+		return min(b.maxLeft(), len(b.buffer)-b.end())
+	}
+	return b.maxLeft()
+}
+
+// maxLeft returns how many more bytes the consumed buffer can hold under its maximum size.
+func (b *ResizableBuffer) maxLeft() int {
+	if b.maxSize > 0 {
+		return b.maxSize - b.offset
+	}
+	return math.MaxInt
+}
+
+// full returns the error for a write that does not fit in what left allows.
+func (b *ResizableBuffer) full() error {
+	if b.linked && b.maxLeft() > 0 {
+		return ErrSubBufferOverflow
+	}
+	return ErrTooLarge
+}
+
 // ReadInto is used to read into a buffer from a io.Reader. The returned slice is only valid
 // until the next call to Reset. After that function is called, it is not guaranteed that
-// this data will not be overwritten.
+// this data will not be overwritten. If the buffer has a maximum size, the read is limited
+// to what the buffer can still hold. ReadIntoView returns a slice that checks this.
 func (b *ResizableBuffer) ReadInto(r io.Reader, maxSize int) ([]byte, error) {
-	if maxSize > 0 {
-		b.ensureCapacity(maxSize)
-	} else {
-		// The maximum size is the length of the buffer minus the offset
-		maxSize = len(b.buffer) - b.offset
+	b.check()
+	if b.err != nil {
+		return nil, b.err
+	}
+	if maxSize <= 0 {
+		// The maximum size is the length of the buffer minus the end of the consumed buffer
+		maxSize = len(b.buffer) - b.end()
+	}
+	if left := b.left(); maxSize > left {
+		if left == 0 {
+			b.err = b.full()
+			return nil, b.err
+		}
+		maxSize = left
+	}
+	if !b.ensureCapacity(maxSize) {
+		return nil, b.err
 	}
 
-	n, err := r.Read(b.buffer[b.offset : b.offset+maxSize])
-	chunk := b.buffer[b.offset : b.offset+n]
+	end := b.end()
+	n, err := r.Read(b.buffer[end : end+maxSize])
+	chunk := b.buffer[end : end+n]
 	b.offset += n
 	return chunk, err
 }
 
+// Write implements io.Writer. It copies the bytes specified into the consumed buffer. The
+// only error returned is the one from Err.
+func (b *ResizableBuffer) Write(p []byte) (int, error) {
+	if b.CopyBytes(p).err != nil {
+		return 0, b.err
+	}
+	return len(p), nil
+}
+
+// WriteString implements io.StringWriter. It copies the string specified into the consumed
+// buffer. The only error returned is the one from Err.
+func (b *ResizableBuffer) WriteString(s string) (int, error) {
+	if b.CopyString(s).err != nil {
+		return 0, b.err
+	}
+	return len(s), nil
+}
+
+// WriteByte implements io.ByteWriter. It writes a single byte into the consumed buffer. The
+// only error returned is the one from Err.
+func (b *ResizableBuffer) WriteByte(c byte) error {
+	return b.Byte(c).err
+}
+
+// minReadFromSize is the minimum amount of space ReadFrom makes available before each read.
+const minReadFromSize = 512
+
+// ReadFrom implements io.ReaderFrom. It reads from r until io.EOF, growing the buffer as
+// needed, and returns the number of bytes read. io.EOF is not returned as an error. If the
+// buffer has a maximum size and r has more data than fits, ErrTooLarge is returned.
+func (b *ResizableBuffer) ReadFrom(r io.Reader) (int64, error) {
+	b.check()
+	if b.err != nil {
+		return 0, b.err
+	}
+	var total int64
+	for {
+		size := min(minReadFromSize, b.left())
+		if size == 0 {
+			// Check if there is anything left before deciding the data is too large.
+			var probe [1]byte
+			n, err := r.Read(probe[:])
+			if n > 0 {
+				b.err = b.full()
+				return total, b.err
+			}
+			if err == io.EOF {
+				return total, nil
+			}
+			if err != nil {
+				return total, err
+			}
+			continue
+		}
+		b.ensureCapacity(size)
+		end := b.end()
+		n, err := r.Read(b.buffer[end : end+min(len(b.buffer)-end, b.left())])
+		if n < 0 {
+			panic("safebuffer: reader returned negative count from Read")
+		}
+		b.offset += n
+		total += int64(n)
+		if err == io.EOF {
+			return total, nil
+		}
+		if err != nil {
+			return total, err
+		}
+	}
+}
+
+// WriteTo implements io.WriterTo. It writes the consumed buffer to w and drains whatever
+// was written, so the buffer is empty after a successful call. If w only accepts part of
+// the data, the rest is kept in the buffer.
+func (b *ResizableBuffer) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(b.Bytes())
+	if n < 0 || n > b.offset {
+		panic("safebuffer: writer returned invalid count from Write")
+	}
+	b.wipe(b.buffer[b.start : b.start+n])
+	b.lostEdits()
+	b.dropped()
+	if n == b.offset {
+		b.offset = 0
+		b.start = min(b.headroom, len(b.buffer))
+		return int64(n), err
+	}
+	b.start += n
+	b.offset -= n
+	if err == nil {
+		err = io.ErrShortWrite
+	}
+	return int64(n), err
+}
+
 // SubBuffer returns a new ResizableBuffer that is a subbuffer of the current one.
 // If you specify <0 for the length, it will use the remaining buffer. The returned
 // buffer is not a copy, it is a view into the current buffer. Note that this means
 // that the returned buffer is only valid until the next call to Reset. After that
 // function is called, it is not guaranteed that the returned buffer will not be
-// overwritten.
+// overwritten. If the sub-buffer would take the buffer past its maximum size, the
+// returned buffer holds the same error and ignores all writes. WithChecks makes the returned
+// buffer panic if it is used after this happens. LinkedSubBuffer returns a sub-buffer that
+// survives the parent growing.
 func (b *ResizableBuffer) SubBuffer(length int) *ResizableBuffer {
 	if length < 0 {
-		length = len(b.buffer) - b.offset
+		length = min(len(b.buffer)-b.end(), b.left())
+	}
+	if !b.ensureCapacity(length) {
+		return &ResizableBuffer{buffer: []byte{}, err: b.err}
 	}
-	b.ensureCapacity(length)
-	s := b.buffer[b.offset : b.offset+length]
+	end := b.end()
+	s := b.buffer[end : end+length]
 	b.offset += length
+	b.shared = true
+	if b.checked {
+		return &ResizableBuffer{buffer: s, checked: true, parent: b, parentGen: b.gen}
+	}
 	return &ResizableBuffer{buffer: s}
 }
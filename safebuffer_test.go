@@ -4,8 +4,11 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"testing"
+	"testing/iotest"
 )
 
 func TestNewResizableBuffer(t *testing.T) {
@@ -896,3 +899,587 @@ func TestSubBuffer(t *testing.T) {
 		},
 	}, true)
 }
+
+var (
+	_ io.Writer       = (*ResizableBuffer)(nil)
+	_ io.ByteWriter   = (*ResizableBuffer)(nil)
+	_ io.StringWriter = (*ResizableBuffer)(nil)
+	_ io.ReaderFrom   = (*ResizableBuffer)(nil)
+	_ io.WriterTo     = (*ResizableBuffer)(nil)
+)
+
+func TestWrite(t *testing.T) {
+	testAppendCases(t, []testCase{
+		{
+			name: "write",
+			eq:   []byte{1, 2, 3},
+			fn: func(t *testing.T, b *ResizableBuffer) {
+				n, err := b.Write([]byte{1, 2, 3})
+				if n != 3 || err != nil {
+					t.Fatalf("expected 3, nil, got %d, %v", n, err)
+				}
+			},
+		},
+		{
+			name: "write string",
+			eq:   []byte("hello"),
+			fn: func(t *testing.T, b *ResizableBuffer) {
+				n, err := b.WriteString("hello")
+				if n != 5 || err != nil {
+					t.Fatalf("expected 5, nil, got %d, %v", n, err)
+				}
+			},
+		},
+		{
+			name: "write byte",
+			eq:   []byte{9},
+			fn: func(t *testing.T, b *ResizableBuffer) {
+				if err := b.WriteByte(9); err != nil {
+					t.Fatalf("expected nil error, got %v", err)
+				}
+			},
+		},
+		{
+			name: "fprintf",
+			eq:   []byte("a=1 b=two"),
+			fn: func(t *testing.T, b *ResizableBuffer) {
+				fmt.Fprintf(b, "a=%d b=%s", 1, "two")
+			},
+		},
+	}, false)
+}
+
+func TestReadFrom(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 1000)
+
+	t.Run("grows until eof", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("x")
+		n, err := rb.ReadFrom(iotest.HalfReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		if n != int64(len(data)) {
+			t.Fatalf("expected %d bytes, got %d", len(data), n)
+		}
+		if !bytes.Equal(rb.Bytes(), append([]byte("x"), data...)) {
+			t.Fatal("expected buffer to contain the reader data")
+		}
+	})
+
+	t.Run("io copy", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		n, err := io.Copy(rb, iotest.OneByteReader(bytes.NewReader(data[:100])))
+		if err != nil || n != 100 {
+			t.Fatalf("expected 100, nil, got %d, %v", n, err)
+		}
+		if !bytes.Equal(rb.Bytes(), data[:100]) {
+			t.Fatal("expected buffer to contain the reader data")
+		}
+	})
+
+	t.Run("reader errors", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		testErr := errors.New("test error")
+		r := io.MultiReader(bytes.NewReader([]byte("abc")), errorfulReader{err: testErr})
+		n, err := rb.ReadFrom(r)
+		if err != testErr {
+			t.Fatalf("expected test error, got %v", err)
+		}
+		if n != 3 || string(rb.Bytes()) != "abc" {
+			t.Fatalf("expected abc to be read, got %d, %q", n, rb.Bytes())
+		}
+	})
+}
+
+type limitedWriter struct {
+	bytes.Buffer
+	limit int
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) > w.limit {
+		p = p[:w.limit]
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestWriteTo(t *testing.T) {
+	t.Run("drains", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("hello")
+		var out bytes.Buffer
+		n, err := rb.WriteTo(&out)
+		if err != nil || n != 5 {
+			t.Fatalf("expected 5, nil, got %d, %v", n, err)
+		}
+		if out.String() != "hello" {
+			t.Fatalf("expected hello, got %q", out.String())
+		}
+		if rb.Len() != 0 {
+			t.Fatalf("expected 0 bytes left, got %d", rb.Len())
+		}
+	})
+
+	t.Run("short write", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).CopyString("hello")
+		w := &limitedWriter{limit: 2}
+		n, err := rb.WriteTo(w)
+		if err != io.ErrShortWrite || n != 2 {
+			t.Fatalf("expected 2, io.ErrShortWrite, got %d, %v", n, err)
+		}
+		if string(rb.Bytes()) != "llo" {
+			t.Fatalf("expected llo to be kept, got %q", rb.Bytes())
+		}
+	})
+}
+
+func TestWithHeadroom(t *testing.T) {
+	t.Run("empty buffer", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithHeadroom(16)
+		if rb.start != 16 {
+			t.Fatalf("expected start to be 16, got %d", rb.start)
+		}
+		if len(rb.buffer) < 16 {
+			t.Fatalf("expected buffer to have room for the headroom, got %d", len(rb.buffer))
+		}
+		if rb.Len() != 0 {
+			t.Fatalf("expected 0 bytes, got %d", rb.Len())
+		}
+	})
+
+	t.Run("prepends do not move data", func(t *testing.T) {
+		rb := NewResizableBuffer(make([]byte, 1000)).WithHeadroom(64)
+		rb.CopyString("body")
+		body := &rb.Bytes()[0]
+		buffer := &rb.buffer[0]
+		rb.PrependUint16(0x0102, false).PrependByte(3).PrependString("hdr")
+		if &rb.buffer[0] != buffer {
+			t.Fatal("expected buffer to be un-changed")
+		}
+		if &rb.Bytes()[6] != body {
+			t.Fatal("expected body not to be moved")
+		}
+		expected := []byte{'h', 'd', 'r', 3, 1, 2, 'b', 'o', 'd', 'y'}
+		if !bytes.Equal(rb.Bytes(), expected) {
+			t.Fatalf("expected %v, got %v", expected, rb.Bytes())
+		}
+	})
+
+	t.Run("headroom is restored when exhausted", func(t *testing.T) {
+		rb := NewResizableBuffer(make([]byte, 1000)).WithHeadroom(4)
+		rb.CopyString("body").PrependString("abcd").PrependString("ef")
+		if string(rb.Bytes()) != "efabcdbody" {
+			t.Fatalf("expected efabcdbody, got %q", rb.Bytes())
+		}
+		// The headroom grows to match the 8 bytes that were in the buffer.
+		if rb.start != 8 {
+			t.Fatalf("expected start to be 8, got %d", rb.start)
+		}
+	})
+
+	t.Run("headroom grows with the buffer", func(t *testing.T) {
+		rb := NewResizableBuffer(make([]byte, 1000)).WithHeadroom(8)
+		rb.CopyBytes(make([]byte, 1000))
+		gen := rb.gen
+		for i := 0; i < 100; i++ {
+			rb.PrependUint32(uint32(i), false)
+		}
+		if moves := rb.gen - gen; moves > 1 {
+			t.Fatalf("expected the buffer to move at most once, moved %d times", moves)
+		}
+		if rb.Len() != 1400 {
+			t.Fatalf("expected 1400 bytes, got %d", rb.Len())
+		}
+	})
+
+	t.Run("headroom kept on growth", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithHeadroom(8)
+		rb.CopyString("hello").PrependString("x")
+		rb.CopyBytes(make([]byte, 100))
+		if rb.start != 7 {
+			t.Fatalf("expected start to be 7, got %d", rb.start)
+		}
+		if string(rb.Bytes()[:6]) != "xhello" || rb.Len() != 106 {
+			t.Fatalf("expected data to be kept, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("reset restores headroom", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithHeadroom(8)
+		rb.CopyString("hello").PrependString("12345678")
+		if rb.start != 0 {
+			t.Fatalf("expected start to be 0, got %d", rb.start)
+		}
+		rb.Reset(false)
+		if rb.start != 8 {
+			t.Fatalf("expected start to be 8, got %d", rb.start)
+		}
+		rb.CopyString("a")
+		if string(rb.Bytes()) != "a" {
+			t.Fatalf("expected a, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("partial write to keeps headroom data", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithHeadroom(8)
+		rb.CopyString("hello").PrependString("<")
+		w := &limitedWriter{limit: 3}
+		if _, err := rb.WriteTo(w); err != io.ErrShortWrite {
+			t.Fatalf("expected io.ErrShortWrite, got %v", err)
+		}
+		if string(rb.Bytes()) != "llo" {
+			t.Fatalf("expected llo, got %q", rb.Bytes())
+		}
+	})
+}
+
+func TestUvarint(t *testing.T) {
+	testAppendCases(t, []testCase{
+		{
+			name: "single byte",
+			eq:   binary.AppendUvarint(nil, 1),
+			fn: handleChainCase(func(b *ResizableBuffer) *ResizableBuffer {
+				return b.Uvarint(1)
+			}),
+		},
+		{
+			name: "multi byte",
+			eq:   binary.AppendUvarint(nil, 300),
+			fn: handleChainCase(func(b *ResizableBuffer) *ResizableBuffer {
+				return b.Uvarint(300)
+			}),
+		},
+		{
+			name: "max",
+			eq:   binary.AppendUvarint(nil, math.MaxUint64),
+			fn: handleChainCase(func(b *ResizableBuffer) *ResizableBuffer {
+				return b.Uvarint(math.MaxUint64)
+			}),
+		},
+	}, false)
+}
+
+func TestVarint(t *testing.T) {
+	testAppendCases(t, []testCase{
+		{
+			name: "negative",
+			eq:   binary.AppendVarint(nil, -1),
+			fn: handleChainCase(func(b *ResizableBuffer) *ResizableBuffer {
+				return b.Varint(-1)
+			}),
+		},
+		{
+			name: "positive",
+			eq:   binary.AppendVarint(nil, 1000),
+			fn: handleChainCase(func(b *ResizableBuffer) *ResizableBuffer {
+				return b.Varint(1000)
+			}),
+		},
+		{
+			name: "min",
+			eq:   binary.AppendVarint(nil, math.MinInt64),
+			fn: handleChainCase(func(b *ResizableBuffer) *ResizableBuffer {
+				return b.Varint(math.MinInt64)
+			}),
+		},
+	}, false)
+}
+
+func TestPrependUvarint(t *testing.T) {
+	testPrependCases(t, []testCase{
+		{
+			name: "multi byte",
+			eq:   binary.AppendUvarint(nil, 300),
+			fn: handleChainCase(func(b *ResizableBuffer) *ResizableBuffer {
+				return b.PrependUvarint(300)
+			}),
+		},
+		{
+			name: "single byte",
+			eq:   binary.AppendUvarint(nil, 0),
+			fn: handleChainCase(func(b *ResizableBuffer) *ResizableBuffer {
+				return b.PrependUvarint(0)
+			}),
+		},
+	})
+}
+
+func TestPrependVarint(t *testing.T) {
+	testPrependCases(t, []testCase{
+		{
+			name: "negative",
+			eq:   binary.AppendVarint(nil, -300),
+			fn: handleChainCase(func(b *ResizableBuffer) *ResizableBuffer {
+				return b.PrependVarint(-300)
+			}),
+		},
+		{
+			name: "max",
+			eq:   binary.AppendVarint(nil, math.MaxInt64),
+			fn: handleChainCase(func(b *ResizableBuffer) *ResizableBuffer {
+				return b.PrependVarint(math.MaxInt64)
+			}),
+		},
+	})
+}
+
+func TestVarintSize(t *testing.T) {
+	for _, v := range []uint64{0, 1, 127, 128, 16383, 16384, math.MaxUint32, math.MaxUint64} {
+		if UvarintSize(v) != len(binary.AppendUvarint(nil, v)) {
+			t.Fatalf("UvarintSize(%d) = %d, expected %d", v, UvarintSize(v), len(binary.AppendUvarint(nil, v)))
+		}
+	}
+	for _, v := range []int64{0, -1, 63, -64, 64, math.MinInt64, math.MaxInt64} {
+		if VarintSize(v) != len(binary.AppendVarint(nil, v)) {
+			t.Fatalf("VarintSize(%d) = %d, expected %d", v, VarintSize(v), len(binary.AppendVarint(nil, v)))
+		}
+	}
+}
+
+func TestWithMaxSize(t *testing.T) {
+	t.Run("writes within limit", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(8)
+		rb.Uint32(1, true).Uint16(2, true).CopyString("ab")
+		if rb.Err() != nil {
+			t.Fatalf("expected nil error, got %v", rb.Err())
+		}
+		if rb.Len() != 8 {
+			t.Fatalf("expected 8 bytes, got %d", rb.Len())
+		}
+		if len(rb.buffer) > 8 {
+			t.Fatalf("expected buffer to be capped at 8 bytes, got %d", len(rb.buffer))
+		}
+	})
+
+	t.Run("sticky error", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(4)
+		x := rb.CopyString("abc").Uint16(1, true).Byte('d').PrependByte('e').Uvarint(1)
+		if x != rb {
+			t.Fatal("expected chain to return the buffer")
+		}
+		if rb.Err() != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", rb.Err())
+		}
+		if string(rb.Bytes()) != "abc" {
+			t.Fatalf("expected writes after the error to be ignored, got %q", rb.Bytes())
+		}
+		if _, err := rb.Write([]byte("x")); err != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge from Write, got %v", err)
+		}
+	})
+
+	t.Run("prepend", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(3).WithHeadroom(2)
+		rb.CopyString("ab").PrependString("cd")
+		if rb.Err() != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", rb.Err())
+		}
+		if string(rb.Bytes()) != "ab" {
+			t.Fatalf("expected ab, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("reset clears error", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(1)
+		rb.CopyString("ab")
+		rb.Reset(false)
+		if rb.Err() != nil {
+			t.Fatalf("expected nil error, got %v", rb.Err())
+		}
+		rb.Byte(1)
+		if rb.Err() != nil || rb.Len() != 1 {
+			t.Fatalf("expected write to succeed, got %v", rb.Err())
+		}
+	})
+
+	t.Run("read into is limited", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(3)
+		chunk, err := rb.ReadInto(stringReader{s: "hello"}, 100)
+		if err != nil || string(chunk) != "hel" {
+			t.Fatalf("expected hel, nil, got %q, %v", chunk, err)
+		}
+		if _, err := rb.ReadInto(stringReader{s: "hello"}, 100); err != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", err)
+		}
+	})
+
+	t.Run("read from", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(1000)
+		n, err := rb.ReadFrom(bytes.NewReader(make([]byte, 1000)))
+		if err != nil || n != 1000 {
+			t.Fatalf("expected 1000, nil, got %d, %v", n, err)
+		}
+
+		rb = NewResizableBuffer(nil).WithMaxSize(1000)
+		n, err = rb.ReadFrom(bytes.NewReader(make([]byte, 1001)))
+		if err != ErrTooLarge || n != 1000 {
+			t.Fatalf("expected 1000, ErrTooLarge, got %d, %v", n, err)
+		}
+	})
+
+	t.Run("sub buffer", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(4)
+		sub := rb.SubBuffer(2)
+		if sub.Err() != nil || rb.Len() != 2 {
+			t.Fatalf("expected sub buffer to fit, got %v", sub.Err())
+		}
+		sub = rb.SubBuffer(3)
+		if sub.Err() != ErrTooLarge || rb.Err() != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v and %v", sub.Err(), rb.Err())
+		}
+		if sub.CopyString("abc").Len() != 0 {
+			t.Fatal("expected writes to the failed sub buffer to be ignored")
+		}
+	})
+
+	t.Run("placeholder", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(2)
+		p := rb.ReserveUint32(true)
+		p.SetLength()
+		if rb.Err() != ErrTooLarge || rb.Len() != 0 {
+			t.Fatalf("expected ErrTooLarge and no data, got %v and %d bytes", rb.Err(), rb.Len())
+		}
+	})
+}
+
+// trackArrays runs each operation on the buffer and returns every backing array the buffer
+// used along the way, including the current one.
+func trackArrays(rb *ResizableBuffer, ops ...func(rb *ResizableBuffer)) [][]byte {
+	arrays := [][]byte{rb.buffer[:cap(rb.buffer)]}
+	for _, op := range ops {
+		op(rb)
+		last := arrays[len(arrays)-1]
+		if cap(rb.buffer) != cap(last) || (cap(last) != 0 && &rb.buffer[:cap(rb.buffer)][0] != &last[0]) {
+			arrays = append(arrays, rb.buffer[:cap(rb.buffer)])
+		}
+	}
+	return arrays
+}
+
+func containsSecret(arrays [][]byte, secret []byte) bool {
+	for _, a := range arrays {
+		if bytes.Contains(a, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestWithSecureWipe(t *testing.T) {
+	secret := []byte("hunter2hunter2")
+	ops := []func(rb *ResizableBuffer){
+		func(rb *ResizableBuffer) { rb.CopyBytes(secret) },
+		func(rb *ResizableBuffer) { rb.CopyBytes(make([]byte, 100)) },
+		func(rb *ResizableBuffer) { rb.PrependBytes(make([]byte, 300)) },
+		func(rb *ResizableBuffer) { rb.PrependBytes(secret) },
+		func(rb *ResizableBuffer) { rb.CopyBytes(make([]byte, 1000)) },
+		func(rb *ResizableBuffer) { rb.PrependBytes(make([]byte, 2000)) },
+	}
+
+	t.Run("old arrays retain data without secure mode", func(t *testing.T) {
+		rb := NewResizableBuffer(nil)
+		arrays := trackArrays(rb, ops...)
+		if len(arrays) < 3 {
+			t.Fatalf("expected the buffer to be reallocated, got %d arrays", len(arrays))
+		}
+		if !containsSecret(arrays[:len(arrays)-1], secret) {
+			t.Fatal("expected old arrays to still contain the secret")
+		}
+	})
+
+	t.Run("old arrays are wiped", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithSecureWipe()
+		arrays := trackArrays(rb, ops...)
+		if containsSecret(arrays[:len(arrays)-1], secret) {
+			t.Fatal("expected old arrays to be wiped")
+		}
+		if bytes.Count(arrays[len(arrays)-1], secret) != 2 {
+			t.Fatal("expected the current array to hold the secret twice")
+		}
+		rb.Destroy()
+		if containsSecret(arrays, secret) {
+			t.Fatal("expected Destroy to wipe the current array")
+		}
+	})
+
+	t.Run("in place moves are wiped", func(t *testing.T) {
+		moves := []func(rb *ResizableBuffer){
+			func(rb *ResizableBuffer) { rb.PrependBytes(secret) },
+			func(rb *ResizableBuffer) { rb.PrependBytes(make([]byte, 30)) },
+			func(rb *ResizableBuffer) { rb.PrependBytes(make([]byte, 10)) },
+		}
+
+		rb := NewResizableBuffer(make([]byte, 1000)).WithHeadroom(50)
+		arrays := trackArrays(rb, moves...)
+		if len(arrays) != 1 {
+			t.Fatal("expected the buffer not to be reallocated")
+		}
+		if bytes.Count(arrays[0], secret) != 2 {
+			t.Fatal("expected the moved secret to be left behind without secure mode")
+		}
+
+		rb = NewResizableBuffer(make([]byte, 1000)).WithHeadroom(50).WithSecureWipe()
+		arrays = trackArrays(rb, moves...)
+		if len(arrays) != 1 {
+			t.Fatal("expected the buffer not to be reallocated")
+		}
+		if bytes.Count(arrays[0], secret) != 1 {
+			t.Fatal("expected only the current copy of the secret to remain")
+		}
+	})
+
+	t.Run("reset always wipes", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithSecureWipe()
+		arrays := trackArrays(rb,
+			func(rb *ResizableBuffer) { rb.CopyBytes(secret) },
+			func(rb *ResizableBuffer) { rb.Reset(false) },
+		)
+		if containsSecret(arrays, secret) {
+			t.Fatal("expected Reset to wipe the secret")
+		}
+	})
+
+	t.Run("drained bytes are wiped", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithSecureWipe()
+		arrays := trackArrays(rb,
+			func(rb *ResizableBuffer) { rb.CopyBytes(secret).CopyString("tail") },
+			func(rb *ResizableBuffer) { rb.WriteTo(&limitedWriter{limit: len(secret)}) },
+		)
+		if containsSecret(arrays, secret) {
+			t.Fatal("expected drained bytes to be wiped")
+		}
+		if string(rb.Bytes()) != "tail" {
+			t.Fatalf("expected tail to be kept, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("destroy without secure mode", func(t *testing.T) {
+		buffer := make([]byte, 100)
+		rb := NewResizableBuffer(buffer).CopyBytes(secret)
+		rb.Destroy()
+		if bytes.Contains(buffer, secret) {
+			t.Fatal("expected Destroy to wipe the buffer")
+		}
+		if rb.Len() != 0 {
+			t.Fatalf("expected 0 bytes, got %d", rb.Len())
+		}
+		rb.CopyString("ok")
+		if string(rb.Bytes()) != "ok" {
+			t.Fatalf("expected buffer to be usable, got %q", rb.Bytes())
+		}
+	})
+
+	t.Run("destroy clears the error", func(t *testing.T) {
+		rb := NewResizableBuffer(nil).WithMaxSize(4).CopyBytes(secret)
+		if rb.Err() != ErrTooLarge {
+			t.Fatalf("expected ErrTooLarge, got %v", rb.Err())
+		}
+		rb.Destroy()
+		if rb.Err() != nil {
+			t.Fatalf("expected no error, got %v", rb.Err())
+		}
+		rb.CopyString("ok")
+		if string(rb.Bytes()) != "ok" {
+			t.Fatalf("expected buffer to be usable, got %q", rb.Bytes())
+		}
+	})
+}
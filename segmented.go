@@ -0,0 +1,407 @@
+package safebuffer
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"net"
+)
+
+// DefaultChunkSize is the chunk size used by NewSegmentedBuffer when none is given.
+const DefaultChunkSize = 4096
+
+// SegmentedBuffer is a buffer made of fixed size chunks. It has the same write methods as
+// ResizableBuffer, but when it runs out of room it adds a chunk instead of copying everything
+// into a bigger array, so written data is never moved. This makes it a better fit for large
+// buffers that are written out with a single vectored write. This is single threaded.
+type SegmentedBuffer struct {
+	chunkSize int
+	chunks    [][]byte
+	length    int
+
+	// head is the array behind chunks[0] if it was made for a prepend. Prepends fill it from
+	// the back, and headFree is how much of the front of it is left.
+	head     []byte
+	headFree int
+
+	// free holds chunks that can be reused after a reset.
+	free [][]byte
+}
+
+// NewSegmentedBuffer creates a new SegmentedBuffer. If chunkSize is 0 or less,
+// DefaultChunkSize is used.
+func NewSegmentedBuffer(chunkSize int) *SegmentedBuffer {
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+	return &SegmentedBuffer{chunkSize: chunkSize}
+}
+
+func (b *SegmentedBuffer) newChunk() []byte {
+	if b.chunkSize <= 0 {
+		b.chunkSize = DefaultChunkSize
+	}
+	if n := len(b.free); n > 0 {
+		c := b.free[n-1]
+		b.free = b.free[:n-1]
+		return c
+	}
+	return make([]byte, 0, b.chunkSize)
+}
+
+// tail returns the index of the last chunk, adding one if it is full.
+func (b *SegmentedBuffer) tail() int {
+	last := len(b.chunks) - 1
+	if last < 0 || len(b.chunks[last]) == cap(b.chunks[last]) {
+		b.chunks = append(b.chunks, b.newChunk())
+		last++
+	}
+	return last
+}
+
+// CopyBytes copies the bytes specified into the buffer.
+func (b *SegmentedBuffer) CopyBytes(p []byte) *SegmentedBuffer {
+	b.length += len(p)
+	for len(p) > 0 {
+		last := b.tail()
+		c := b.chunks[last]
+		n := min(cap(c)-len(c), len(p))
+		b.chunks[last] = append(c, p[:n]...)
+		p = p[n:]
+	}
+	return b
+}
+
+// CopyString copies the string specified into the buffer.
+func (b *SegmentedBuffer) CopyString(p string) *SegmentedBuffer {
+	b.length += len(p)
+	for len(p) > 0 {
+		last := b.tail()
+		c := b.chunks[last]
+		n := min(cap(c)-len(c), len(p))
+		b.chunks[last] = append(c, p[:n]...)
+		p = p[n:]
+	}
+	return b
+}
+
+// appendFixed writes n bytes using f. If they do not fit in the last chunk, they are split
+// across chunks.
+func (b *SegmentedBuffer) appendFixed(n int, f func(b []byte)) *SegmentedBuffer {
+	if last := len(b.chunks) - 1; last >= 0 {
+		c := b.chunks[last]
+		if cap(c)-len(c) >= n {
+			c = c[:len(c)+n]
+			f(c[len(c)-n:])
+			b.chunks[last] = c
+			b.length += n
+			return b
+		}
+	}
+	var scratch [binary.MaxVarintLen64]byte
+	f(scratch[:n])
+	return b.CopyBytes(scratch[:n])
+}
+
+// Byte writes a single byte into the buffer.
+func (b *SegmentedBuffer) Byte(bt byte) *SegmentedBuffer {
+	return b.appendFixed(1, func(b []byte) {
+		b[0] = bt
+	})
+}
+
+// CRLF writes a CRLF into the buffer.
+func (b *SegmentedBuffer) CRLF() *SegmentedBuffer {
+	return b.appendFixed(2, func(b []byte) {
+		b[0] = '\r'
+		b[1] = '\n'
+	})
+}
+
+// Uint16 writes a uint16 into the buffer.
+func (b *SegmentedBuffer) Uint16(v uint16, littleEndian bool) *SegmentedBuffer {
+	return b.appendFixed(2, func(b []byte) {
+		if littleEndian {
+			binary.LittleEndian.PutUint16(b, v)
+		} else {
+			binary.BigEndian.PutUint16(b, v)
+		}
+	})
+}
+
+// Uint32 writes a uint32 into the buffer.
+func (b *SegmentedBuffer) Uint32(v uint32, littleEndian bool) *SegmentedBuffer {
+	return b.appendFixed(4, func(b []byte) {
+		if littleEndian {
+			binary.LittleEndian.PutUint32(b, v)
+		} else {
+			binary.BigEndian.PutUint32(b, v)
+		}
+	})
+}
+
+// Uint64 writes a uint64 into the buffer.
+func (b *SegmentedBuffer) Uint64(v uint64, littleEndian bool) *SegmentedBuffer {
+	return b.appendFixed(8, func(b []byte) {
+		if littleEndian {
+			binary.LittleEndian.PutUint64(b, v)
+		} else {
+			binary.BigEndian.PutUint64(b, v)
+		}
+	})
+}
+
+// Int16 writes a int16 into the buffer.
+func (b *SegmentedBuffer) Int16(v int16, littleEndian bool) *SegmentedBuffer {
+	return b.Uint16(uint16(v), littleEndian)
+}
+
+// Int32 writes a int32 into the buffer.
+func (b *SegmentedBuffer) Int32(v int32, littleEndian bool) *SegmentedBuffer {
+	return b.Uint32(uint32(v), littleEndian)
+}
+
+// Int64 writes a int64 into the buffer.
+func (b *SegmentedBuffer) Int64(v int64, littleEndian bool) *SegmentedBuffer {
+	return b.Uint64(uint64(v), littleEndian)
+}
+
+// Float32 writes a float32 into the buffer.
+func (b *SegmentedBuffer) Float32(v float32, littleEndian bool) *SegmentedBuffer {
+	return b.Uint32(math.Float32bits(v), littleEndian)
+}
+
+// Float64 writes a float64 into the buffer.
+func (b *SegmentedBuffer) Float64(v float64, littleEndian bool) *SegmentedBuffer {
+	return b.Uint64(math.Float64bits(v), littleEndian)
+}
+
+// Uvarint writes a uint64 as a variable length integer into the buffer.
+func (b *SegmentedBuffer) Uvarint(v uint64) *SegmentedBuffer {
+	return b.appendFixed(UvarintSize(v), func(b []byte) {
+		binary.PutUvarint(b, v)
+	})
+}
+
+// Varint writes a int64 as a zigzag encoded variable length integer into the buffer.
+func (b *SegmentedBuffer) Varint(v int64) *SegmentedBuffer {
+	return b.Uvarint(zigzag(v))
+}
+
+// newHead adds an empty chunk to the front of the buffer for prepends to fill from the back.
+func (b *SegmentedBuffer) newHead() {
+	c := b.newChunk()
+	b.head = c[:cap(c)]
+	b.headFree = cap(c)
+	b.chunks = append([][]byte{b.head[cap(c):]}, b.chunks...)
+}
+
+// PrependBytes prepends a byte slice into the buffer.
+func (b *SegmentedBuffer) PrependBytes(p []byte) *SegmentedBuffer {
+	b.length += len(p)
+	for len(p) > 0 {
+		if b.headFree == 0 {
+			b.newHead()
+		}
+		n := min(b.headFree, len(p))
+		b.headFree -= n
+		copy(b.head[b.headFree:], p[len(p)-n:])
+		b.chunks[0] = b.head[b.headFree : b.headFree+len(b.chunks[0])+n]
+		p = p[:len(p)-n]
+	}
+	return b
+}
+
+// PrependString prepends a string into the buffer.
+func (b *SegmentedBuffer) PrependString(p string) *SegmentedBuffer {
+	b.length += len(p)
+	for len(p) > 0 {
+		if b.headFree == 0 {
+			b.newHead()
+		}
+		n := min(b.headFree, len(p))
+		b.headFree -= n
+		copy(b.head[b.headFree:], p[len(p)-n:])
+		b.chunks[0] = b.head[b.headFree : b.headFree+len(b.chunks[0])+n]
+		p = p[:len(p)-n]
+	}
+	return b
+}
+
+// prependFixed prepends n bytes written by f.
+func (b *SegmentedBuffer) prependFixed(n int, f func(b []byte)) *SegmentedBuffer {
+	var scratch [binary.MaxVarintLen64]byte
+	f(scratch[:n])
+	return b.PrependBytes(scratch[:n])
+}
+
+// PrependByte prepends a byte into the buffer.
+func (b *SegmentedBuffer) PrependByte(v byte) *SegmentedBuffer {
+	return b.prependFixed(1, func(b []byte) {
+		b[0] = v
+	})
+}
+
+// PrependUint16 prepends a uint16 into the buffer.
+func (b *SegmentedBuffer) PrependUint16(v uint16, littleEndian bool) *SegmentedBuffer {
+	return b.prependFixed(2, func(b []byte) {
+		if littleEndian {
+			binary.LittleEndian.PutUint16(b, v)
+		} else {
+			binary.BigEndian.PutUint16(b, v)
+		}
+	})
+}
+
+// PrependUint32 prepends a uint32 into the buffer.
+func (b *SegmentedBuffer) PrependUint32(v uint32, littleEndian bool) *SegmentedBuffer {
+	return b.prependFixed(4, func(b []byte) {
+		if littleEndian {
+			binary.LittleEndian.PutUint32(b, v)
+		} else {
+			binary.BigEndian.PutUint32(b, v)
+		}
+	})
+}
+
+// PrependUint64 prepends a uint64 into the buffer.
+func (b *SegmentedBuffer) PrependUint64(v uint64, littleEndian bool) *SegmentedBuffer {
+	return b.prependFixed(8, func(b []byte) {
+		if littleEndian {
+			binary.LittleEndian.PutUint64(b, v)
+		} else {
+			binary.BigEndian.PutUint64(b, v)
+		}
+	})
+}
+
+// PrependInt16 prepends a int16 into the buffer.
+func (b *SegmentedBuffer) PrependInt16(v int16, littleEndian bool) *SegmentedBuffer {
+	return b.PrependUint16(uint16(v), littleEndian)
+}
+
+// PrependInt32 prepends a int32 into the buffer.
+func (b *SegmentedBuffer) PrependInt32(v int32, littleEndian bool) *SegmentedBuffer {
+	return b.PrependUint32(uint32(v), littleEndian)
+}
+
+// PrependInt64 prepends a int64 into the buffer.
+func (b *SegmentedBuffer) PrependInt64(v int64, littleEndian bool) *SegmentedBuffer {
+	return b.PrependUint64(uint64(v), littleEndian)
+}
+
+// PrependFloat32 prepends a float32 into the buffer.
+func (b *SegmentedBuffer) PrependFloat32(v float32, littleEndian bool) *SegmentedBuffer {
+	return b.PrependUint32(math.Float32bits(v), littleEndian)
+}
+
+// PrependFloat64 prepends a float64 into the buffer.
+func (b *SegmentedBuffer) PrependFloat64(v float64, littleEndian bool) *SegmentedBuffer {
+	return b.PrependUint64(math.Float64bits(v), littleEndian)
+}
+
+// PrependUvarint prepends a uint64 as a variable length integer into the buffer.
+func (b *SegmentedBuffer) PrependUvarint(v uint64) *SegmentedBuffer {
+	return b.prependFixed(UvarintSize(v), func(b []byte) {
+		binary.PutUvarint(b, v)
+	})
+}
+
+// PrependVarint prepends a int64 as a zigzag encoded variable length integer into the buffer.
+func (b *SegmentedBuffer) PrependVarint(v int64) *SegmentedBuffer {
+	return b.PrependUvarint(zigzag(v))
+}
+
+// Len returns the number of bytes in the buffer.
+func (b *SegmentedBuffer) Len() int {
+	return b.length
+}
+
+// Reset empties the buffer so it can be reused. The chunks are kept for later writes. Can
+// optionally zero out the data we wrote to prevent information leaks.
+func (b *SegmentedBuffer) Reset(zeroOut bool) *SegmentedBuffer {
+	for _, c := range b.chunks {
+		if zeroOut {
+			clear(c)
+		}
+		// Only chunks that still start at the beginning of their array can be reused.
+		if cap(c) == b.chunkSize {
+			b.free = append(b.free, c[:0])
+		}
+	}
+	clear(b.chunks)
+	b.chunks = b.chunks[:0]
+	b.head = nil
+	b.headFree = 0
+	b.length = 0
+	return b
+}
+
+// Buffers returns the chunks of the buffer as net.Buffers, so they can be written with a single
+// vectored write. The chunks are not copied, so they are only valid until the next call to Reset.
+func (b *SegmentedBuffer) Buffers() net.Buffers {
+	bufs := make(net.Buffers, 0, len(b.chunks))
+	for _, c := range b.chunks {
+		if len(c) != 0 {
+			bufs = append(bufs, c)
+		}
+	}
+	return bufs
+}
+
+// WriteTo implements io.WriterTo. It writes the buffer to w, using a vectored write if w
+// supports it, and drains whatever was written. If w only accepts part of the data, the rest
+// is kept in the buffer.
+func (b *SegmentedBuffer) WriteTo(w io.Writer) (int64, error) {
+	bufs := b.Buffers()
+	n, err := bufs.WriteTo(w)
+	if int(n) == b.length {
+		b.Reset(false)
+		return n, err
+	}
+	b.discard(int(n))
+	if err == nil {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
+
+// discard drops the first n bytes of the buffer.
+func (b *SegmentedBuffer) discard(n int) {
+	b.length -= n
+	for n > 0 {
+		c := b.chunks[0]
+		if n < len(c) {
+			b.chunks[0] = c[n:]
+			if b.head != nil {
+				b.headFree += n
+			}
+			return
+		}
+		n -= len(c)
+		b.chunks = b.chunks[1:]
+		b.head = nil
+		b.headFree = 0
+	}
+}
+
+// Bytes flattens the buffer into a newly allocated slice.
+func (b *SegmentedBuffer) Bytes() []byte {
+	s := make([]byte, 0, b.length)
+	for _, c := range b.chunks {
+		s = append(s, c...)
+	}
+	return s
+}
+
+// FlattenInto copies the buffer into the end of the ResizableBuffer given, such as one from
+// a BufferPool, and returns it.
+func (b *SegmentedBuffer) FlattenInto(rb *ResizableBuffer) *ResizableBuffer {
+	if !rb.ensureCapacity(b.length) {
+		return rb
+	}
+	for _, c := range b.chunks {
+		rb.CopyBytes(c)
+	}
+	return rb
+}
@@ -0,0 +1,176 @@
+package safebuffer
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// writeBoth runs the same writes against a ResizableBuffer and a SegmentedBuffer.
+type writeBoth struct {
+	rb *ResizableBuffer
+	sb *SegmentedBuffer
+}
+
+func TestSegmentedBufferMatchesResizableBuffer(t *testing.T) {
+	ops := []struct {
+		name string
+		fn   func(w writeBoth)
+	}{
+		{"bytes", func(w writeBoth) { w.rb.CopyBytes([]byte{1, 2, 3, 4, 5}); w.sb.CopyBytes([]byte{1, 2, 3, 4, 5}) }},
+		{"string", func(w writeBoth) { w.rb.CopyString("hello world"); w.sb.CopyString("hello world") }},
+		{"byte", func(w writeBoth) { w.rb.Byte(9); w.sb.Byte(9) }},
+		{"crlf", func(w writeBoth) { w.rb.CRLF(); w.sb.CRLF() }},
+		{"uint16", func(w writeBoth) { w.rb.Uint16(0x0102, true); w.sb.Uint16(0x0102, true) }},
+		{"uint32", func(w writeBoth) { w.rb.Uint32(0x01020304, false); w.sb.Uint32(0x01020304, false) }},
+		{"uint64", func(w writeBoth) { w.rb.Uint64(1<<60+5, true); w.sb.Uint64(1<<60+5, true) }},
+		{"int16", func(w writeBoth) { w.rb.Int16(-5, false); w.sb.Int16(-5, false) }},
+		{"int32", func(w writeBoth) { w.rb.Int32(-5, true); w.sb.Int32(-5, true) }},
+		{"int64", func(w writeBoth) { w.rb.Int64(-5, false); w.sb.Int64(-5, false) }},
+		{"float32", func(w writeBoth) { w.rb.Float32(1.5, true); w.sb.Float32(1.5, true) }},
+		{"float64", func(w writeBoth) { w.rb.Float64(1.5, false); w.sb.Float64(1.5, false) }},
+		{"uvarint", func(w writeBoth) { w.rb.Uvarint(1 << 50); w.sb.Uvarint(1 << 50) }},
+		{"varint", func(w writeBoth) { w.rb.Varint(-300); w.sb.Varint(-300) }},
+		{"prepend bytes", func(w writeBoth) { w.rb.PrependBytes([]byte{7, 8, 9, 10}); w.sb.PrependBytes([]byte{7, 8, 9, 10}) }},
+		{"prepend string", func(w writeBoth) { w.rb.PrependString("header:"); w.sb.PrependString("header:") }},
+		{"prepend byte", func(w writeBoth) { w.rb.PrependByte(3); w.sb.PrependByte(3) }},
+		{"prepend uint16", func(w writeBoth) { w.rb.PrependUint16(0x0102, false); w.sb.PrependUint16(0x0102, false) }},
+		{"prepend uint32", func(w writeBoth) { w.rb.PrependUint32(0x01020304, true); w.sb.PrependUint32(0x01020304, true) }},
+		{"prepend uint64", func(w writeBoth) { w.rb.PrependUint64(12345, false); w.sb.PrependUint64(12345, false) }},
+		{"prepend int16", func(w writeBoth) { w.rb.PrependInt16(-1, true); w.sb.PrependInt16(-1, true) }},
+		{"prepend int32", func(w writeBoth) { w.rb.PrependInt32(-1, false); w.sb.PrependInt32(-1, false) }},
+		{"prepend int64", func(w writeBoth) { w.rb.PrependInt64(-1, true); w.sb.PrependInt64(-1, true) }},
+		{"prepend float32", func(w writeBoth) { w.rb.PrependFloat32(2.5, false); w.sb.PrependFloat32(2.5, false) }},
+		{"prepend float64", func(w writeBoth) { w.rb.PrependFloat64(2.5, true); w.sb.PrependFloat64(2.5, true) }},
+		{"prepend uvarint", func(w writeBoth) { w.rb.PrependUvarint(300); w.sb.PrependUvarint(300) }},
+		{"prepend varint", func(w writeBoth) { w.rb.PrependVarint(-300); w.sb.PrependVarint(-300) }},
+	}
+
+	for _, chunkSize := range []int{1, 3, 7, 4096} {
+		w := writeBoth{rb: NewResizableBuffer(nil), sb: NewSegmentedBuffer(chunkSize)}
+		for _, op := range ops {
+			op.fn(w)
+			if w.sb.Len() != w.rb.Len() {
+				t.Fatalf("chunk size %d, %s: expected length %d, got %d", chunkSize, op.name, w.rb.Len(), w.sb.Len())
+			}
+			if !bytes.Equal(w.sb.Bytes(), w.rb.Bytes()) {
+				t.Fatalf("chunk size %d, %s: expected %v, got %v", chunkSize, op.name, w.rb.Bytes(), w.sb.Bytes())
+			}
+		}
+	}
+}
+
+func TestSegmentedBufferNeverMovesData(t *testing.T) {
+	sb := NewSegmentedBuffer(8)
+	sb.CopyString("abcdefgh")
+	first := &sb.chunks[0][0]
+	sb.CopyBytes(make([]byte, 100)).PrependString("0123456789")
+	if &sb.chunks[len(sb.chunks)-14][0] != first {
+		t.Fatal("expected the first chunk to be kept where it was")
+	}
+	for _, c := range sb.chunks {
+		if cap(c) > 8 {
+			t.Fatalf("expected chunks to be at most 8 bytes, got %d", cap(c))
+		}
+	}
+}
+
+func TestSegmentedBufferBuffers(t *testing.T) {
+	sb := NewSegmentedBuffer(4)
+	sb.CopyString("hello world").PrependString(">>")
+	bufs := sb.Buffers()
+	if len(bufs) != 4 {
+		t.Fatalf("expected 4 buffers, got %d", len(bufs))
+	}
+	var out bytes.Buffer
+	if _, err := bufs.WriteTo(&out); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if out.String() != ">>hello world" {
+		t.Fatalf("expected >>hello world, got %q", out.String())
+	}
+	if sb.Len() != 13 {
+		t.Fatal("expected Buffers not to drain the buffer")
+	}
+}
+
+// failingWriter accepts up to limit bytes and then fails.
+type failingWriter struct {
+	bytes.Buffer
+	limit int
+	err   error
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if left := w.limit - w.Len(); len(p) > left {
+		w.Buffer.Write(p[:left])
+		return left, w.err
+	}
+	return w.Buffer.Write(p)
+}
+
+func TestSegmentedBufferWriteTo(t *testing.T) {
+	t.Run("drains", func(t *testing.T) {
+		sb := NewSegmentedBuffer(4).CopyString("hello world")
+		var out bytes.Buffer
+		n, err := sb.WriteTo(&out)
+		if err != nil || n != 11 {
+			t.Fatalf("expected 11, nil, got %d, %v", n, err)
+		}
+		if out.String() != "hello world" || sb.Len() != 0 {
+			t.Fatalf("expected buffer to be drained, got %q and %d bytes left", out.String(), sb.Len())
+		}
+	})
+
+	t.Run("short write", func(t *testing.T) {
+		sb := NewSegmentedBuffer(4).CopyString("hello world").PrependString("ab")
+		w := &failingWriter{limit: 3, err: errors.New("test error")}
+		n, err := sb.WriteTo(w)
+		if err != w.err || n != 3 {
+			t.Fatalf("expected 3, test error, got %d, %v", n, err)
+		}
+		if string(sb.Bytes()) != "ello world" || sb.Len() != 10 {
+			t.Fatalf("expected ello world to be kept, got %q", sb.Bytes())
+		}
+		sb.PrependString("xyz")
+		if string(sb.Bytes()) != "xyzello world" {
+			t.Fatalf("expected xyzello world, got %q", sb.Bytes())
+		}
+	})
+}
+
+func TestSegmentedBufferReset(t *testing.T) {
+	sb := NewSegmentedBuffer(4).CopyString("secret!!")
+	first, second := sb.chunks[0], sb.chunks[1]
+	sb.Reset(true)
+	if sb.Len() != 0 || len(sb.Buffers()) != 0 {
+		t.Fatal("expected buffer to be empty")
+	}
+	if !bytes.Equal(first, make([]byte, 4)) || !bytes.Equal(second, make([]byte, 4)) {
+		t.Fatal("expected chunks to be zeroed")
+	}
+	sb.CopyString("abcdef")
+	if &sb.chunks[0][0] != &second[0] || &sb.chunks[1][0] != &first[0] {
+		t.Fatal("expected chunks to be reused")
+	}
+	if string(sb.Bytes()) != "abcdef" {
+		t.Fatalf("expected abcdef, got %q", sb.Bytes())
+	}
+}
+
+func TestSegmentedBufferFlattenInto(t *testing.T) {
+	sb := NewSegmentedBuffer(3).CopyString("hello").PrependString("<")
+	pool := NewBufferPool(false, 64)
+	rb := sb.FlattenInto(pool.Get(sb.Len()))
+	if string(rb.Bytes()) != "<hello" {
+		t.Fatalf("expected <hello, got %q", rb.Bytes())
+	}
+}
+
+func TestSegmentedBufferZeroValue(t *testing.T) {
+	var sb SegmentedBuffer
+	sb.CopyString("hi").PrependByte('>')
+	if string(sb.Bytes()) != ">hi" {
+		t.Fatalf("expected >hi, got %q", sb.Bytes())
+	}
+}
@@ -0,0 +1,262 @@
+package wal
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// Log appends records to the segments in a directory. Records are held in a buffer until
+// Sync, which writes them out and flushes them to disk. Once the segment being written would
+// go past the segment size, the log moves on to a new one. If writing to a segment fails, the
+// log cannot be used any further, since what reached the disk is unknown. This is single
+// threaded.
+type Log struct {
+	dir         string
+	segmentSize int64
+	truncated   int64
+
+	// file is the segment being written, which holds size bytes.
+	file  *os.File
+	index uint64
+	size  int64
+
+	buf *safebuffer.ResizableBuffer
+
+	// open is true between Begin and End, with mark and header set to where the record starts.
+	open   bool
+	mark   safebuffer.Mark
+	header safebuffer.Placeholder
+
+	err error
+}
+
+// Open opens the log in dir, creating the directory and the first segment if needed. New
+// segments are started once the current one would go past segmentSize bytes, or
+// DefaultSegmentSize if it is 0 or less. A record larger than the segment size gets a segment
+// to itself.
+//
+// The last segment is scanned, and if it ends with a record that is incomplete or fails its
+// checksum, it is cut off there. Truncated reports how many bytes were removed.
+func Open(dir string, segmentSize int64) (*Log, error) {
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	indexes, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+	l := &Log{dir: dir, segmentSize: segmentSize, buf: safebuffer.NewResizableBuffer(nil)}
+	if len(indexes) == 0 {
+		if err := l.create(1); err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+
+	l.index = indexes[len(indexes)-1]
+	l.file, err = os.OpenFile(segmentPath(dir, l.index), os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.recover(); err != nil {
+		l.file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// recover scans the segment being written and cuts off anything after the last whole record.
+func (l *Log) recover() error {
+	total, err := l.buf.ReadFrom(l.file)
+	if err != nil {
+		return err
+	}
+	data := l.buf.Bytes()
+	for {
+		_, n, ok := parse(data[l.size:])
+		if !ok {
+			break
+		}
+		l.size += int64(n)
+	}
+	l.buf.Reset(false)
+
+	if l.size != total {
+		l.truncated = total - l.size
+		if err := l.file.Truncate(l.size); err != nil {
+			return err
+		}
+		if err := l.file.Sync(); err != nil {
+			return err
+		}
+	}
+	_, err = l.file.Seek(l.size, io.SeekStart)
+	return err
+}
+
+// create starts a new segment with the index given.
+func (l *Log) create(index uint64) error {
+	f, err := os.OpenFile(segmentPath(l.dir, index), os.O_RDWR|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	l.file = f
+	l.index = index
+	l.size = 0
+	syncDir(l.dir)
+	return nil
+}
+
+// syncDir flushes the directory so that a new segment is not lost in a crash. Not every
+// platform can do this, so failures are ignored.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
+
+// Truncated returns the number of bytes cut off the end of the last segment when the log was
+// opened.
+func (l *Log) Truncated() int64 {
+	return l.truncated
+}
+
+// Buffered returns the number of bytes waiting to be written by Sync.
+func (l *Log) Buffered() int {
+	return l.buf.Len()
+}
+
+// Begin starts a record and returns the buffer to assemble its payload in. Call End once the
+// payload is written.
+func (l *Log) Begin() *safebuffer.ResizableBuffer {
+	if l.open {
+		panic("wal: Begin called while a record is already open")
+	}
+	l.open = true
+	l.mark = l.buf.Mark()
+	l.header = l.buf.Reserve(headerSize)
+	return l.buf
+}
+
+// End fills in the length and checksum of the record started with Begin. If the buffer holds
+// an error or the record cannot be written, the record is removed from the buffer and the
+// error is returned.
+func (l *Log) End() error {
+	if !l.open {
+		panic("wal: End called without a record to end")
+	}
+	l.open = false
+	err := l.err
+	if err == nil {
+		err = l.buf.Err()
+	}
+	n := l.header.BytesSince()
+	if err == nil && uint64(n) > math.MaxUint32 {
+		err = ErrRecordTooLarge
+	}
+	if err != nil {
+		l.buf.RollbackTo(l.mark, false)
+		return err
+	}
+
+	header := l.header.Bytes()
+	binary.LittleEndian.PutUint32(header, uint32(n))
+	payload := l.buf.Bytes()[l.header.Offset()+headerSize:]
+	binary.LittleEndian.PutUint32(header[4:], checksum(header[:4], payload))
+	l.buf.Commit(l.mark)
+
+	// Records never straddle segments, so if this one does not fit in the current segment,
+	// everything before it is written out and it goes in the next one.
+	start := l.header.Offset()
+	if l.size+int64(l.buf.Len()) > l.segmentSize && l.size+int64(start) > 0 {
+		if err := l.write(start); err != nil {
+			return err
+		}
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Append adds a record with the payload given.
+func (l *Log) Append(p []byte) error {
+	l.Begin().CopyBytes(p)
+	return l.End()
+}
+
+// write writes the first n bytes of the buffer to the segment.
+func (l *Log) write(n int) error {
+	if n == 0 {
+		return nil
+	}
+	written, err := l.file.Write(l.buf.Bytes()[:n])
+	l.size += int64(written)
+	if err != nil {
+		l.err = err
+		return err
+	}
+	if n == l.buf.Len() {
+		l.buf.Reset(false)
+	} else {
+		l.buf.DeleteRange(0, n)
+	}
+	return nil
+}
+
+// rotate seals the segment being written and starts the next one.
+func (l *Log) rotate() error {
+	if err := l.file.Sync(); err != nil {
+		l.err = err
+		return err
+	}
+	if err := l.file.Close(); err != nil {
+		l.err = err
+		return err
+	}
+	if err := l.create(l.index + 1); err != nil {
+		l.err = err
+		return err
+	}
+	return nil
+}
+
+// Sync writes the buffered records to the segment and flushes it to disk.
+func (l *Log) Sync() error {
+	if l.open {
+		panic("wal: Sync called while a record is open")
+	}
+	if l.err != nil {
+		return l.err
+	}
+	if err := l.write(l.buf.Len()); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		l.err = err
+		return err
+	}
+	return nil
+}
+
+// Close syncs the log and closes the segment being written.
+func (l *Log) Close() error {
+	if l.err == ErrClosed {
+		return ErrClosed
+	}
+	err := l.Sync()
+	if cerr := l.file.Close(); err == nil {
+		err = cerr
+	}
+	l.err = ErrClosed
+	l.buf.Reset(true)
+	return err
+}
@@ -0,0 +1,68 @@
+package wal
+
+import (
+	"io"
+	"os"
+
+	"github.com/iamjsd/safebuffer"
+)
+
+// Reader reads the records in a log from the first segment to the last. The segments are
+// listed when the reader is created, and each one is read into memory in turn. A record that
+// is cut short or fails its checksum at the end of the last segment is treated as the end of
+// the log, the same as Open does. This is single threaded.
+type Reader struct {
+	dir     string
+	indexes []uint64
+	next    int
+
+	buf *safebuffer.ResizableBuffer
+	off int
+}
+
+// NewReader creates a new Reader over the log in dir.
+func NewReader(dir string) (*Reader, error) {
+	indexes, err := segments(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Reader{dir: dir, indexes: indexes, buf: safebuffer.NewResizableBuffer(nil)}, nil
+}
+
+// Next returns the payload of the next record, as a view that is only valid until the next
+// call. io.EOF is returned once every record has been read, and ErrCorrupt if a record in a
+// segment before the last is damaged.
+func (r *Reader) Next() ([]byte, error) {
+	for r.off == r.buf.Len() {
+		if r.next == len(r.indexes) {
+			return nil, io.EOF
+		}
+		if err := r.load(r.indexes[r.next]); err != nil {
+			return nil, err
+		}
+		r.next++
+	}
+
+	payload, n, ok := parse(r.buf.Bytes()[r.off:])
+	if !ok {
+		if r.next == len(r.indexes) {
+			return nil, io.EOF
+		}
+		return nil, ErrCorrupt
+	}
+	r.off += n
+	return payload, nil
+}
+
+// load reads the segment with the index given into the buffer.
+func (r *Reader) load(index uint64) error {
+	f, err := os.Open(segmentPath(r.dir, index))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r.buf.Reset(false)
+	r.off = 0
+	_, err = r.buf.ReadFrom(f)
+	return err
+}
@@ -0,0 +1,95 @@
+// Package wal is an append-only write-ahead log made of numbered segment files. Each record
+// is written as its length and a CRC32C checksum followed by the payload, and records are
+// assembled in a safebuffer.ResizableBuffer until they are synced to disk. When a log is
+// opened, the last segment is scanned and anything after the last whole record is cut off,
+// so a crash part way through a write loses only the records that were not synced.
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrCorrupt is returned by Reader when a record in a segment before the last fails its
+	// checksum or runs past the end of the segment.
+	ErrCorrupt = errors.New("wal: corrupt record")
+
+	// ErrRecordTooLarge is returned when a record is longer than its length can describe.
+	ErrRecordTooLarge = errors.New("wal: record is too large")
+
+	// ErrClosed is returned when a Log is used after Close.
+	ErrClosed = errors.New("wal: log is closed")
+)
+
+// DefaultSegmentSize is the size segments are rotated at if Open is given 0.
+const DefaultSegmentSize = 64 << 20
+
+const (
+	// headerSize is the size of the length and checksum in front of each record.
+	headerSize = 8
+
+	segmentExt = ".wal"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// checksum returns the checksum of a record. It covers the length as well as the payload, so
+// a damaged length is caught too.
+func checksum(length, payload []byte) uint32 {
+	return crc32.Update(crc32.Checksum(length, castagnoli), castagnoli, payload)
+}
+
+// parse returns the payload of the record at the front of data and the size of the whole
+// record. ok is false if the record is cut short or fails its checksum.
+func parse(data []byte) (payload []byte, n int, ok bool) {
+	if len(data) < headerSize {
+		return nil, 0, false
+	}
+	length := binary.LittleEndian.Uint32(data)
+	if uint64(length) > uint64(len(data)-headerSize) {
+		return nil, 0, false
+	}
+	n = headerSize + int(length)
+	payload = data[headerSize:n]
+	if checksum(data[:4], payload) != binary.LittleEndian.Uint32(data[4:]) {
+		return nil, 0, false
+	}
+	return payload, n, true
+}
+
+// segmentName returns the file name of the segment with the index given.
+func segmentName(index uint64) string {
+	return fmt.Sprintf("%020d%s", index, segmentExt)
+}
+
+// segments returns the indexes of the segments in dir, in order. Other files are ignored.
+func segments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var indexes []uint64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), segmentExt)
+		if !ok || e.IsDir() {
+			continue
+		}
+		if index, err := strconv.ParseUint(name, 10, 64); err == nil {
+			indexes = append(indexes, index)
+		}
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	return indexes, nil
+}
+
+func segmentPath(dir string, index uint64) string {
+	return filepath.Join(dir, segmentName(index))
+}
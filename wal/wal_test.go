@@ -0,0 +1,317 @@
+package wal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func record(i int) []byte {
+	return []byte(fmt.Sprintf("record %d", i))
+}
+
+// readAll reads every record in dir.
+func readAll(t *testing.T, dir string) ([][]byte, error) {
+	t.Helper()
+	r, err := NewReader(dir)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	var out [][]byte
+	for {
+		p, err := r.Next()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, bytes.Clone(p))
+	}
+}
+
+func expectRecords(t *testing.T, dir string, n int) {
+	t.Helper()
+	records, err := readAll(t, dir)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(records) != n {
+		t.Fatalf("expected %d records, got %d", n, len(records))
+	}
+	for i, p := range records {
+		if !bytes.Equal(p, record(i)) {
+			t.Fatalf("record %d: expected %q, got %q", i, record(i), p)
+		}
+	}
+}
+
+// writeLog writes n records to a new log in a temporary directory.
+func writeLog(t *testing.T, n int, segmentSize int64) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "log")
+	l, err := Open(dir, segmentSize)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	for i := 0; i < n; i++ {
+		if err := l.Append(record(i)); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	return dir
+}
+
+func lastSegment(t *testing.T, dir string) string {
+	t.Helper()
+	indexes, err := segments(dir)
+	if err != nil || len(indexes) == 0 {
+		t.Fatalf("expected segments, got %v, %v", indexes, err)
+	}
+	return segmentPath(dir, indexes[len(indexes)-1])
+}
+
+func TestRecordFormat(t *testing.T) {
+	dir := writeLog(t, 1, 0)
+	data, err := os.ReadFile(filepath.Join(dir, "00000000000000000001.wal"))
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	payload := record(0)
+	expected := binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))
+	crc := crc32.Update(crc32.Checksum(expected, crc32.MakeTable(crc32.Castagnoli)), crc32.MakeTable(crc32.Castagnoli), payload)
+	expected = binary.LittleEndian.AppendUint32(expected, crc)
+	expected = append(expected, payload...)
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("expected %x, got %x", expected, data)
+	}
+}
+
+func TestAppendAndReopen(t *testing.T) {
+	dir := writeLog(t, 10, 0)
+	expectRecords(t, dir, 10)
+
+	l, err := Open(dir, 0)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if l.Truncated() != 0 {
+		t.Fatalf("expected nothing to be truncated, got %d", l.Truncated())
+	}
+	buf := l.Begin()
+	buf.CopyString("record ").CopyString("10")
+	if err := l.End(); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if l.Buffered() == 0 {
+		t.Fatal("expected the record to be buffered until Sync")
+	}
+	if err := l.Sync(); err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	expectRecords(t, dir, 11)
+	l.Close()
+
+	if err := l.Append(record(11)); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+	if err := l.Close(); err != ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestRotation(t *testing.T) {
+	// Each record is 16 or 17 bytes, so 3 fit in a segment.
+	dir := writeLog(t, 20, 52)
+	indexes, err := segments(dir)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if len(indexes) != 7 {
+		t.Fatalf("expected 7 segments, got %v", indexes)
+	}
+	for i, index := range indexes {
+		info, err := os.Stat(segmentPath(dir, index))
+		if err != nil || info.Size() > 52 {
+			t.Fatalf("segment %d: expected at most 52 bytes, got %v, %v", i, info.Size(), err)
+		}
+	}
+	expectRecords(t, dir, 20)
+
+	t.Run("record larger than a segment", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "log")
+		l, _ := Open(dir, 8)
+		l.Append(record(0))
+		l.Append(record(1))
+		l.Close()
+		indexes, _ := segments(dir)
+		if len(indexes) != 2 {
+			t.Fatalf("expected each record to get its own segment, got %v", indexes)
+		}
+		expectRecords(t, dir, 2)
+	})
+
+	t.Run("reopen continues the last segment", func(t *testing.T) {
+		l, err := Open(dir, 52)
+		if err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+		for i := 20; i < 25; i++ {
+			l.Append(record(i))
+		}
+		l.Close()
+		expectRecords(t, dir, 25)
+		if indexes, _ := segments(dir); len(indexes) != 9 {
+			t.Fatalf("expected 9 segments, got %v", indexes)
+		}
+	})
+}
+
+func TestTornTail(t *testing.T) {
+	last := len(record(4)) + headerSize
+	for cut := 1; cut < last; cut++ {
+		dir := writeLog(t, 5, 0)
+		path := lastSegment(t, dir)
+		info, _ := os.Stat(path)
+		whole := info.Size() - int64(last)
+		if err := os.Truncate(path, info.Size()-int64(cut)); err != nil {
+			t.Fatalf("expected nil error, got %v", err)
+		}
+
+		// The reader stops at the torn record before the log is recovered.
+		expectRecords(t, dir, 4)
+
+		l, err := Open(dir, 0)
+		if err != nil {
+			t.Fatalf("cut %d: expected nil error, got %v", cut, err)
+		}
+		if l.Truncated() != int64(last-cut) {
+			t.Fatalf("cut %d: expected %d bytes to be truncated, got %d", cut, last-cut, l.Truncated())
+		}
+		if info, _ := os.Stat(path); info.Size() != whole {
+			t.Fatalf("cut %d: expected the segment to be truncated to %d bytes, got %d", cut, whole, info.Size())
+		}
+		l.Append(record(4))
+		l.Close()
+		expectRecords(t, dir, 5)
+	}
+}
+
+func TestPartialWrite(t *testing.T) {
+	dir := writeLog(t, 3, 0)
+	path := lastSegment(t, dir)
+
+	// A crash part way through writing a record can leave its header, or garbage, behind.
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	f.Write([]byte{200, 0, 0, 0, 1, 2, 3, 4, 'p', 'a'})
+	f.Close()
+
+	l, err := Open(dir, 0)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	if l.Truncated() != 10 {
+		t.Fatalf("expected 10 bytes to be truncated, got %d", l.Truncated())
+	}
+	l.Append(record(3))
+	l.Close()
+	expectRecords(t, dir, 4)
+}
+
+func TestBitFlips(t *testing.T) {
+	size := len(record(0)) + headerSize
+
+	t.Run("last segment", func(t *testing.T) {
+		for bit := 0; bit < size*8; bit++ {
+			dir := writeLog(t, 3, 0)
+			path := lastSegment(t, dir)
+			data, _ := os.ReadFile(path)
+			data[size+bit/8] ^= 1 << (bit % 8)
+			os.WriteFile(path, data, 0o644)
+
+			// Damage in the last segment cannot be told apart from a torn write, so the
+			// record and everything after it is dropped.
+			expectRecords(t, dir, 1)
+			l, err := Open(dir, 0)
+			if err != nil {
+				t.Fatalf("bit %d: expected nil error, got %v", bit, err)
+			}
+			if l.Truncated() != int64(len(data)-size) {
+				t.Fatalf("bit %d: expected %d bytes to be truncated, got %d", bit, len(data)-size, l.Truncated())
+			}
+			l.Close()
+			expectRecords(t, dir, 1)
+		}
+	})
+
+	t.Run("sealed segment", func(t *testing.T) {
+		dir := writeLog(t, 6, int64(2*size))
+		indexes, _ := segments(dir)
+		path := segmentPath(dir, indexes[0])
+		data, _ := os.ReadFile(path)
+		data[size+headerSize] ^= 0x10
+		os.WriteFile(path, data, 0o644)
+
+		records, err := readAll(t, dir)
+		if err != ErrCorrupt || len(records) != 1 {
+			t.Fatalf("expected ErrCorrupt after 1 record, got %v after %d", err, len(records))
+		}
+
+		// Only the last segment is recovered, so the damage is left alone.
+		l, err := Open(dir, int64(2*size))
+		if err != nil || l.Truncated() != 0 {
+			t.Fatalf("expected nothing to be truncated, got %d, %v", l.Truncated(), err)
+		}
+		l.Close()
+		if after, _ := os.ReadFile(path); !bytes.Equal(after, data) {
+			t.Fatal("expected the sealed segment to be left alone")
+		}
+	})
+}
+
+func TestOtherFilesIgnored(t *testing.T) {
+	dir := writeLog(t, 2, 0)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0o644)
+	os.WriteFile(filepath.Join(dir, "abc.wal"), []byte("hello"), 0o644)
+	os.Mkdir(filepath.Join(dir, "00000000000000000009.wal"), 0o755)
+	expectRecords(t, dir, 2)
+	l, err := Open(dir, 0)
+	if err != nil {
+		t.Fatalf("expected nil error, got %v", err)
+	}
+	l.Close()
+}
+
+func TestPanics(t *testing.T) {
+	panics := []struct {
+		name string
+		fn   func(l *Log)
+	}{
+		{"begin twice", func(l *Log) { l.Begin(); l.Begin() }},
+		{"end without begin", func(l *Log) { l.End() }},
+		{"sync while open", func(l *Log) { l.Begin(); l.Sync() }},
+	}
+	for _, test := range panics {
+		t.Run(test.name, func(t *testing.T) {
+			l, err := Open(t.TempDir(), 0)
+			if err != nil {
+				t.Fatalf("expected nil error, got %v", err)
+			}
+			defer l.file.Close()
+			defer func() {
+				if recover() == nil {
+					t.Fatal("expected a panic")
+				}
+			}()
+			test.fn(l)
+		})
+	}
+}